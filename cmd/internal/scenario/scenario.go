@@ -0,0 +1,57 @@
+// Package scenario descreve fases de falha/atraso dos processors, usadas pelo
+// simulador e pelo gerador de carga.
+package scenario
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Step é uma fase do cenário, aplicada After depois do início (ou do fim da
+// fase anterior). Campos omitidos mantêm o valor atual.
+//
+//	[{"after": "0s", "failure": false, "delay": 0},
+//	 {"after": "10s", "failure": true},
+//	 {"after": "5s", "failure": false, "delay": 800}]
+type Step struct {
+	After   Duration `json:"after"`
+	Failure *bool    `json:"failure,omitempty"`
+	Delay   *int     `json:"delay,omitempty"`
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+func Load(path string) ([]Step, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var steps []Step
+	err = json.Unmarshal(data, &steps)
+	return steps, err
+}
+
+// Run aplica cada fase no seu tempo. Com loop, recomeça ao terminar; sem loop,
+// retorna depois da última fase.
+func Run(steps []Step, loop bool, apply func(Step)) {
+	for {
+		for _, s := range steps {
+			time.Sleep(time.Duration(s.After))
+			apply(s)
+		}
+		if !loop {
+			return
+		}
+	}
+}
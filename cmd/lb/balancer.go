@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// hopHeaders não são repassados entre cliente e backend (RFC 9110, 7.6.1).
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+type backend struct {
+	addr    string
+	network string
+	client  *http.Client
+	active  atomic.Int64
+	healthy atomic.Bool
+}
+
+func newBackend(addr string) *backend {
+	b := &backend{addr: addr, network: "tcp"}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		b.network, b.addr = "unix", path
+	}
+	dialer := &net.Dialer{Timeout: time.Second}
+	b.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, b.network, b.addr)
+			},
+			MaxIdleConns:        256,
+			MaxIdleConnsPerHost: 256,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	b.healthy.Store(true)
+	return b
+}
+
+type balancer struct {
+	backends []*backend
+	retries  int
+	next     atomic.Uint64
+}
+
+// pick escolhe o backend saudável com menos requisições em andamento,
+// ignorando os já tentados. O ponto de partida gira para desempatar.
+func (lb *balancer) pick(tried map[*backend]bool) *backend {
+	var best *backend
+	start := lb.next.Add(1)
+	for i := range lb.backends {
+		b := lb.backends[(int(start)+i)%len(lb.backends)]
+		if !b.healthy.Load() || tried[b] {
+			continue
+		}
+		if best == nil || b.active.Load() < best.active.Load() {
+			best = b
+		}
+	}
+	return best
+}
+
+func (lb *balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	attempts := 1
+	if r.Method == http.MethodGet && r.URL.Path == "/payments-summary" {
+		attempts += lb.retries
+	}
+	var tried map[*backend]bool
+	for i := 0; i < attempts; i++ {
+		b := lb.pick(tried)
+		if b == nil {
+			break
+		}
+		resp, err := lb.forward(b, r)
+		if err == nil && (resp.StatusCode < 500 || i == attempts-1) {
+			copyResponse(w, resp)
+			b.active.Add(-1)
+			return
+		}
+		if err == nil {
+			resp.Body.Close()
+		} else {
+			log.Printf("Erro no backend %s: %v", b.addr, err)
+		}
+		b.active.Add(-1)
+		if tried == nil {
+			tried = make(map[*backend]bool, len(lb.backends))
+		}
+		tried[b] = true
+	}
+	http.Error(w, "no backend available", http.StatusBadGateway)
+}
+
+// forward incrementa b.active; quem chama decrementa depois de consumir a resposta.
+func (lb *balancer) forward(b *backend, r *http.Request) (*http.Response, error) {
+	b.active.Add(1)
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.URL.Scheme = "http"
+	out.URL.Host = "backend"
+	out.Host = r.Host
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		out.Header.Set("X-Forwarded-For", ip)
+	}
+	return b.client.Do(out)
+}
+
+func copyResponse(w http.ResponseWriter, resp *http.Response) {
+	defer resp.Body.Close()
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		copyStream(w, resp.Body)
+		return
+	}
+	io.Copy(w, resp.Body)
+}
+
+// copyStream repassa um Server-Sent Events pedaço a pedaço, com flush a cada
+// leitura: o io.Copy seguraria os eventos no buffer do ResponseWriter.
+func copyStream(w http.ResponseWriter, body io.Reader) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 4096)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// healthCheck marca como indisponível o backend que não aceita conexão.
+func (lb *balancer) healthCheck(interval time.Duration) {
+	for range time.Tick(interval) {
+		for _, b := range lb.backends {
+			conn, err := net.DialTimeout(b.network, b.addr, interval/2)
+			healthy := err == nil
+			if healthy {
+				conn.Close()
+			}
+			if b.healthy.Swap(healthy) != healthy {
+				log.Printf("Backend %s saudável=%t", b.addr, healthy)
+			}
+		}
+	}
+}
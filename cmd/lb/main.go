@@ -0,0 +1,51 @@
+// Balanceador mínimo para substituir nginx/haproxy na frente das instâncias:
+// menor número de conexões ativas, health check por conexão, keep-alive com
+// os backends e retry do GET /payments-summary.
+//
+//	go run ./cmd/lb -listen :9999 -backends unix:/sockets/app1.sock,unix:/sockets/app2.sock
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/transport"
+)
+
+func main() {
+	listen := flag.String("listen", ":9999", "endereço de escuta (host:porta ou unix:/caminho)")
+	backends := flag.String("backends", "unix:/sockets/app1.sock,unix:/sockets/app2.sock", "backends separados por vírgula (host:porta ou unix:/caminho)")
+	healthInterval := flag.Duration("health-interval", time.Second, "intervalo do health check")
+	retries := flag.Int("retries", 1, "tentativas extras em requisições idempotentes")
+	memoryLimit := flag.Int64("memory-limit", 64<<20, "limite de memória do runtime em bytes (0 desliga)")
+	flag.Parse()
+
+	if *memoryLimit > 0 {
+		debug.SetMemoryLimit(*memoryLimit)
+	}
+	var pool []*backend
+	for _, addr := range strings.Split(*backends, ",") {
+		pool = append(pool, newBackend(strings.TrimSpace(addr)))
+	}
+	lb := &balancer{backends: pool, retries: *retries}
+	go lb.healthCheck(*healthInterval)
+
+	ln, err := listenOn(*listen)
+	if err != nil {
+		log.Fatalf("Erro ao escutar em %s: %v", *listen, err)
+	}
+	log.Printf("Balanceando %d backends em %s", len(pool), *listen)
+	log.Fatal(http.Serve(ln, lb))
+}
+
+func listenOn(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return transport.ListenUnix(path, 0o666)
+	}
+	return net.Listen("tcp", addr)
+}
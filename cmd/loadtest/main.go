@@ -0,0 +1,74 @@
+// Gerador de carga que reproduz a pontuação da Rinha: dispara POST /payments
+// em rampas, conduz os simuladores (cmd/simulator) pelas fases de falha e no
+// fim compara /payments-summary com os totais dos processors.
+//
+//	go run ./cmd/loadtest -ramp 10s:100,30s:500,10s:0 \
+//		-default-scenario default.json -markdown report.md
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/cmd/internal/scenario"
+)
+
+func main() {
+	cfg := config{}
+	flag.StringVar(&cfg.target, "target", "http://localhost:9999", "URL base da API")
+	flag.StringVar(&cfg.processors[0], "default", "http://localhost:8001", "URL base do processor default")
+	flag.StringVar(&cfg.processors[1], "fallback", "http://localhost:8002", "URL base do processor fallback")
+	flag.StringVar(&cfg.token, "token", "123", "X-Rinha-Token dos processors e da API administrativa")
+	replay := flag.String("replay", "", "arquivo JSON lines com pagamentos a reenviar (vazio = sintético)")
+	rampSpec := flag.String("ramp", "10s:100,30s:500,10s:0", "estágios duração:rps, com rampa linear entre eles")
+	flag.Float64Var(&cfg.amount, "amount", 19.90, "valor dos pagamentos sintéticos")
+	flag.IntVar(&cfg.concurrency, "concurrency", 500, "máximo de requisições simultâneas")
+	flag.DurationVar(&cfg.settle, "settle", 3*time.Second, "espera após a carga antes de consultar os totais")
+	defaultScenario := flag.String("default-scenario", "", "cenário aplicado ao processor default")
+	fallbackScenario := flag.String("fallback-scenario", "", "cenário aplicado ao processor fallback")
+	jsonOut := flag.String("json", "", "grava o relatório em JSON neste arquivo")
+	mdOut := flag.String("markdown", "", "grava o relatório em markdown neste arquivo")
+	flag.Parse()
+
+	stages, err := parseRamp(*rampSpec)
+	if err != nil {
+		log.Fatalf("Rampa inválida: %v", err)
+	}
+	src, err := newSource(*replay, cfg.amount)
+	if err != nil {
+		log.Fatalf("Erro ao abrir replay: %v", err)
+	}
+	r := newRunner(cfg)
+	if err := r.purge(); err != nil {
+		log.Fatalf("Erro ao limpar ambiente: %v", err)
+	}
+	for i, path := range []string{*defaultScenario, *fallbackScenario} {
+		if path == "" {
+			continue
+		}
+		steps, err := scenario.Load(path)
+		if err != nil {
+			log.Fatalf("Erro ao carregar cenário: %v", err)
+		}
+		base := cfg.processors[i]
+		go scenario.Run(steps, false, func(s scenario.Step) { r.applyStep(base, s) })
+	}
+
+	report := r.run(stages, src)
+	if *jsonOut != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*jsonOut, data, 0o644); err != nil {
+			log.Fatalf("Erro ao gravar relatório: %v", err)
+		}
+	}
+	md := report.markdown()
+	if *mdOut != "" {
+		if err := os.WriteFile(*mdOut, []byte(md), 0o644); err != nil {
+			log.Fatalf("Erro ao gravar relatório: %v", err)
+		}
+	}
+	os.Stdout.WriteString(md)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+var processorNames = [2]string{"default", "fallback"}
+
+const (
+	// Regras da Rinha 2025: bônus de 2% por ms abaixo de 11ms no p99 e multa
+	// de 35% quando o backend diverge dos processors.
+	p99BonusThreshold = 11.0
+	p99BonusPerMs     = 0.02
+	inconsistencyFine = 0.35
+)
+
+type ProcessorSummary struct {
+	TotalRequests     int     `json:"totalRequests"`
+	TotalAmount       float64 `json:"totalAmount"`
+	TotalFee          float64 `json:"totalFee"`
+	FeePerTransaction float64 `json:"feePerTransaction"`
+}
+
+type Latency struct {
+	P50 float64 `json:"p50Ms"`
+	P90 float64 `json:"p90Ms"`
+	P99 float64 `json:"p99Ms"`
+	Max float64 `json:"maxMs"`
+}
+
+type Profit struct {
+	Gross    float64 `json:"gross"`
+	Fees     float64 `json:"fees"`
+	Net      float64 `json:"net"`
+	P99Bonus float64 `json:"p99BonusRate"`
+	Fine     float64 `json:"fineRate"`
+	Final    float64 `json:"final"`
+}
+
+type Report struct {
+	Duration   string                `json:"duration"`
+	Requests   int                   `json:"requests"`
+	Errors     int                   `json:"errors"`
+	Statuses   map[string]int        `json:"statuses"`
+	Latency    Latency               `json:"latency"`
+	Backend    domain.PaymentSummary `json:"backend"`
+	Processors [2]ProcessorSummary   `json:"processors"`
+	Consistent bool                  `json:"consistent"`
+	Issues     []string              `json:"issues,omitempty"`
+	Profit     Profit                `json:"profit"`
+}
+
+func (r *runner) report(duration time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := Report{
+		Duration: duration.Round(time.Millisecond).String(),
+		Requests: len(r.latencies),
+		Errors:   r.errors,
+		Statuses: make(map[string]int),
+	}
+	for code, n := range r.statuses {
+		report.Statuses[strconv.Itoa(code)] = n
+	}
+	slices.Sort(r.latencies)
+	report.Latency = Latency{
+		P50: percentile(r.latencies, 0.50),
+		P90: percentile(r.latencies, 0.90),
+		P99: percentile(r.latencies, 0.99),
+		Max: percentile(r.latencies, 1),
+	}
+	return report
+}
+
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return float64(sorted[max(i, 0)].Microseconds()) / 1000
+}
+
+// score compara cada processor com o que o backend reportou e calcula o lucro
+// a partir do que o backend diz ter processado, como na Rinha.
+func (rep *Report) score() {
+	rep.Consistent = len(rep.Issues) == 0
+	backend := [2]domain.SummaryItem{rep.Backend.Default, rep.Backend.Fallback}
+	for i, proc := range rep.Processors {
+		b := backend[i]
+		if b.TotalRequests != proc.TotalRequests || math.Abs(b.TotalAmount-proc.TotalAmount) > 0.005 {
+			rep.Consistent = false
+			rep.Issues = append(rep.Issues, fmt.Sprintf("%s: backend %d/%.2f, processor %d/%.2f",
+				processorNames[i], b.TotalRequests, b.TotalAmount, proc.TotalRequests, proc.TotalAmount))
+		}
+		rep.Profit.Gross += b.TotalAmount
+		rep.Profit.Fees += b.TotalAmount * proc.FeePerTransaction
+	}
+	rep.Profit.Net = rep.Profit.Gross - rep.Profit.Fees
+	if rep.Latency.P99 < p99BonusThreshold {
+		rep.Profit.P99Bonus = (p99BonusThreshold - rep.Latency.P99) * p99BonusPerMs
+	}
+	if !rep.Consistent {
+		rep.Profit.Fine = inconsistencyFine
+	}
+	rep.Profit.Final = rep.Profit.Net * (1 + rep.Profit.P99Bonus) * (1 - rep.Profit.Fine)
+}
+
+func (rep *Report) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Load test\n\n")
+	fmt.Fprintf(&b, "- Duração: %s\n- Requisições: %d (erros: %d)\n", rep.Duration, rep.Requests, rep.Errors)
+	codes := make([]string, 0, len(rep.Statuses))
+	for code := range rep.Statuses {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&b, "- HTTP %s: %d\n", code, rep.Statuses[code])
+	}
+	fmt.Fprintf(&b, "\n## Latência (ms)\n\n| p50 | p90 | p99 | max |\n|---|---|---|---|\n| %.2f | %.2f | %.2f | %.2f |\n",
+		rep.Latency.P50, rep.Latency.P90, rep.Latency.P99, rep.Latency.Max)
+	fmt.Fprintf(&b, "\n## Consistência: %t\n\n| processor | backend req | backend total | processor req | processor total |\n|---|---|---|---|---|\n", rep.Consistent)
+	backend := [2]domain.SummaryItem{rep.Backend.Default, rep.Backend.Fallback}
+	for i, proc := range rep.Processors {
+		fmt.Fprintf(&b, "| %s | %d | %.2f | %d | %.2f |\n", processorNames[i],
+			backend[i].TotalRequests, backend[i].TotalAmount, proc.TotalRequests, proc.TotalAmount)
+	}
+	for _, issue := range rep.Issues {
+		fmt.Fprintf(&b, "\n- ⚠ %s", issue)
+	}
+	fmt.Fprintf(&b, "\n\n## Lucro\n\n| bruto | taxas | líquido | bônus p99 | multa | final |\n|---|---|---|---|---|---|\n| %.2f | %.2f | %.2f | %.0f%% | %.0f%% | %.2f |\n",
+		rep.Profit.Gross, rep.Profit.Fees, rep.Profit.Net, rep.Profit.P99Bonus*100, rep.Profit.Fine*100, rep.Profit.Final)
+	return b.String()
+}
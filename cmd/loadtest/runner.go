@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/cmd/internal/scenario"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+type config struct {
+	target      string
+	processors  [2]string
+	token       string
+	amount      float64
+	concurrency int
+	settle      time.Duration
+}
+
+type runner struct {
+	cfg    config
+	client *http.Client
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    int
+}
+
+func newRunner(cfg config) *runner {
+	return &runner{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		statuses: make(map[int]int),
+	}
+}
+
+func (r *runner) purge() error {
+	for _, base := range r.cfg.processors {
+		if _, err := r.admin(http.MethodPost, base+"/admin/purge-payments", nil); err != nil {
+			return err
+		}
+	}
+	_, err := r.admin(http.MethodPost, r.cfg.target+"/admin/purge-payments", nil)
+	if err != nil {
+		// Sem ADMIN_TOKEN a API só tem o /purge-payments antigo
+		if _, legacyErr := r.admin(http.MethodPost, r.cfg.target+"/purge-payments", nil); legacyErr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (r *runner) applyStep(base string, s scenario.Step) {
+	if s.Failure != nil {
+		if _, err := r.admin(http.MethodPut, base+"/admin/configurations/failure", map[string]bool{"failure": *s.Failure}); err != nil {
+			log.Printf("Erro ao configurar falha em %s: %v", base, err)
+		}
+	}
+	if s.Delay != nil {
+		if _, err := r.admin(http.MethodPut, base+"/admin/configurations/delay", map[string]int{"delay": *s.Delay}); err != nil {
+			log.Printf("Erro ao configurar atraso em %s: %v", base, err)
+		}
+	}
+}
+
+func (r *runner) admin(method, url string, body any) ([]byte, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Rinha-Token", r.cfg.token)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out bytes.Buffer
+	out.ReadFrom(resp.Body)
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %d", method, url, resp.StatusCode)
+	}
+	return out.Bytes(), nil
+}
+
+// run dispara a carga em malha aberta: a taxa segue a rampa independente do
+// tempo de resposta, limitada apenas por concurrency.
+func (r *runner) run(stages []stage, next source) Report {
+	const tick = 10 * time.Millisecond
+	sem := make(chan struct{}, r.cfg.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	from := start.Add(-time.Second).UTC()
+
+	var prev, pending float64
+	exhausted := false
+	for _, st := range stages {
+		stageStart := time.Now()
+		for elapsed := time.Duration(0); elapsed < st.duration && !exhausted; elapsed = time.Since(stageStart) {
+			rate := prev + (st.target-prev)*float64(elapsed)/float64(st.duration)
+			pending += rate * tick.Seconds()
+			for ; pending >= 1; pending-- {
+				req, ok := next()
+				if !ok {
+					exhausted = true
+					break
+				}
+				sem <- struct{}{}
+				wg.Add(1)
+				go func() {
+					defer func() { <-sem; wg.Done() }()
+					r.send(req)
+				}()
+			}
+			time.Sleep(tick)
+		}
+		prev = st.target
+	}
+	wg.Wait()
+	duration := time.Since(start)
+	time.Sleep(r.cfg.settle)
+	to := time.Now().UTC()
+
+	report := r.report(duration)
+	r.compare(&report, from, to)
+	return report
+}
+
+func (r *runner) send(req domain.PaymentRequest) {
+	body, _ := json.Marshal(req)
+	started := time.Now()
+	resp, err := r.client.Post(r.cfg.target+"/payments", "application/json", bytes.NewReader(body))
+	elapsed := time.Since(started)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Uma requisição que falhou também fez o cliente esperar: fica na latência
+	r.latencies = append(r.latencies, elapsed)
+	if err != nil {
+		r.errors++
+		return
+	}
+	resp.Body.Close()
+	r.statuses[resp.StatusCode]++
+}
+
+func (r *runner) compare(report *Report, from, to time.Time) {
+	// A mesma janela, com a mesma precisão, no backend e nos processors
+	q := url.Values{}
+	q.Set("from", from.Format(time.RFC3339Nano))
+	q.Set("to", to.Format(time.RFC3339Nano))
+	resp, err := r.client.Get(r.cfg.target + "/payments-summary?" + q.Encode())
+	if err != nil {
+		report.Issues = append(report.Issues, "payments-summary: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Um corpo de erro decodificaria como um resumo zerado
+		report.Issues = append(report.Issues, fmt.Sprintf("payments-summary: status %d", resp.StatusCode))
+		return
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report.Backend); err != nil {
+		report.Issues = append(report.Issues, "payments-summary: "+err.Error())
+		return
+	}
+
+	for i, base := range r.cfg.processors {
+		data, err := r.admin(http.MethodGet, base+"/admin/payments-summary?"+q.Encode(), nil)
+		if err == nil {
+			err = json.Unmarshal(data, &report.Processors[i])
+		}
+		if err != nil {
+			report.Issues = append(report.Issues, fmt.Sprintf("%s: %v", processorNames[i], err))
+		}
+	}
+	report.score()
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/alexsandroveiga/rdb25/cmd/internal/scenario"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alexsandroveiga/rdb25/src/server"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/util"
+)
+
+// fakeEnv é a API e os dois processors, todos em httptest: a API conta os
+// pagamentos aceitos e o default reporta o mesmo total.
+type fakeEnv struct {
+	api        *httptest.Server
+	processors [2]*httptest.Server
+	mu         sync.Mutex
+	accepted   int
+	failures   atomic.Bool
+	configured atomic.Int32
+	// dropEvery fecha a conexão sem resposta a cada n pagamentos
+	dropEvery int
+	received  atomic.Int32
+}
+
+func newFakeEnv(t *testing.T, dropEvery int) *fakeEnv {
+	t.Helper()
+	env := &fakeEnv{dropEvery: dropEvery}
+	api := http.NewServeMux()
+	api.HandleFunc("POST /payments", func(w http.ResponseWriter, r *http.Request) {
+		if n := env.received.Add(1); env.dropEvery > 0 && int(n)%env.dropEvery == 0 {
+			time.Sleep(5 * time.Millisecond)
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		env.mu.Lock()
+		env.accepted++
+		env.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	api.HandleFunc("GET /payments-summary", func(w http.ResponseWriter, r *http.Request) {
+		env.mu.Lock()
+		n := env.accepted
+		env.mu.Unlock()
+		json.NewEncoder(w).Encode(domain.PaymentSummary{Default: domain.SummaryItem{TotalRequests: n, TotalAmount: float64(n) * 10}})
+	})
+	api.HandleFunc("POST /admin/purge-payments", func(w http.ResponseWriter, r *http.Request) {})
+	env.api = httptest.NewServer(api)
+	t.Cleanup(env.api.Close)
+
+	for i, fee := range []float64{0.05, 0.15} {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /admin/payments-summary", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Rinha-Token") != "123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			s := ProcessorSummary{FeePerTransaction: fee}
+			if i == 0 {
+				env.mu.Lock()
+				s.TotalRequests, s.TotalAmount = env.accepted, float64(env.accepted)*10
+				env.mu.Unlock()
+			}
+			json.NewEncoder(w).Encode(s)
+		})
+		mux.HandleFunc("POST /admin/purge-payments", func(w http.ResponseWriter, r *http.Request) {})
+		mux.HandleFunc("PUT /admin/configurations/failure", func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Failure bool `json:"failure"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			env.failures.Store(body.Failure)
+			env.configured.Add(1)
+		})
+		env.processors[i] = httptest.NewServer(mux)
+		t.Cleanup(env.processors[i].Close)
+	}
+	return env
+}
+
+func (env *fakeEnv) runner() *runner {
+	return newRunner(config{
+		target:      env.api.URL,
+		processors:  [2]string{env.processors[0].URL, env.processors[1].URL},
+		token:       "123",
+		amount:      10,
+		concurrency: 8,
+		settle:      10 * time.Millisecond,
+	})
+}
+
+// fixed devolve n pagamentos sintéticos e encerra.
+func fixed(n int) source {
+	next, _ := newSource("", 10)
+	return func() (domain.PaymentRequest, bool) {
+		if n == 0 {
+			return domain.PaymentRequest{}, false
+		}
+		n--
+		return next()
+	}
+}
+
+func TestRunConsistent(t *testing.T) {
+	env := newFakeEnv(t, 0)
+	r := env.runner()
+	if err := r.purge(); err != nil {
+		t.Fatal(err)
+	}
+	failure := true
+	r.applyStep(env.processors[0].URL, scenario.Step{Failure: &failure})
+	if !env.failures.Load() || env.configured.Load() != 1 {
+		t.Error("scenario step did not reach the processor")
+	}
+
+	stages, err := parseRamp("200ms:500,200ms:500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := r.run(stages, fixed(50))
+	if report.Requests != 50 || report.Errors != 0 || report.Statuses["204"] != 50 {
+		t.Errorf("report = %+v", report)
+	}
+	if !report.Consistent || report.Profit.Fine != 0 || report.Profit.Gross != 500 {
+		t.Errorf("consistency = %t, profit %+v, issues %v", report.Consistent, report.Profit, report.Issues)
+	}
+	if want := 500 * (1 - 0.05); report.Profit.Net != want {
+		t.Errorf("net = %v, want %v", report.Profit.Net, want)
+	}
+}
+
+// TestRunCountsErrorLatency: uma requisição sem resposta entra na contagem e
+// na latência, não só em Errors.
+func TestRunCountsErrorLatency(t *testing.T) {
+	env := newFakeEnv(t, 5)
+	r := env.runner()
+	stages, _ := parseRamp("300ms:500")
+	report := r.run(stages, fixed(40))
+	if report.Requests != 40 || report.Errors != 8 {
+		t.Errorf("requests %d, errors %d; want 40 and 8", report.Requests, report.Errors)
+	}
+	if len(r.latencies) != 40 {
+		t.Errorf("%d latencies for 40 requests", len(r.latencies))
+	}
+	if report.Latency.Max < 5 {
+		t.Errorf("max latency %vms, want the 5ms dropped requests", report.Latency.Max)
+	}
+}
+
+// TestCompareBackend: o resumo do backend é pedido com a mesma precisão dos
+// processors, e uma resposta de erro vira issue em vez de um resumo zerado.
+func TestCompareBackend(t *testing.T) {
+	env := newFakeEnv(t, 0)
+	var query string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"error": "full queue"})
+	}))
+	t.Cleanup(api.Close)
+	env.api = api
+	r := env.runner()
+
+	from := time.Date(2025, 7, 15, 12, 0, 0, 123456789, time.UTC)
+	var report Report
+	r.compare(&report, from, from.Add(time.Second))
+	if want := "from=" + url.QueryEscape(from.Format(time.RFC3339Nano)); !strings.Contains(query, want) {
+		t.Errorf("query = %q, want %s", query, want)
+	}
+	if report.Consistent || len(report.Issues) != 1 || !strings.Contains(report.Issues[0], "503") {
+		t.Errorf("consistent %t, issues %v; want the 503 reported", report.Consistent, report.Issues)
+	}
+}
+
+// TestPurgeGateway limpa o gateway de verdade, com e sem ADMIN_TOKEN: o
+// loadtest não pode morrer no purge de uma instalação sem API administrativa.
+func TestPurgeGateway(t *testing.T) {
+	for _, token := range []string{"123", ""} {
+		t.Run("token="+token, func(t *testing.T) {
+			env := newFakeEnv(t, 0)
+			mr := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { client.Close() })
+			util.SetRedisClient(client)
+			srv := server.New(server.Config{QueueSize: 10, Workers: 1, ReconcileInterval: time.Hour, PeerTimeout: time.Second, AdminToken: token}, server.Dependencies{
+				Payments:  repository.NewRedisPaymentRepository(client),
+				Unknowns:  repository.NewRedisReconciliationRepository(client),
+				Statuses:  repository.NewRedisStatusRepository(client),
+				Processor: processor.NewClient(),
+			})
+			if err := srv.Start(); err != nil {
+				t.Fatal(err)
+			}
+			ts := httptest.NewServer(transport.HTTPHandler(srv.Routes(), transport.Config{}))
+			t.Cleanup(func() {
+				ts.Close()
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				srv.Shutdown(ctx)
+			})
+			r := env.runner()
+			r.cfg.target = ts.URL
+			if err := r.purge(); err != nil {
+				t.Errorf("purge: %v", err)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		backend    int
+		processor  int
+		p99        float64
+		consistent bool
+		bonus      float64
+	}{
+		{"consistent and fast", 10, 10, 1, true, 0.2},
+		{"slow", 10, 10, 20, true, 0},
+		{"inconsistent", 10, 9, 20, false, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rep := Report{Latency: Latency{P99: tc.p99}}
+			rep.Backend.Default = domain.SummaryItem{TotalRequests: tc.backend, TotalAmount: float64(tc.backend)}
+			rep.Processors[0] = ProcessorSummary{TotalRequests: tc.processor, TotalAmount: float64(tc.processor), FeePerTransaction: 0.05}
+			rep.score()
+			if rep.Consistent != tc.consistent || rep.Profit.P99Bonus != tc.bonus {
+				t.Errorf("consistent %t, bonus %v", rep.Consistent, rep.Profit.P99Bonus)
+			}
+			fine := 0.0
+			if !tc.consistent {
+				fine = inconsistencyFine
+			}
+			want := float64(tc.backend) * 0.95 * (1 + tc.bonus) * (1 - fine)
+			if diff := rep.Profit.Final - want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("final = %v, want %v", rep.Profit.Final, want)
+			}
+		})
+	}
+}
+
+func TestParseRamp(t *testing.T) {
+	stages, err := parseRamp("10s:100, 30s:500,10s:0")
+	if err != nil || len(stages) != 3 || stages[1] != (stage{30 * time.Second, 500}) {
+		t.Errorf("stages = %v, %v", stages, err)
+	}
+	for _, spec := range []string{"10s", "x:1", "1s:y"} {
+		if _, err := parseRamp(spec); err == nil {
+			t.Errorf("%q: no error", spec)
+		}
+	}
+}
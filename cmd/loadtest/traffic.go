@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+type stage struct {
+	duration time.Duration
+	target   float64
+}
+
+// parseRamp lê "10s:100,30s:500,10s:0": em cada estágio a taxa sai do alvo
+// anterior (começando em 0) e chega linearmente ao alvo do estágio.
+func parseRamp(spec string) ([]stage, error) {
+	var stages []stage
+	for _, part := range strings.Split(spec, ",") {
+		dur, rate, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("estágio %q sem ':'", part)
+		}
+		d, err := time.ParseDuration(dur)
+		if err != nil {
+			return nil, err
+		}
+		t, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage{d, t})
+	}
+	return stages, nil
+}
+
+// source devolve o próximo pagamento; ok=false encerra a carga.
+type source func() (req domain.PaymentRequest, ok bool)
+
+func newSource(replayPath string, amount float64) (source, error) {
+	if replayPath == "" {
+		return func() (domain.PaymentRequest, bool) {
+			return domain.PaymentRequest{CorrelationID: newUUID(), Amount: amount}, true
+		}, nil
+	}
+	f, err := os.Open(replayPath)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	return func() (domain.PaymentRequest, bool) {
+		for scanner.Scan() {
+			var req domain.PaymentRequest
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				continue
+			}
+			return req, true
+		}
+		f.Close()
+		return domain.PaymentRequest{}, false
+	}, nil
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	proc "github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alexsandroveiga/rdb25/src/server"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/util"
+)
+
+// startGateway sobe o gateway com Redis em processo apontando para os dois
+// simuladores e devolve a URL dele.
+func startGateway(t *testing.T, def, fb *sim) string {
+	t.Helper()
+	t.Setenv("URL_PROCESSOR_DEFAULT", def.URL+"/payments")
+	t.Setenv("URL_PROCESSOR_FALLBACK", fb.URL+"/payments")
+	t.Setenv("URL_HEALTH_DEFAULT", def.URL+"/payments/service-health")
+	t.Setenv("URL_HEALTH_FALLBACK", fb.URL+"/payments/service-health")
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	util.SetRedisClient(client)
+	srv := server.New(server.Config{
+		QueueSize:         1000,
+		Workers:           4,
+		ReconcileInterval: time.Hour,
+		PeerTimeout:       time.Second,
+	}, server.Dependencies{
+		Payments:  repository.NewRedisPaymentRepository(client),
+		Unknowns:  repository.NewRedisReconciliationRepository(client),
+		Statuses:  repository.NewRedisStatusRepository(client),
+		Processor: proc.NewClient(),
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(transport.HTTPHandler(srv.Routes(), transport.Config{}))
+	t.Cleanup(func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return ts.URL
+}
+
+// TestFlow roda o fluxo completo contra os simuladores: o default cai no
+// meio da carga e o resumo do gateway tem que bater com os dois.
+func TestFlow(t *testing.T) {
+	def, fb := newSim(t, 0.05), newSim(t, 0.15)
+	gateway := startGateway(t, def, fb)
+	from := time.Now().UTC().Add(-time.Second)
+	pay := func(n int) {
+		t.Helper()
+		body, _ := json.Marshal(domain.PaymentRequest{CorrelationID: fmt.Sprintf("00000000-0000-4000-8000-%012d", n), Amount: 19.9})
+		resp, err := http.Post(gateway+"/payments", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("POST /payments: status %d", resp.StatusCode)
+		}
+	}
+	// waitSummary espera o gateway chegar a want pagamentos gravados
+	waitSummary := func(want int) domain.PaymentSummary {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			to := time.Now().UTC().Add(time.Second)
+			q := url.Values{"from": {from.Format(time.RFC3339Nano)}, "to": {to.Format(time.RFC3339Nano)}}
+			resp, err := http.Get(gateway + "/payments-summary?" + q.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var s domain.PaymentSummary
+			json.NewDecoder(resp.Body).Decode(&s)
+			resp.Body.Close()
+			if s.Default.TotalRequests+s.Fallback.TotalRequests == want {
+				return s
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("gateway summary = %+v, want %d requests", s, want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	for i := range 20 {
+		pay(i)
+	}
+	// O POST só enfileira: o default cai depois de os workers gravarem os primeiros
+	if s := waitSummary(20); s.Default.TotalRequests != 20 {
+		t.Errorf("before the failure = %+v, want all on default", s)
+	}
+	def.do(t, http.MethodPut, "/admin/configurations/failure", map[string]bool{"failure": true}, true)
+	for i := 20; i < 40; i++ {
+		pay(i)
+	}
+	backend := waitSummary(40)
+	if backend.Fallback.TotalRequests != 20 {
+		t.Errorf("fallback got %d, want the 20 sent while default failed", backend.Fallback.TotalRequests)
+	}
+
+	to := time.Now().UTC().Add(time.Second)
+	for name, check := range map[string]struct {
+		sim  *sim
+		item domain.SummaryItem
+	}{"default": {def, backend.Default}, "fallback": {fb, backend.Fallback}} {
+		got := check.sim.summary(t, from, to)
+		if got.TotalRequests != check.item.TotalRequests || fmt.Sprintf("%.2f", got.TotalAmount) != fmt.Sprintf("%.2f", check.item.TotalAmount) {
+			t.Errorf("%s: processor %+v, gateway %+v", name, got, check.item)
+		}
+	}
+}
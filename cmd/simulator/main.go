@@ -0,0 +1,36 @@
+// Simulador do Payment Processor da Rinha para rodar o fluxo completo sem a
+// rede externa payment-processor. Suba um para o default e outro para o
+// fallback:
+//
+//	go run ./cmd/simulator -addr :8001 -fee 0.05
+//	go run ./cmd/simulator -addr :8002 -fee 0.15 -scenario scenario.json
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/alexsandroveiga/rdb25/cmd/internal/scenario"
+)
+
+func main() {
+	addr := flag.String("addr", ":8001", "endereço de escuta")
+	fee := flag.Float64("fee", 0.05, "taxa cobrada por transação")
+	token := flag.String("token", "123", "valor esperado em X-Rinha-Token")
+	scenarioPath := flag.String("scenario", "", "arquivo JSON com as fases de falha/atraso")
+	loop := flag.Bool("loop", false, "repete o cenário ao terminar")
+	flag.Parse()
+
+	p := newProcessor(*fee, *token)
+	if *scenarioPath != "" {
+		steps, err := scenario.Load(*scenarioPath)
+		if err != nil {
+			log.Fatalf("Erro ao carregar cenário: %v", err)
+		}
+		go scenario.Run(steps, *loop, func(s scenario.Step) { applyStep(p, s) })
+	}
+
+	log.Printf("Simulador ouvindo em %s (fee=%.2f)", *addr, *fee)
+	log.Fatal(http.ListenAndServe(*addr, p.routes()))
+}
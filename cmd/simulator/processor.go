@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const healthInterval = 5 * time.Second
+
+type payment struct {
+	CorrelationID string    `json:"correlationId"`
+	Amount        float64   `json:"amount"`
+	RequestedAt   time.Time `json:"requestedAt"`
+}
+
+type summary struct {
+	TotalRequests     int     `json:"totalRequests"`
+	TotalAmount       float64 `json:"totalAmount"`
+	TotalFee          float64 `json:"totalFee"`
+	FeePerTransaction float64 `json:"feePerTransaction"`
+}
+
+type processor struct {
+	mu          sync.RWMutex
+	payments    map[string]payment
+	fee         float64
+	token       string
+	failing     bool
+	delay       time.Duration
+	lastHealth  time.Time
+	healthMutex sync.Mutex
+}
+
+func newProcessor(fee float64, token string) *processor {
+	return &processor{payments: make(map[string]payment), fee: fee, token: token}
+}
+
+func (p *processor) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payments", p.handlePayment)
+	mux.HandleFunc("GET /payments/service-health", p.handleHealth)
+	mux.HandleFunc("GET /payments/{id}", p.handleLookup)
+	mux.HandleFunc("GET /admin/payments-summary", p.admin(p.handleSummary))
+	mux.HandleFunc("POST /admin/purge-payments", p.admin(p.handlePurge))
+	mux.HandleFunc("PUT /admin/configurations/token", p.admin(p.handleToken))
+	mux.HandleFunc("PUT /admin/configurations/delay", p.admin(p.handleDelay))
+	mux.HandleFunc("PUT /admin/configurations/failure", p.admin(p.handleFailure))
+	return mux
+}
+
+func (p *processor) config() (failing bool, delay time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.failing, p.delay
+}
+
+func (p *processor) setFailure(failing bool) {
+	p.mu.Lock()
+	p.failing = failing
+	p.mu.Unlock()
+}
+
+func (p *processor) setDelay(delay time.Duration) {
+	p.mu.Lock()
+	p.delay = delay
+	p.mu.Unlock()
+}
+
+func (p *processor) handlePayment(w http.ResponseWriter, r *http.Request) {
+	var req payment
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CorrelationID == "" || req.Amount <= 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "invalid payment"})
+		return
+	}
+	failing, delay := p.config()
+	time.Sleep(delay)
+	if failing {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"message": "payment processor failing"})
+		return
+	}
+	if req.RequestedAt.IsZero() {
+		req.RequestedAt = time.Now().UTC()
+	}
+	p.mu.Lock()
+	_, duplicated := p.payments[req.CorrelationID]
+	if !duplicated {
+		p.payments[req.CorrelationID] = req
+	}
+	p.mu.Unlock()
+	if duplicated {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "correlationId already exists"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "payment processed successfully"})
+}
+
+// handleHealth imita o limite do processor real: uma chamada a cada 5s.
+func (p *processor) handleHealth(w http.ResponseWriter, r *http.Request) {
+	p.healthMutex.Lock()
+	now := time.Now()
+	limited := now.Sub(p.lastHealth) < healthInterval
+	if !limited {
+		p.lastHealth = now
+	}
+	p.healthMutex.Unlock()
+	if limited {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	failing, delay := p.config()
+	writeJSON(w, http.StatusOK, map[string]any{"failing": failing, "minResponseTime": delay.Milliseconds()})
+}
+
+func (p *processor) handleLookup(w http.ResponseWriter, r *http.Request) {
+	p.mu.RLock()
+	pay, ok := p.payments[r.PathValue("id")]
+	p.mu.RUnlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, pay)
+}
+
+func (p *processor) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.mu.RLock()
+		token := p.token
+		p.mu.RUnlock()
+		if r.Header.Get("X-Rinha-Token") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (p *processor) handleSummary(w http.ResponseWriter, r *http.Request) {
+	from, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("from"))
+	to, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("to"))
+	if err != nil {
+		to = time.Now().UTC()
+	}
+	s := summary{FeePerTransaction: p.fee}
+	p.mu.RLock()
+	for _, pay := range p.payments {
+		if pay.RequestedAt.Before(from) || pay.RequestedAt.After(to) {
+			continue
+		}
+		s.TotalRequests++
+		s.TotalAmount += pay.Amount
+	}
+	p.mu.RUnlock()
+	s.TotalFee = s.TotalAmount * p.fee
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (p *processor) handlePurge(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.payments = make(map[string]payment)
+	p.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"message": "All payments purged."})
+}
+
+func (p *processor) handleToken(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.token = body.Token
+	p.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *processor) handleDelay(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Delay int `json:"delay"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Delay < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.setDelay(time.Duration(body.Delay) * time.Millisecond)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *processor) handleFailure(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Failure bool `json:"failure"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.setFailure(body.Failure)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
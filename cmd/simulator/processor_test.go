@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/cmd/internal/scenario"
+)
+
+const token = "123"
+
+// sim é um simulador servido por httptest.
+type sim struct {
+	*httptest.Server
+	p *processor
+}
+
+func newSim(t *testing.T, fee float64) *sim {
+	t.Helper()
+	p := newProcessor(fee, token)
+	s := &sim{httptest.NewServer(p.routes()), p}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sim) do(t *testing.T, method, path string, body any, admin bool) (int, []byte) {
+	t.Helper()
+	var r bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&r).Encode(body)
+	}
+	req, err := http.NewRequest(method, s.URL+path, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin {
+		req.Header.Set("X-Rinha-Token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out bytes.Buffer
+	out.ReadFrom(resp.Body)
+	return resp.StatusCode, out.Bytes()
+}
+
+func (s *sim) summary(t *testing.T, from, to time.Time) summary {
+	t.Helper()
+	q := url.Values{"from": {from.Format(time.RFC3339Nano)}, "to": {to.Format(time.RFC3339Nano)}}
+	status, body := s.do(t, http.MethodGet, "/admin/payments-summary?"+q.Encode(), nil, true)
+	var got summary
+	if status != http.StatusOK || json.Unmarshal(body, &got) != nil {
+		t.Fatalf("summary: status %d, body %s", status, body)
+	}
+	return got
+}
+
+func TestProcessorPayments(t *testing.T) {
+	s := newSim(t, 0.05)
+	at := time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC)
+	pay := map[string]any{"correlationId": "a", "amount": 10, "requestedAt": at}
+	if status, body := s.do(t, http.MethodPost, "/payments", pay, false); status != http.StatusOK {
+		t.Fatalf("pay: status %d, body %s", status, body)
+	}
+	if status, _ := s.do(t, http.MethodPost, "/payments", pay, false); status != http.StatusUnprocessableEntity {
+		t.Errorf("duplicated: status %d, want 422", status)
+	}
+	if status, _ := s.do(t, http.MethodPost, "/payments", map[string]any{"correlationId": "b"}, false); status != http.StatusUnprocessableEntity {
+		t.Errorf("no amount: status %d, want 422", status)
+	}
+	if status, _ := s.do(t, http.MethodGet, "/payments/a", nil, false); status != http.StatusOK {
+		t.Errorf("lookup: status %d", status)
+	}
+	if status, _ := s.do(t, http.MethodGet, "/payments/b", nil, false); status != http.StatusNotFound {
+		t.Errorf("lookup missing: status %d, want 404", status)
+	}
+
+	got := s.summary(t, at, at)
+	if got.TotalRequests != 1 || got.TotalAmount != 10 || got.TotalFee != 0.5 || got.FeePerTransaction != 0.05 {
+		t.Errorf("summary = %+v", got)
+	}
+	if got := s.summary(t, at.Add(time.Millisecond), at.Add(time.Hour)); got.TotalRequests != 0 {
+		t.Errorf("summary after = %+v", got)
+	}
+	if status, _ := s.do(t, http.MethodGet, "/admin/payments-summary", nil, false); status != http.StatusUnauthorized {
+		t.Errorf("no token: status %d, want 401", status)
+	}
+	if status, _ := s.do(t, http.MethodPost, "/admin/purge-payments", nil, true); status != http.StatusOK {
+		t.Errorf("purge: status %d", status)
+	}
+	if got := s.summary(t, at, at); got.TotalRequests != 0 {
+		t.Errorf("summary after purge = %+v", got)
+	}
+}
+
+func TestProcessorConfiguration(t *testing.T) {
+	s := newSim(t, 0.15)
+	if status, _ := s.do(t, http.MethodPut, "/admin/configurations/failure", map[string]bool{"failure": true}, true); status != http.StatusNoContent {
+		t.Fatalf("failure: status %d", status)
+	}
+	if status, _ := s.do(t, http.MethodPost, "/payments", map[string]any{"correlationId": "a", "amount": 1}, false); status != http.StatusInternalServerError {
+		t.Errorf("failing: status %d, want 500", status)
+	}
+	s.do(t, http.MethodPut, "/admin/configurations/failure", map[string]bool{"failure": false}, true)
+	s.do(t, http.MethodPut, "/admin/configurations/delay", map[string]int{"delay": 50}, true)
+	start := time.Now()
+	if status, _ := s.do(t, http.MethodPost, "/payments", map[string]any{"correlationId": "a", "amount": 1}, false); status != http.StatusOK {
+		t.Errorf("recovered: status %d", status)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("answered in %v with a 50ms delay", elapsed)
+	}
+
+	// Uma consulta de health a cada 5s
+	status, body := s.do(t, http.MethodGet, "/payments/service-health", nil, false)
+	var health struct {
+		Failing         bool  `json:"failing"`
+		MinResponseTime int64 `json:"minResponseTime"`
+	}
+	if status != http.StatusOK || json.Unmarshal(body, &health) != nil || health.MinResponseTime != 50 {
+		t.Errorf("health: status %d, body %s", status, body)
+	}
+	if status, _ := s.do(t, http.MethodGet, "/payments/service-health", nil, false); status != http.StatusTooManyRequests {
+		t.Errorf("second health: status %d, want 429", status)
+	}
+
+	if status, _ := s.do(t, http.MethodPut, "/admin/configurations/token", map[string]string{"token": "new"}, true); status != http.StatusNoContent {
+		t.Fatalf("token: status %d", status)
+	}
+	if status, _ := s.do(t, http.MethodPost, "/admin/purge-payments", nil, true); status != http.StatusUnauthorized {
+		t.Errorf("old token: status %d, want 401", status)
+	}
+}
+
+func TestScenario(t *testing.T) {
+	p := newProcessor(0.05, token)
+	failing, delay := true, 20
+	steps := []scenario.Step{
+		{Failure: &failing},
+		{After: scenario.Duration(10 * time.Millisecond), Delay: &delay},
+	}
+	scenario.Run(steps, false, func(s scenario.Step) { applyStep(p, s) })
+	if f, d := p.config(); !f || d != 20*time.Millisecond {
+		t.Errorf("config = %t, %v", f, d)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/cmd/internal/scenario"
+)
+
+func applyStep(p *processor, s scenario.Step) {
+	if s.Failure != nil {
+		p.setFailure(*s.Failure)
+	}
+	if s.Delay != nil {
+		p.setDelay(time.Duration(*s.Delay) * time.Millisecond)
+	}
+	failing, delay := p.config()
+	log.Printf("🎬 Cenário: failing=%t delay=%s", failing, delay)
+}
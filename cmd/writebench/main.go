@@ -0,0 +1,121 @@
+// Mede a vazão de repository.Process com e sem o batch.Writer: cada
+// goroutine faz o papel de um worker gravando pagamentos sem parar.
+//
+//	go run ./cmd/writebench -redis localhost:6379 -n 200000 -c 64
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/batch"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+func main() {
+	addr := flag.String("redis", "localhost:6379", "endereço do Redis")
+	dir := flag.String("dir", "", "mede o storage em arquivo neste diretório em vez do Redis")
+	fsync := flag.String("fsync", repository.FsyncAlways, "política de fsync do storage em arquivo")
+	n := flag.Int("n", 100000, "pagamentos por rodada")
+	concurrency := flag.Int("c", 64, "goroutines gravando ao mesmo tempo")
+	sizes := flag.String("batch", "1,16,64,256", "tamanhos de lote a medir (1 = sem batching)")
+	linger := flag.Duration("linger", time.Millisecond, "espera máxima para completar um lote")
+	flag.Parse()
+
+	var payments repository.RedisPaymentRepository
+	if *dir != "" {
+		os.RemoveAll(*dir)
+		store, err := repository.OpenFilePaymentRepository(repository.FileConfig{
+			Dir:              *dir,
+			Fsync:            *fsync,
+			FsyncInterval:    time.Second,
+			SnapshotInterval: time.Hour,
+			SegmentSize:      1 << 30,
+		})
+		if err != nil {
+			log.Fatalf("Erro ao abrir o storage: %v", err)
+		}
+		defer store.Close()
+		payments = store
+	} else {
+		client := redis.NewClient(&redis.Options{Addr: *addr, PoolSize: *concurrency})
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			log.Fatalf("Erro ao conectar no Redis: %v", err)
+		}
+		payments = repository.NewRedisPaymentRepository(client)
+	}
+	backend := payments.(repository.BatchProcessor)
+
+	fmt.Printf("| lote | pagamentos/s | p99 Process (ms) | erros |\n|---|---|---|---|\n")
+	for _, field := range strings.Split(*sizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size < 1 {
+			log.Fatalf("Tamanho de lote inválido: %q", field)
+		}
+		var target repository.RedisPaymentRepository = payments
+		var writer *batch.Writer
+		if size > 1 {
+			writer = batch.NewWriter(backend, batch.Config{Size: size, Linger: *linger})
+			writer.Start()
+			target = batch.Wrap(writer, payments)
+		}
+		rate, p99, errs := run(target, *n, *concurrency)
+		if writer != nil {
+			writer.Stop()
+		}
+		fmt.Printf("| %d | %.0f | %.2f | %d |\n", size, rate, p99, errs)
+	}
+}
+
+// run grava n pagamentos com concurrency goroutines e devolve a vazão, o p99
+// de cada Process e quantos falharam.
+func run(payments repository.RedisPaymentRepository, n, concurrency int) (float64, float64, int64) {
+	var next, errs atomic.Int64
+	latencies := make([]time.Duration, n)
+	now := time.Now().UTC()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := next.Add(1) - 1
+				if i >= int64(n) {
+					return
+				}
+				p := domain.Payment{
+					CorrelationID: fmt.Sprintf("bench-%d-%d", start.UnixNano(), i),
+					Amount:        19.90,
+					RequestedAt:   now,
+					Processor:     "default",
+				}
+				t := time.Now()
+				if err := payments.Process(p); err != nil {
+					errs.Add(1)
+				}
+				latencies[i] = time.Since(t)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	return float64(n) / elapsed.Seconds(), percentile(latencies, 0.99), errs.Load()
+}
+
+func percentile(latencies []time.Duration, q float64) float64 {
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+	return float64(sorted[int(float64(len(sorted)-1)*q)]) / float64(time.Millisecond)
+}
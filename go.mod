@@ -2,11 +2,20 @@ module github.com/alexsandroveiga/rdb25
 
 go 1.24.5
 
-require github.com/gofiber/fiber/v3 v3.0.0-beta.5
+require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/gofiber/fiber/v3 v3.0.0-beta.5
+	github.com/jackc/pgx/v5 v5.7.5
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/sync v0.16.0 // indirect
 )
 
 require (
@@ -22,7 +31,7 @@ require (
 	github.com/redis/go-redis/v9 v9.12.0
 	github.com/tinylib/msgp v1.3.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.64.0 // indirect
+	github.com/valyala/fasthttp v1.64.0
 	golang.org/x/crypto v0.40.0 // indirect
 	golang.org/x/net v0.42.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
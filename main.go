@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/alexsandroveiga/rdb25/src/cluster"
 	"github.com/alexsandroveiga/rdb25/src/configuration/database/redis"
-	"github.com/alexsandroveiga/rdb25/src/configuration/queue"
-	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/events"
+	"github.com/alexsandroveiga/rdb25/src/messaging"
+	"github.com/alexsandroveiga/rdb25/src/processor"
 	"github.com/alexsandroveiga/rdb25/src/repository"
-	"github.com/alexsandroveiga/rdb25/src/worker"
-	"github.com/gofiber/fiber/v3"
+	"github.com/alexsandroveiga/rdb25/src/server"
+	"github.com/alexsandroveiga/rdb25/src/util"
+	"github.com/alexsandroveiga/rdb25/src/webhook"
 	"github.com/joho/godotenv"
 )
 
@@ -24,68 +28,88 @@ func main() {
 		log.Fatalf("Error trying to connect to database, error=%s \n", err.Error())
 		return
 	}
-	queue.Queue = make(chan domain.PaymentRequest, 10000)
-
-	// queue := messaging.NewPaymentMessaging(client)
-	repository := repository.NewRedisPaymentRepository(client)
-	// go worker.StartWorker(queue, repository)
-	worker.ProcessPayment(repository)
-	app := fiber.New(fiber.Config{
-		CaseSensitive: true,
-		StrictRouting: true,
-	})
-
-	app.Get("/payments-summary", func(c fiber.Ctx) error {
-		fromStr := c.Query("from")
-		toStr := c.Query("to")
-		var from time.Time
-		var to time.Time
-		var err error
-		if fromStr == "" {
-			from = time.Time{} // zero time, início do tempo Go
-		} else {
-			from, err = time.Parse(time.RFC3339, fromStr)
-			if err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid from datetime"})
-			}
+	util.SetRedisClient(client)
+	deps := server.Dependencies{
+		Payments:  repository.NewRedisPaymentRepository(client),
+		Unknowns:  repository.NewRedisReconciliationRepository(client),
+		Statuses:  repository.NewRedisStatusRepository(client),
+		Processor: processor.NewClient(),
+		Pending:   repository.NewRedisPendingRepository(client),
+	}
+	// Sem relay o stream do resumo só vê os pagamentos desta instância, mas
+	// também não há PUBSUB NUMSUB a cada 500ms
+	if os.Getenv("SUMMARY_STREAM_RELAY") == "redis" {
+		deps.Events = events.NewRedisRelay(client)
+	}
+	if os.Getenv("ADMISSION_OVERFLOW") == "redis" {
+		deps.Overflow = messaging.NewPaymentMessaging(client)
+	}
+	switch peers := os.Getenv("SUMMARY_PEERS"); peers {
+	case "":
+	case "redis":
+		advertise := os.Getenv("SUMMARY_ADVERTISE_URL")
+		if advertise == "" {
+			// Sem endereço os peers não teriam como consultar os totais desta instância
+			log.Fatalln("SUMMARY_PEERS=redis requer SUMMARY_ADVERTISE_URL")
 		}
-		if toStr == "" {
-			to = time.Now().UTC()
-		} else {
-			to, err = time.Parse(time.RFC3339, toStr)
-			if err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid to datetime"})
-			}
+		registry := cluster.NewRedisRegistry(client, advertise)
+		registry.Start()
+		deps.Discovery = registry
+	default:
+		deps.Discovery = cluster.StaticPeers(strings.Split(peers, ","))
+	}
+	if config := webhook.ConfigFromEnv(); len(config.Endpoints) > 0 {
+		if deps.Webhooks, err = webhook.NewDispatcher(client, config); err != nil {
+			log.Fatalf("Error trying to enable webhooks, error=%s \n", err.Error())
 		}
-		summary, err := repository.GetSummary(from, to)
-		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	config := server.ConfigFromEnv()
+	// STORAGE troca só onde ficam os pagamentos. Unknowns, Statuses, Pending,
+	// Events (e overflow, webhooks e registry, quando ligados) continuam no
+	// Redis, então REDIS_URL é obrigatório com qualquer STORAGE.
+	var store *repository.FilePaymentRepository
+	switch os.Getenv("STORAGE") {
+	case "file":
+		if store, err = repository.OpenFilePaymentRepository(repository.FileConfigFromEnv()); err != nil {
+			log.Fatalf("Error trying to open file storage, error=%s \n", err.Error())
 		}
-		return c.Status(http.StatusOK).JSON(summary)
-	})
-
-	app.Post("/payments", func(c fiber.Ctx) error {
-		var req domain.PaymentRequest
-		if err := json.Unmarshal(c.Body(), &req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		deps.Payments = store
+		log.Println("Storage em arquivo: o Redis segue guardando status, reconciliação, pendentes e eventos")
+		if config.Prefork {
+			// Cada processo filho abriria o mesmo diretório
+			log.Println("Prefork desativado: o storage em arquivo é de um processo só")
+			config.Prefork = false
 		}
-		select {
-		case queue.Queue <- req:
-			return c.SendStatus(fiber.StatusNoContent)
-		default:
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "full queue"})
+	case "postgres":
+		postgres, err := repository.NewPostgresPaymentRepository(context.Background(), os.Getenv("DATABASE_URL"))
+		if err != nil {
+			log.Fatalf("Error trying to connect to postgres, error=%s \n", err.Error())
 		}
-		// if err := queue.Produce(context.Background(), req); err != nil {
-		// 	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "full queue"})
-		// }
-		// return c.SendStatus(fiber.StatusOK)
-	})
+		defer postgres.Close()
+		deps.Payments = postgres
+	}
+	srv := server.New(config, deps)
 
-	app.Post("/purge-payments", func(c fiber.Ctx) error {
-		if err := repository.Purge(); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Println("Erro no shutdown:", err)
+		}
+		if store != nil {
+			if err := store.Close(); err != nil {
+				log.Println("Erro ao fechar o storage:", err)
+			}
 		}
-		return c.SendStatus(fiber.StatusNoContent)
-	})
-	log.Fatal(app.Listen(os.Getenv("PORT"), fiber.ListenConfig{EnablePrefork: true}))
+	}()
+	if err := srv.Start(); err != nil {
+		log.Fatal(err)
+	}
+	// Start volta assim que o listener fecha; espera o Shutdown terminar
+	<-done
 }
@@ -0,0 +1,162 @@
+package admission
+
+import (
+	"context"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/messaging"
+)
+
+type Decision int
+
+const (
+	Admitted Decision = iota
+	// Spilled: a fila local estava cheia e o pagamento foi para o overflow no Redis.
+	Spilled
+	// Shed: a fila passou do limite de load shedding, o cliente deve tentar depois (429).
+	Shed
+	// Rejected: fila cheia e sem overflow disponível (503).
+	Rejected
+)
+
+const (
+	minRetryAfter = 1
+	maxRetryAfter = 30
+)
+
+// NewController lê ADMISSION_SHED_THRESHOLD (fração da capacidade da fila,
+// ex.: 0.8) para ligar o load shedding. overflow pode ser nil.
+func NewController(queue chan domain.PaymentRequest, overflow messaging.PaymentMessaging) *Controller {
+	shedAt := cap(queue)
+	if threshold, err := strconv.ParseFloat(os.Getenv("ADMISSION_SHED_THRESHOLD"), 64); err == nil && threshold > 0 && threshold < 1 {
+		shedAt = int(float64(cap(queue)) * threshold)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Controller{queue: queue, overflow: overflow, shedAt: shedAt, ctx: ctx, cancel: cancel}
+}
+
+type Controller struct {
+	queue    chan domain.PaymentRequest
+	overflow messaging.PaymentMessaging
+	shedAt   int
+	admitted atomic.Int64
+	// drainRate em pagamentos/s, guardado como bits de float64.
+	drainRate atomic.Uint64
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+func (c *Controller) Start() {
+	go c.sample()
+	if c.overflow != nil {
+		go c.drainOverflow()
+	}
+}
+
+func (c *Controller) Stop() {
+	c.cancel()
+}
+
+func (c *Controller) Admit(req domain.PaymentRequest) Decision {
+	if len(c.queue) < c.shedAt {
+		select {
+		case c.queue <- req:
+			c.admitted.Add(1)
+			return Admitted
+		default:
+		}
+	}
+	if c.overflow != nil {
+		if err := c.overflow.Produce(context.Background(), req); err == nil {
+			return Spilled
+		}
+	}
+	if len(c.queue) < cap(c.queue) {
+		return Shed
+	}
+	return Rejected
+}
+
+// Stats é o retrato da fila local exposto pela API administrativa.
+type Stats struct {
+	Length    int     `json:"length"`
+	Capacity  int     `json:"capacity"`
+	ShedAt    int     `json:"shedAt"`
+	DrainRate float64 `json:"drainRate"`
+	Overflow  bool    `json:"overflow"`
+}
+
+func (c *Controller) Stats() Stats {
+	return Stats{
+		Length:    len(c.queue),
+		Capacity:  cap(c.queue),
+		ShedAt:    c.shedAt,
+		DrainRate: math.Float64frombits(c.drainRate.Load()),
+		Overflow:  c.overflow != nil,
+	}
+}
+
+// RetryAfter estima em segundos quanto tempo a fila atual leva para escoar.
+func (c *Controller) RetryAfter() int {
+	rate := math.Float64frombits(c.drainRate.Load())
+	if rate < 1 {
+		return maxRetryAfter
+	}
+	secs := int(math.Ceil(float64(len(c.queue)) / rate))
+	return max(minRetryAfter, min(secs, maxRetryAfter))
+}
+
+// sample mede a vazão da fila uma vez por segundo: o que entrou menos o
+// quanto a fila cresceu é o que os workers consumiram. Média móvel exponencial
+// para não oscilar a cada amostra.
+func (c *Controller) sample() {
+	const alpha = 0.3
+	prevLen := len(c.queue)
+	prevAdmitted := c.admitted.Load()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		curLen := len(c.queue)
+		curAdmitted := c.admitted.Load()
+		drained := float64(curAdmitted-prevAdmitted) - float64(curLen-prevLen)
+		rate := math.Float64frombits(c.drainRate.Load())
+		rate = alpha*max(drained, 0) + (1-alpha)*rate
+		c.drainRate.Store(math.Float64bits(rate))
+		prevLen, prevAdmitted = curLen, curAdmitted
+	}
+}
+
+// drainOverflow devolve para a fila local o que foi desviado para o Redis.
+// O envio para o channel bloqueia enquanto a fila estiver cheia.
+func (c *Controller) drainOverflow() {
+	for {
+		req, err := c.overflow.Consume(c.ctx)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Println("Erro ao consumir overflow:", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		select {
+		case c.queue <- req:
+			c.admitted.Add(1)
+		case <-c.ctx.Done():
+			// Devolve ao Redis para outra instância consumir
+			c.overflow.Produce(context.Background(), req)
+			return
+		}
+	}
+}
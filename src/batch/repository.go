@@ -0,0 +1,20 @@
+package batch
+
+import (
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+// Wrap faz o Process de payments passar por w; o resto vai direto.
+func Wrap(w *Writer, payments repository.RedisPaymentRepository) repository.RedisPaymentRepository {
+	return &batchRepository{payments, w}
+}
+
+type batchRepository struct {
+	repository.RedisPaymentRepository
+	writer *Writer
+}
+
+func (r *batchRepository) Process(p domain.Payment) error {
+	return r.writer.Write(p)
+}
@@ -0,0 +1,195 @@
+package batch
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+// ErrClosed é devolvido por Write depois do Stop.
+var ErrClosed = errors.New("batch writer stopped")
+
+// Um lote que falha é tentado de novo flushRetries vezes, com a espera
+// dobrando a partir de flushBackoff, antes de cair para uma gravação por
+// pagamento. Os workers ficam esperando o tempo todo, então as esperas são
+// curtas.
+const (
+	flushRetries = 2
+	flushBackoff = 10 * time.Millisecond
+)
+
+type Config struct {
+	// Size é o máximo de pagamentos por lote; um lote cheio sai na hora.
+	Size int
+	// Linger é quanto o primeiro pagamento de um lote pode esperar por
+	// companhia antes do flush. Zero manda assim que não houver mais nada na
+	// fila.
+	Linger time.Duration
+}
+
+func NewWriter(backend repository.BatchProcessor, config Config) *Writer {
+	return &Writer{
+		backend:  backend,
+		config:   config,
+		requests: make(chan request, config.Size),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Writer junta os Process de todos os workers em lotes gravados com um só
+// ProcessBatch. A fila tem espaço para um lote: com ela cheia, Write
+// bloqueia, e a pressão volta para os workers em vez de acumular memória.
+//
+// Um lote nunca passa do número de chamadores esperando, então quando todos
+// já estão nele o flush sai sem esperar o Linger: com poucos workers isso
+// evita pagar a espera inteira em cada gravação.
+type Writer struct {
+	backend  repository.BatchProcessor
+	config   Config
+	requests chan request
+	waiting  atomic.Int64 // Write que ainda não receberam o resultado
+	mu       sync.RWMutex // Write (leitura) contra Stop (escrita)
+	stopped  bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type request struct {
+	payment domain.Payment
+	result  chan error
+}
+
+var results = sync.Pool{New: func() any { return make(chan error, 1) }}
+
+// Write entrega p ao próximo lote e espera o flush, devolvendo o erro do lote.
+func (w *Writer) Write(p domain.Payment) error {
+	result := results.Get().(chan error)
+	w.mu.RLock()
+	if w.stopped {
+		w.mu.RUnlock()
+		results.Put(result)
+		return ErrClosed
+	}
+	w.waiting.Add(1)
+	w.requests <- request{p, result}
+	w.mu.RUnlock()
+	err := <-result
+	results.Put(result)
+	return err
+}
+
+func (w *Writer) Start() {
+	go w.run()
+}
+
+// Stop grava o que já está na fila e recusa novos Write.
+func (w *Writer) Stop() {
+	w.mu.Lock()
+	w.stopped = true
+	w.mu.Unlock()
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+	batch := make([]request, 0, w.config.Size)
+	payments := make([]domain.Payment, 0, w.config.Size)
+	linger := time.NewTimer(0)
+	<-linger.C
+	for {
+		select {
+		case r := <-w.requests:
+			batch = append(batch[:0], r)
+		case <-w.stop:
+			w.drain(batch[:0], payments[:0])
+			return
+		}
+		batch = w.collect(batch, linger)
+		payments = w.flush(batch, payments[:0])
+	}
+}
+
+// collect completa o lote até Size, até todos os chamadores estarem nele ou
+// até o Linger vencer.
+func (w *Writer) collect(batch []request, linger *time.Timer) []request {
+	if w.config.Linger <= 0 {
+		for w.wants(batch) {
+			select {
+			case r := <-w.requests:
+				batch = append(batch, r)
+			default:
+				return batch
+			}
+		}
+		return batch
+	}
+	linger.Reset(w.config.Linger)
+	defer linger.Stop()
+	for w.wants(batch) {
+		select {
+		case r := <-w.requests:
+			batch = append(batch, r)
+		case <-linger.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (w *Writer) wants(batch []request) bool {
+	return len(batch) < w.config.Size && int64(len(batch)) < w.waiting.Load()
+}
+
+func (w *Writer) flush(batch []request, payments []domain.Payment) []domain.Payment {
+	for _, r := range batch {
+		payments = append(payments, r.payment)
+	}
+	err := w.backend.ProcessBatch(payments)
+	for attempt, backoff := 0, flushBackoff; err != nil && attempt < flushRetries; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = w.backend.ProcessBatch(payments)
+	}
+	// Antes de responder, para o próximo collect não contar quem já foi atendido
+	w.waiting.Add(-int64(len(batch)))
+	if err == nil || len(batch) == 1 {
+		for _, r := range batch {
+			r.result <- err
+		}
+		return payments
+	}
+	// Um pagamento que o backend recusa não derruba os outros do lote: cada
+	// um é gravado sozinho e recebe o próprio erro
+	log.Printf("⚠ Lote de %d pagamentos não gravado, gravando um a um: %v", len(batch), err)
+	for i, r := range batch {
+		r.result <- w.backend.ProcessBatch(payments[i : i+1])
+	}
+	return payments
+}
+
+// drain grava o que sobrou na fila no Stop. Depois de stopped nenhum Write
+// novo entra, então a fila só diminui.
+func (w *Writer) drain(batch []request, payments []domain.Payment) {
+	for {
+		select {
+		case r := <-w.requests:
+			batch = append(batch, r)
+			if len(batch) < w.config.Size {
+				continue
+			}
+		default:
+			if len(batch) == 0 {
+				return
+			}
+		}
+		payments = w.flush(batch, payments[:0])
+		batch = batch[:0]
+	}
+}
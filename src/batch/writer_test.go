@@ -0,0 +1,304 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// recorder guarda o tamanho de cada lote gravado e, com gate, segura o
+// ProcessBatch até o teste liberar. fail decide se a chamada calls falha.
+type recorder struct {
+	mu      sync.Mutex
+	batches []int
+	ids     []string
+	calls   int
+	fail    func(calls int, payments []domain.Payment) error
+	gate    chan struct{}
+}
+
+func (r *recorder) ProcessBatch(payments []domain.Payment) error {
+	if r.gate != nil {
+		<-r.gate
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.fail != nil {
+		if err := r.fail(r.calls, payments); err != nil {
+			return err
+		}
+	}
+	r.batches = append(r.batches, len(payments))
+	for _, p := range payments {
+		r.ids = append(r.ids, p.CorrelationID)
+	}
+	return nil
+}
+
+func (r *recorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.batches)
+}
+
+func payment(n int) domain.Payment {
+	return domain.Payment{CorrelationID: fmt.Sprintf("id-%04d", n), Amount: 1, RequestedAt: time.Now(), Processor: "default"}
+}
+
+// writeAll chama Write de n goroutines e devolve um canal com os erros.
+func writeAll(w *Writer, n int) <-chan error {
+	errs := make(chan error, n)
+	for i := range n {
+		go func() { errs <- w.Write(payment(i)) }()
+	}
+	return errs
+}
+
+// waitFor espera n chamadores contados em waiting.
+func waitFor(t *testing.T, w *Writer, n int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for w.waiting.Load() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiting = %d, want %d", w.waiting.Load(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func collectErrs(t *testing.T, errs <-chan error, n int) {
+	t.Helper()
+	for range n {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Errorf("write: %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("write did not return")
+		}
+	}
+}
+
+// TestWriterFlushOnSize: com todos os chamadores já na fila e Linger longo,
+// o lote sai quando enche.
+func TestWriterFlushOnSize(t *testing.T) {
+	backend := &recorder{}
+	w := NewWriter(backend, Config{Size: 4, Linger: time.Hour})
+	errs := writeAll(w, 8)
+	waitFor(t, w, 8)
+	w.Start()
+	defer w.Stop()
+	collectErrs(t, errs, 8)
+	if got := backend.sizes(); !slices.Equal(got, []int{4, 4}) {
+		t.Errorf("batches = %v, want [4 4]", got)
+	}
+}
+
+// TestWriterFlushOnLinger: enquanto falta um chamador no lote, ele espera o
+// Linger e sai assim mesmo.
+func TestWriterFlushOnLinger(t *testing.T) {
+	backend := &recorder{}
+	linger := 50 * time.Millisecond
+	w := NewWriter(backend, Config{Size: 16, Linger: linger})
+	w.Start()
+	defer w.Stop()
+	// Um chamador contado que nunca chega à fila
+	w.waiting.Add(1)
+	defer w.waiting.Add(-1)
+	start := time.Now()
+	if err := w.Write(payment(0)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < linger {
+		t.Errorf("flushed after %v, before the %v linger", elapsed, linger)
+	}
+	if got := backend.sizes(); !slices.Equal(got, []int{1}) {
+		t.Errorf("batches = %v, want [1]", got)
+	}
+}
+
+// TestWriterFlushWhenAllWaiting: com todos os chamadores no lote não há por
+// que esperar o Linger.
+func TestWriterFlushWhenAllWaiting(t *testing.T) {
+	backend := &recorder{}
+	w := NewWriter(backend, Config{Size: 16, Linger: time.Hour})
+	w.Start()
+	defer w.Stop()
+	if err := w.Write(payment(0)); err != nil {
+		t.Fatal(err)
+	}
+	collectErrs(t, writeAll(w, 3), 3)
+	if got := backend.sizes(); slices.Max(got) > 3 || len(backend.ids) != 4 {
+		t.Errorf("batches = %v", got)
+	}
+}
+
+// TestWriterReportsErrors: o erro do lote chega a todos os chamadores dele.
+func TestWriterReportsErrors(t *testing.T) {
+	failure := errors.New("down")
+	backend := &recorder{fail: func(int, []domain.Payment) error { return failure }}
+	w := NewWriter(backend, Config{Size: 4, Linger: time.Hour})
+	errs := writeAll(w, 4)
+	waitFor(t, w, 4)
+	w.Start()
+	defer w.Stop()
+	for range 4 {
+		if err := <-errs; !errors.Is(err, failure) {
+			t.Errorf("err = %v, want %v", err, failure)
+		}
+	}
+}
+
+// TestWriterRetries: um lote que falha de passagem é gravado inteiro na
+// nova tentativa, sem erro para os chamadores.
+func TestWriterRetries(t *testing.T) {
+	backend := &recorder{fail: func(calls int, _ []domain.Payment) error {
+		if calls <= flushRetries {
+			return errors.New("down")
+		}
+		return nil
+	}}
+	w := NewWriter(backend, Config{Size: 4, Linger: time.Hour})
+	errs := writeAll(w, 4)
+	waitFor(t, w, 4)
+	w.Start()
+	defer w.Stop()
+	collectErrs(t, errs, 4)
+	if got := backend.sizes(); !slices.Equal(got, []int{4}) {
+		t.Errorf("batches = %v, want one batch of 4 after the retries", got)
+	}
+}
+
+// TestWriterFallsBackPerPayment: com um pagamento que o backend sempre
+// recusa, os outros do lote são gravados e só ele recebe o erro.
+func TestWriterFallsBackPerPayment(t *testing.T) {
+	failure := errors.New("rejected")
+	bad := payment(2).CorrelationID
+	backend := &recorder{fail: func(_ int, payments []domain.Payment) error {
+		if slices.ContainsFunc(payments, func(p domain.Payment) bool { return p.CorrelationID == bad }) {
+			return failure
+		}
+		return nil
+	}}
+	w := NewWriter(backend, Config{Size: 4, Linger: time.Hour})
+	results := make([]chan error, 4)
+	for i := range results {
+		results[i] = make(chan error, 1)
+		go func() { results[i] <- w.Write(payment(i)) }()
+	}
+	waitFor(t, w, 4)
+	w.Start()
+	defer w.Stop()
+	for i, result := range results {
+		id := payment(i).CorrelationID
+		select {
+		case err := <-result:
+			if want := id == bad; errors.Is(err, failure) != want {
+				t.Errorf("%s: err = %v", id, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: write did not return", id)
+		}
+	}
+	if got := backend.sizes(); !slices.Equal(got, []int{1, 1, 1}) {
+		t.Errorf("batches = %v, want the three good payments one by one", got)
+	}
+}
+
+// TestWriterDrainsOnStop: o que estava na fila no Stop é gravado e os
+// Write seguintes são recusados.
+func TestWriterDrainsOnStop(t *testing.T) {
+	backend := &recorder{gate: make(chan struct{})}
+	w := NewWriter(backend, Config{Size: 8, Linger: time.Hour})
+	w.Start()
+	// O primeiro fica preso no ProcessBatch enquanto os outros entram na fila
+	errs := writeAll(w, 1)
+	waitFor(t, w, 1)
+	more := writeAll(w, 5)
+	waitFor(t, w, 6)
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+	// Espera o Stop marcar stopped antes de soltar o backend
+	for {
+		w.mu.RLock()
+		s := w.stopped
+		w.mu.RUnlock()
+		if s {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(backend.gate)
+	<-stopped
+	collectErrs(t, errs, 1)
+	collectErrs(t, more, 5)
+	if len(backend.ids) != 6 {
+		t.Errorf("wrote %d payments, want 6", len(backend.ids))
+	}
+	if err := w.Write(payment(99)); err != ErrClosed {
+		t.Errorf("write after stop: %v", err)
+	}
+}
+
+func benchRedis(b *testing.B) repository.RedisPaymentRepository {
+	mr := miniredis.RunT(b)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), PoolSize: 64})
+	b.Cleanup(func() { client.Close() })
+	return repository.NewRedisPaymentRepository(client)
+}
+
+// BenchmarkProcess é a base: um SET por pagamento, de vários workers.
+func BenchmarkProcess(b *testing.B) {
+	repo := benchRedis(b)
+	var n atomic.Int64
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := repo.Process(payment(int(n.Add(1)))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkWriter grava os mesmos pagamentos pelo Writer, sem Linger e com o
+// Linger padrão do servidor.
+func BenchmarkWriter(b *testing.B) {
+	for _, config := range []Config{
+		{Size: 256, Linger: 0},
+		{Size: 256, Linger: time.Millisecond},
+	} {
+		b.Run(fmt.Sprintf("linger=%v", config.Linger), func(b *testing.B) {
+			repo := benchRedis(b)
+			w := NewWriter(repo.(repository.BatchProcessor), config)
+			w.Start()
+			defer w.Stop()
+			var n atomic.Int64
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := w.Write(payment(int(n.Add(1)))); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
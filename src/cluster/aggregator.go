@@ -0,0 +1,336 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+const (
+	LocalSummaryPath = "/internal/payments-summary"
+	// LocalPurgePath e LocalRestorePath aplicam nos totais desta instância um
+	// purge ou restore feito no Redis por outra; recebem o PurgeFilter em JSON.
+	LocalPurgePath   = "/internal/payments-purge"
+	LocalRestorePath = "/internal/payments-restore"
+	// SeededHeader vai com "false" no resumo local de uma instância cujos
+	// totais ainda não cobrem os pagamentos que ela gravou antes de reiniciar.
+	SeededHeader = "X-Summary-Seeded"
+)
+
+// Discovery devolve a URL base dos outros peers (http://host:porta ou unix:/caminho).
+type Discovery interface {
+	Peers() ([]string, error)
+}
+
+type StaticPeers []string
+
+func (p StaticPeers) Peers() ([]string, error) {
+	return p, nil
+}
+
+// NewAggregator cria o agregador; auth vai nos headers das chamadas que
+// alteram os totais dos peers.
+func NewAggregator(discovery Discovery, timeout time.Duration, auth http.Header) *Aggregator {
+	return &Aggregator{local: newTotals(), discovery: discovery, timeout: timeout, auth: auth, tcp: &http.Client{}}
+}
+
+// Aggregator mantém os totais desta instância em memória e soma com os dos
+// peers na hora do resumo, sem varrer o Redis. Purge e restore vão para o
+// Redis e para os totais de todas as instâncias.
+type Aggregator struct {
+	local     *totals
+	repo      repository.RedisPaymentRepository
+	seeded    atomic.Bool
+	discovery Discovery
+	timeout   time.Duration
+	auth      http.Header
+	tcp       *http.Client
+	unix      sync.Map // caminho do socket -> *http.Client
+}
+
+// Wrap faz com que tudo o que for gravado em payments também entre nos
+// totais locais.
+func (a *Aggregator) Wrap(payments repository.RedisPaymentRepository) repository.RedisPaymentRepository {
+	a.repo = payments
+	return &recordingRepository{payments, a}
+}
+
+// Seed prepara os totais locais na subida, antes dos workers. Sozinha no
+// cluster, a instância assume tudo o que está no repositório. Com peers ela
+// não tem como saber quais pagamentos gravou antes de reiniciar, então só
+// confere se a soma do cluster já bate com o repositório; enquanto não bater
+// (até um purge que zere a diferença), o resumo sai com Consistent false.
+func (a *Aggregator) Seed() error {
+	peers, err := a.discovery.Peers()
+	if err != nil {
+		return err
+	}
+	if len(peers) > 0 {
+		if !a.check() {
+			log.Println("⚠ Totais locais sem os pagamentos anteriores ao restart: resumo inconsistente até um purge")
+		}
+		return nil
+	}
+	var n int
+	err = a.repo.EachPayment(domain.PaymentFilter{}, func(p domain.Payment) error {
+		a.local.Process(p)
+		n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.seeded.Store(true)
+	log.Printf("📊 Totais locais carregados do repositório: %d pagamentos", n)
+	return nil
+}
+
+// Seeded diz se os totais locais cobrem tudo o que esta instância gravou.
+func (a *Aggregator) Seeded() bool {
+	return a.seeded.Load()
+}
+
+// check marca a instância como semeada se a soma do cluster inteiro bate com
+// o repositório. Só roda enquanto ela não estiver semeada.
+func (a *Aggregator) check() bool {
+	if a.seeded.Load() {
+		return true
+	}
+	want, err := a.repo.GetSummary(time.Time{}, time.Time{})
+	if err != nil {
+		return false
+	}
+	got, err := a.collect(time.Time{}, time.Time{})
+	if err != nil || !sameSummary(got, want) {
+		return false
+	}
+	a.seeded.Store(true)
+	log.Println("📊 Totais locais conferem com o repositório")
+	return true
+}
+
+func sameSummary(a, b domain.PaymentSummary) bool {
+	same := func(x, y domain.SummaryItem) bool {
+		return x.TotalRequests == y.TotalRequests && math.Round(x.TotalAmount*100) == math.Round(y.TotalAmount*100)
+	}
+	return same(a.Default, b.Default) && same(a.Fallback, b.Fallback)
+}
+
+func (a *Aggregator) Local(from, to time.Time) domain.PaymentSummary {
+	return a.local.Summary(from, to)
+}
+
+// PurgeLocal aplica nos totais desta instância o purge feito por um peer.
+func (a *Aggregator) PurgeLocal(filter domain.PurgeFilter) {
+	a.local.Purge(filter)
+	a.check()
+}
+
+// RestoreLocal aplica nos totais desta instância o restore feito por um peer.
+func (a *Aggregator) RestoreLocal(filter domain.PurgeFilter) {
+	a.local.Restore(filter)
+	a.check()
+}
+
+// broadcast repete nos peers o purge ou restore já aplicado no Redis. Um peer
+// fora do ar fica com os totais antigos até reiniciar; o erro só vai para o log.
+func (a *Aggregator) broadcast(path string, filter domain.PurgeFilter) {
+	peers, err := a.discovery.Peers()
+	if err != nil {
+		log.Printf("⚠ Totais dos peers não atualizados em %s: %v", path, err)
+		return
+	}
+	body, err := json.Marshal(filter)
+	if err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.post(peer, path, body); err != nil {
+				log.Printf("⚠ Peer %s não atualizou os totais em %s: %v", peer, path, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (a *Aggregator) post(peer, path string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	client, base := a.clientFor(peer)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range a.auth {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("peer %s returned %d", peer, resp.StatusCode)
+	}
+	return nil
+}
+
+func (a *Aggregator) Summary(from, to time.Time) domain.ClusterSummary {
+	summary := domain.ClusterSummary{PaymentSummary: a.Local(from, to), Consistent: a.seeded.Load()}
+	peers, err := a.discovery.Peers()
+	if err != nil {
+		summary.Consistent = false
+	}
+	results := a.fetchAll(peers, from, to)
+	for i, peer := range peers {
+		if results[i].err != nil {
+			summary.Consistent = false
+			summary.Unreachable = append(summary.Unreachable, peer)
+			continue
+		}
+		if !results[i].seeded {
+			summary.Consistent = false
+		}
+		addSummary(&summary.PaymentSummary, results[i].summary)
+	}
+	return summary
+}
+
+// collect soma os totais locais com os de todos os peers; qualquer peer fora
+// do ar é erro.
+func (a *Aggregator) collect(from, to time.Time) (domain.PaymentSummary, error) {
+	summary := a.Local(from, to)
+	peers, err := a.discovery.Peers()
+	if err != nil {
+		return summary, err
+	}
+	for _, r := range a.fetchAll(peers, from, to) {
+		if r.err != nil {
+			return summary, r.err
+		}
+		addSummary(&summary, r.summary)
+	}
+	return summary, nil
+}
+
+type peerSummary struct {
+	summary domain.PaymentSummary
+	seeded  bool
+	err     error
+}
+
+func (a *Aggregator) fetchAll(peers []string, from, to time.Time) []peerSummary {
+	results := make([]peerSummary, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &results[i]
+			r.summary, r.seeded, r.err = a.fetch(peer, from, to)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func addSummary(dst *domain.PaymentSummary, s domain.PaymentSummary) {
+	dst.Default.TotalAmount += s.Default.TotalAmount
+	dst.Default.TotalRequests += s.Default.TotalRequests
+	dst.Fallback.TotalAmount += s.Fallback.TotalAmount
+	dst.Fallback.TotalRequests += s.Fallback.TotalRequests
+}
+
+func (a *Aggregator) fetch(peer string, from, to time.Time) (domain.PaymentSummary, bool, error) {
+	var summary domain.PaymentSummary
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+	q := url.Values{}
+	q.Set("from", from.UTC().Format(time.RFC3339Nano))
+	q.Set("to", to.UTC().Format(time.RFC3339Nano))
+	client, base := a.clientFor(peer)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+LocalSummaryPath+"?"+q.Encode(), nil)
+	if err != nil {
+		return summary, false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return summary, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return summary, false, fmt.Errorf("peer %s returned %d", peer, resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&summary)
+	return summary, resp.Header.Get(SeededHeader) != "false", err
+}
+
+// clientFor devolve o client e a URL base de peer. Peers "unix:/caminho"
+// ganham um client próprio que sempre disca no socket.
+func (a *Aggregator) clientFor(peer string) (*http.Client, string) {
+	path, ok := strings.CutPrefix(peer, "unix:")
+	if !ok {
+		return a.tcp, strings.TrimSuffix(peer, "/")
+	}
+	if c, ok := a.unix.Load(path); ok {
+		return c.(*http.Client), "http://peer"
+	}
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	actual, _ := a.unix.LoadOrStore(path, c)
+	return actual.(*http.Client), "http://peer"
+}
+
+type recordingRepository struct {
+	repository.RedisPaymentRepository
+	aggregator *Aggregator
+}
+
+func (r *recordingRepository) Process(p domain.Payment) error {
+	if err := r.RedisPaymentRepository.Process(p); err != nil {
+		return err
+	}
+	r.aggregator.local.Process(p)
+	return nil
+}
+
+func (r *recordingRepository) Purge(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	result, err := r.RedisPaymentRepository.Purge(filter)
+	if err == nil && !filter.DryRun {
+		r.aggregator.local.Purge(filter)
+		r.aggregator.broadcast(LocalPurgePath, filter)
+		r.aggregator.check()
+	}
+	return result, err
+}
+
+func (r *recordingRepository) Restore(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	result, err := r.RedisPaymentRepository.Restore(filter)
+	if err == nil && !filter.DryRun {
+		r.aggregator.local.Restore(filter)
+		r.aggregator.broadcast(LocalRestorePath, filter)
+		r.aggregator.check()
+	}
+	return result, err
+}
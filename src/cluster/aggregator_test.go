@@ -0,0 +1,255 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+var base = time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC)
+
+func payment(id string, offset time.Duration, processor string) domain.Payment {
+	return domain.Payment{CorrelationID: id, Amount: 10, RequestedAt: base.Add(offset), Processor: processor}
+}
+
+func TestTotalsSummary(t *testing.T) {
+	totals := newTotals()
+	// Fora de ordem, como chegam dos workers
+	for i, offset := range []time.Duration{2500 * time.Millisecond, 0, 500 * time.Millisecond, time.Second, 5 * time.Second} {
+		totals.Process(payment(string(rune('a'+i)), offset, "default"))
+	}
+	totals.Process(payment("f", time.Second, "fallback"))
+	tests := []struct {
+		name     string
+		from, to time.Time
+		def, fb  int
+	}{
+		{"all", time.Time{}, base.Add(time.Hour), 5, 1},
+		{"sub-second edges", base.Add(400 * time.Millisecond), base.Add(2600 * time.Millisecond), 3, 1},
+		{"inclusive", base.Add(500 * time.Millisecond), base.Add(2500 * time.Millisecond), 3, 1},
+		{"same second", base.Add(100 * time.Millisecond), base.Add(600 * time.Millisecond), 1, 0},
+		{"empty", base.Add(3 * time.Second), base.Add(4 * time.Second), 0, 0},
+		{"before everything", time.Time{}, base.Add(-time.Second), 0, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := totals.Summary(tc.from, tc.to)
+			if got.Default.TotalRequests != tc.def || got.Fallback.TotalRequests != tc.fb {
+				t.Errorf("summary = %+v, want %d default and %d fallback", got, tc.def, tc.fb)
+			}
+			if got.Default.TotalAmount != float64(tc.def*10) {
+				t.Errorf("default amount = %v", got.Default.TotalAmount)
+			}
+		})
+	}
+}
+
+func TestTotalsPurgeRestore(t *testing.T) {
+	totals := newTotals()
+	for i := range 4 {
+		totals.Process(payment(string(rune('a'+i)), time.Duration(i)*time.Second, "default"))
+	}
+	all := func() int { return totals.Summary(time.Time{}, base.Add(time.Hour)).Default.TotalRequests }
+
+	totals.Purge(domain.PurgeFilter{PaymentFilter: domain.PaymentFilter{To: base.Add(time.Second)}, DryRun: true})
+	if all() != 4 {
+		t.Fatal("dry run changed the totals")
+	}
+	totals.Purge(domain.PurgeFilter{PaymentFilter: domain.PaymentFilter{To: base.Add(time.Second)}, Archive: true})
+	if n := all(); n != 2 {
+		t.Fatalf("after archive = %d, want 2", n)
+	}
+	totals.Purge(domain.PurgeFilter{PaymentFilter: domain.PaymentFilter{From: base.Add(3 * time.Second)}})
+	if n := all(); n != 1 {
+		t.Fatalf("after delete = %d, want 1", n)
+	}
+	totals.Restore(domain.PurgeFilter{})
+	if n := all(); n != 3 {
+		t.Fatalf("after restore = %d, want 3", n)
+	}
+	if len(totals.seconds) != len(totals.buckets) {
+		t.Errorf("%d seconds for %d buckets", len(totals.seconds), len(totals.buckets))
+	}
+}
+
+// stubPayments é o repositório do Redis, que não interessa aqui.
+type stubPayments struct {
+	repository.RedisPaymentRepository
+}
+
+func (stubPayments) Process(domain.Payment) error { return nil }
+func (stubPayments) Purge(f domain.PurgeFilter) (domain.PurgeResult, error) {
+	return domain.PurgeResult{DryRun: f.DryRun}, nil
+}
+func (stubPayments) GetSummary(time.Time, time.Time) (domain.PaymentSummary, error) {
+	return domain.PaymentSummary{}, nil
+}
+
+// memPayments é o repositório compartilhado pelas instâncias, em memória.
+type memPayments struct {
+	repository.RedisPaymentRepository
+	payments *[]domain.Payment
+}
+
+func (m memPayments) Process(p domain.Payment) error {
+	*m.payments = append(*m.payments, p)
+	return nil
+}
+func (m memPayments) Purge(f domain.PurgeFilter) (domain.PurgeResult, error) {
+	*m.payments = slices.DeleteFunc(*m.payments, f.Matches)
+	return domain.PurgeResult{}, nil
+}
+func (m memPayments) EachPayment(f domain.PaymentFilter, fn func(domain.Payment) error) error {
+	for _, p := range *m.payments {
+		if f.Matches(p) {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func (m memPayments) GetSummary(from, to time.Time) (domain.PaymentSummary, error) {
+	var summary domain.PaymentSummary
+	m.EachPayment(domain.PaymentFilter{From: from, To: to}, func(p domain.Payment) error {
+		add(&summary, p)
+		return nil
+	})
+	return summary, nil
+}
+
+// servePeer expõe os endpoints internos de agg como o servidor faz.
+func servePeer(t *testing.T, agg *Aggregator) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+LocalSummaryPath, func(w http.ResponseWriter, r *http.Request) {
+		from, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("from"))
+		to, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("to"))
+		if !agg.Seeded() {
+			w.Header().Set(SeededHeader, "false")
+		}
+		json.NewEncoder(w).Encode(agg.Local(from, to))
+	})
+	mux.HandleFunc("POST "+LocalPurgePath, func(w http.ResponseWriter, r *http.Request) {
+		var filter domain.PurgeFilter
+		json.NewDecoder(r.Body).Decode(&filter)
+		agg.PurgeLocal(filter)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// TestPurgeBroadcast confere que o purge chega aos totais do peer.
+func TestPurgeBroadcast(t *testing.T) {
+	peer := NewAggregator(StaticPeers(nil), time.Second, nil)
+	peer.Wrap(stubPayments{})
+	peer.local.Process(payment("p", 0, "default"))
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != LocalPurgePath {
+			// O resumo da conferência dos totais, que não interessa aqui
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		calls++
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var filter domain.PurgeFilter
+		if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		peer.PurgeLocal(filter)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	a := NewAggregator(StaticPeers{srv.URL}, time.Second, http.Header{"X-Token": {"secret"}})
+	payments := a.Wrap(stubPayments{})
+	payments.Process(payment("a", 0, "default"))
+
+	payments.Purge(domain.PurgeFilter{DryRun: true})
+	if calls != 0 {
+		t.Fatal("dry run reached the peers")
+	}
+	if _, err := payments.Purge(domain.PurgeFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("peer calls = %d, want 1", calls)
+	}
+	for name, agg := range map[string]*Aggregator{"local": a, "peer": peer} {
+		if n := agg.Local(time.Time{}, base.Add(time.Hour)).Default.TotalRequests; n != 0 {
+			t.Errorf("%s totals after purge = %d", name, n)
+		}
+	}
+}
+
+// TestSeedAlone: sem peers, a instância assume o que já está no repositório.
+func TestSeedAlone(t *testing.T) {
+	stored := []domain.Payment{payment("a", 0, "default"), payment("b", time.Second, "fallback")}
+	a := NewAggregator(StaticPeers(nil), time.Second, nil)
+	a.Wrap(memPayments{payments: &stored})
+	if a.Summary(time.Time{}, time.Time{}).Consistent {
+		t.Error("consistent before Seed")
+	}
+	if err := a.Seed(); err != nil {
+		t.Fatal(err)
+	}
+	s := a.Summary(time.Time{}, base.Add(time.Hour))
+	if !s.Consistent || s.Default.TotalRequests != 1 || s.Fallback.TotalRequests != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+}
+
+// TestSeedRestart: uma instância que reinicia com peers não sabe quais
+// pagamentos eram seus. O resumo fica inconsistente, nela e no peer, até um
+// purge igualar o cluster ao repositório.
+func TestSeedRestart(t *testing.T) {
+	var stored []domain.Payment
+	repo := memPayments{payments: &stored}
+	survivor := NewAggregator(StaticPeers(nil), time.Second, nil)
+	survivorRepo := survivor.Wrap(repo)
+	survivorURL := servePeer(t, survivor)
+	if err := survivor.Seed(); err != nil {
+		t.Fatal(err)
+	}
+	survivorRepo.Process(payment("a", 0, "default"))
+	// Gravado pela instância que caiu: está no repositório, em nenhum total
+	repo.Process(payment("b", time.Second, "default"))
+
+	restarted := NewAggregator(StaticPeers{survivorURL}, time.Second, nil)
+	restarted.Wrap(repo)
+	survivor.discovery = StaticPeers{servePeer(t, restarted)}
+	if err := restarted.Seed(); err != nil {
+		t.Fatal(err)
+	}
+	if restarted.Seeded() {
+		t.Fatal("seeded with the crashed instance's payments missing")
+	}
+	for name, agg := range map[string]*Aggregator{"restarted": restarted, "survivor": survivor} {
+		if s := agg.Summary(time.Time{}, base.Add(time.Hour)); s.Consistent || s.Default.TotalRequests != 1 {
+			t.Errorf("%s: summary = %+v, want 1 payment flagged inconsistent", name, s)
+		}
+	}
+
+	restarted.Wrap(repo).Purge(domain.PurgeFilter{})
+	if !restarted.Seeded() {
+		t.Fatal("not seeded after a purge emptied the cluster")
+	}
+	for name, agg := range map[string]*Aggregator{"restarted": restarted, "survivor": survivor} {
+		if s := agg.Summary(time.Time{}, base.Add(time.Hour)); !s.Consistent || s.Default.TotalRequests != 0 {
+			t.Errorf("%s: after purge = %+v", name, s)
+		}
+	}
+}
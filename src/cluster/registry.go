@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	instancesKey = "summary:instances"
+	instanceTTL  = 5 * time.Second
+)
+
+// NewRedisRegistry anuncia self no Redis e descobre os outros peers pelo
+// mesmo sorted set, com o horário do último heartbeat como score.
+func NewRedisRegistry(client *redis.Client, self string) *RedisRegistry {
+	return &RedisRegistry{client: client, self: self, stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+type RedisRegistry struct {
+	client *redis.Client
+	self   string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func (r *RedisRegistry) Start() {
+	go func() {
+		defer close(r.done)
+		heartbeat := time.NewTicker(time.Second)
+		defer heartbeat.Stop()
+		for {
+			ctx := context.Background()
+			now := time.Now()
+			if err := r.client.ZAdd(ctx, instancesKey, redis.Z{Score: float64(now.Unix()), Member: r.self}).Err(); err != nil {
+				log.Println("Erro ao registrar instância:", err)
+			}
+			r.client.ZRemRangeByScore(ctx, instancesKey, "-inf", strconv.FormatInt(now.Add(-instanceTTL).Unix(), 10))
+			select {
+			case <-r.stop:
+				return
+			case <-heartbeat.C:
+			}
+		}
+	}()
+}
+
+// Stop para o heartbeat e tira a instância do registro na hora, em vez de
+// os peers a consultarem até o TTL vencer.
+func (r *RedisRegistry) Stop() {
+	close(r.stop)
+	<-r.done
+	if err := r.client.ZRem(context.Background(), instancesKey, r.self).Err(); err != nil {
+		log.Println("Erro ao remover instância do registro:", err)
+	}
+}
+
+func (r *RedisRegistry) Peers() ([]string, error) {
+	min := strconv.FormatInt(time.Now().Add(-instanceTTL).Unix(), 10)
+	members, err := r.client.ZRangeByScore(context.Background(), instancesKey, &redis.ZRangeBy{Min: min, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	peers := members[:0]
+	for _, m := range members {
+		if m != r.self {
+			peers = append(peers, m)
+		}
+	}
+	return peers, nil
+}
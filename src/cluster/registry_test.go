@@ -0,0 +1,40 @@
+package cluster
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// TestRegistryStop: depois do Stop a instância some dos peers na hora.
+func TestRegistryStop(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	a, b := NewRedisRegistry(client, "http://a"), NewRedisRegistry(client, "http://b")
+	a.Start()
+	b.Start()
+	defer b.Stop()
+	// O primeiro heartbeat sai no Start; espera o de a chegar
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		peers, err := b.Peers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.Equal(peers, []string{"http://a"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("peers = %v, want a", peers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.Stop()
+	if peers, _ := b.Peers(); len(peers) != 0 {
+		t.Errorf("peers after Stop = %v", peers)
+	}
+}
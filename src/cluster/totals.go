@@ -0,0 +1,146 @@
+package cluster
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+// bucket são os pagamentos de um segundo com a soma já feita.
+type bucket struct {
+	summary  domain.PaymentSummary
+	payments []domain.Payment
+}
+
+// totals guarda os pagamentos desta instância em baldes de um segundo: o
+// resumo soma os baldes inteiros do intervalo e só percorre os pagamentos
+// dos dois das pontas, em vez de todos.
+type totals struct {
+	mu      sync.Mutex
+	seconds []int64 // chaves de buckets, em ordem
+	buckets map[int64]*bucket
+	archive []domain.Payment
+}
+
+func newTotals() *totals {
+	return &totals{buckets: make(map[int64]*bucket)}
+}
+
+func add(summary *domain.PaymentSummary, p domain.Payment) {
+	item := &summary.Default
+	if p.Processor == "fallback" {
+		item = &summary.Fallback
+	}
+	item.TotalAmount += p.Amount
+	item.TotalRequests++
+}
+
+func (t *totals) Process(p domain.Payment) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.insert(p)
+}
+
+func (t *totals) insert(p domain.Payment) {
+	sec := p.RequestedAt.Unix()
+	b, ok := t.buckets[sec]
+	if !ok {
+		b = &bucket{}
+		t.buckets[sec] = b
+		// Quase sempre o segundo mais novo: o Insert vira um append
+		i, _ := slices.BinarySearch(t.seconds, sec)
+		t.seconds = slices.Insert(t.seconds, i, sec)
+	}
+	b.payments = append(b.payments, p)
+	add(&b.summary, p)
+}
+
+// span devolve o trecho de seconds entre from e to (zero é sem limite).
+func (t *totals) span(from, to time.Time) []int64 {
+	lo, hi := 0, len(t.seconds)
+	if !from.IsZero() {
+		lo, _ = slices.BinarySearch(t.seconds, from.Unix())
+	}
+	if !to.IsZero() {
+		hi, _ = slices.BinarySearch(t.seconds, to.Unix()+1)
+	}
+	return t.seconds[lo:max(lo, hi)]
+}
+
+func (t *totals) Summary(from, to time.Time) domain.PaymentSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var summary domain.PaymentSummary
+	for _, sec := range t.span(from, to) {
+		b := t.buckets[sec]
+		if sec != from.Unix() && sec != to.Unix() {
+			summary.Default.TotalAmount += b.summary.Default.TotalAmount
+			summary.Default.TotalRequests += b.summary.Default.TotalRequests
+			summary.Fallback.TotalAmount += b.summary.Fallback.TotalAmount
+			summary.Fallback.TotalRequests += b.summary.Fallback.TotalRequests
+			continue
+		}
+		for _, p := range b.payments {
+			if !p.RequestedAt.Before(from) && !p.RequestedAt.After(to) {
+				add(&summary, p)
+			}
+		}
+	}
+	return summary
+}
+
+// Purge tira os pagamentos que batem com filter, guardando-os no arquivo
+// com filter.Archive. O dry-run não mexe em nada.
+func (t *totals) Purge(filter domain.PurgeFilter) {
+	if filter.DryRun {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var emptied []int64
+	for _, sec := range t.span(filter.From, filter.To) {
+		b := t.buckets[sec]
+		kept := b.payments[:0]
+		var summary domain.PaymentSummary
+		for _, p := range b.payments {
+			if !filter.Matches(p) {
+				kept = append(kept, p)
+				add(&summary, p)
+			} else if filter.Archive {
+				t.archive = append(t.archive, p)
+			}
+		}
+		// Soma de novo em vez de subtrair, para não acumular erro de ponto flutuante
+		b.payments, b.summary = kept, summary
+		if len(kept) == 0 {
+			emptied = append(emptied, sec)
+		}
+	}
+	for _, sec := range emptied {
+		delete(t.buckets, sec)
+	}
+	t.seconds = slices.DeleteFunc(t.seconds, func(sec int64) bool {
+		_, ok := t.buckets[sec]
+		return !ok
+	})
+}
+
+// Restore devolve do arquivo os pagamentos que batem com filter.
+func (t *totals) Restore(filter domain.PurgeFilter) {
+	if filter.DryRun {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	kept := t.archive[:0]
+	for _, p := range t.archive {
+		if filter.Matches(p) {
+			t.insert(p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	t.archive = kept
+}
@@ -0,0 +1,212 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+var (
+	requestBody = []byte(`{"correlationId":"4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3","amount":19.9,"requestedAt":"2025-07-15T12:34:56.000Z"}`)
+	paymentBody = []byte(`{"correlationId":"4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3","amount":19.9,"requestedAt":"2025-07-15T12:34:56.123Z","processor":"default"}`)
+)
+
+var seeds = []string{
+	string(requestBody),
+	string(paymentBody),
+	`{}`,
+	`null`,
+	` { "AMOUNT" : 1e2 , "correlationid" : "x" } `,
+	`{"amount":"19.90"}`,
+	`{"amount":null,"correlationId":null}`,
+	`{"correlationId":"aé😀\n"}`,
+	`{"extra":[1,{"a":[true,false,null]},"s"],"amount":1}`,
+	`{"amount":1e400}`,
+	`{"amount":-0.0}`,
+	`{"correlationId":"\ud800"}`,
+	`{"requestedAt":"2025-07-15T12:34:56Z","processor":"fallback"}`,
+	`{"requestedAt":"not a time"}`,
+	`{"amount":1,}`,
+	`{"amount":01}`,
+	`[` + strings.Repeat("[", 100) + `]`,
+}
+
+// FuzzDecodePaymentRequest compara com json.Unmarshal: os dois aceitam ou
+// rejeitam a mesma entrada e, aceitando, produzem o mesmo valor.
+func FuzzDecodePaymentRequest(f *testing.F) {
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var got, want domain.PaymentRequest
+		err := DecodePaymentRequest(data, &got, false)
+		wantErr := json.Unmarshal(data, &want)
+		if (err == nil) != (wantErr == nil) {
+			t.Fatalf("DecodePaymentRequest(%q) error = %v, json.Unmarshal error = %v", data, err, wantErr)
+		}
+		if err == nil && got != want {
+			t.Fatalf("DecodePaymentRequest(%q) = %+v, json.Unmarshal = %+v", data, got, want)
+		}
+	})
+}
+
+func FuzzDecodePayment(f *testing.F) {
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var got, want domain.Payment
+		err := DecodePayment(data, &got, false)
+		wantErr := json.Unmarshal(data, &want)
+		if (err == nil) != (wantErr == nil) {
+			t.Fatalf("DecodePayment(%q) error = %v, json.Unmarshal error = %v", data, err, wantErr)
+		}
+		if err == nil && (got.CorrelationID != want.CorrelationID || got.Amount != want.Amount ||
+			got.Processor != want.Processor || !got.RequestedAt.Equal(want.RequestedAt)) {
+			t.Fatalf("DecodePayment(%q) = %+v, json.Unmarshal = %+v", data, got, want)
+		}
+	})
+}
+
+// FuzzAppendPaymentRequest confere que o encoder produz os mesmos bytes que
+// json.Marshal.
+func FuzzAppendPaymentRequest(f *testing.F) {
+	f.Add("4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3", 19.9, "2025-07-15T12:34:56.000Z")
+	f.Add("<&> \x00\xff", 1e21, "")
+	f.Add("", 1e-7, "\"\\")
+	f.Fuzz(func(t *testing.T, id string, amount float64, requestedAt string) {
+		req := domain.PaymentRequest{CorrelationID: id, Amount: amount, RequestedAt: requestedAt}
+		got, err := AppendPaymentRequest(nil, req)
+		want, wantErr := json.Marshal(req)
+		if (err == nil) != (wantErr == nil) {
+			t.Fatalf("AppendPaymentRequest(%+v) error = %v, json.Marshal error = %v", req, err, wantErr)
+		}
+		if err == nil && !bytes.Equal(got, want) {
+			t.Fatalf("AppendPaymentRequest(%+v) = %s, json.Marshal = %s", req, got, want)
+		}
+	})
+}
+
+func TestDecodeStrict(t *testing.T) {
+	var req domain.PaymentRequest
+	err := DecodePaymentRequest([]byte(`{"amount":1,"foo":2}`), &req, true)
+	var unknown *UnknownFieldError
+	if !errors.As(err, &unknown) || unknown.Field != "foo" {
+		t.Fatalf("err = %v, want UnknownFieldError for foo", err)
+	}
+	if req.Amount != 1 {
+		t.Fatalf("amount = %v, want 1", req.Amount)
+	}
+}
+
+func TestDecodeMaxDepth(t *testing.T) {
+	for _, tc := range []struct {
+		depth int
+		want  error
+	}{
+		{maxDepth - 1, nil},
+		{maxDepth, ErrMaxDepth},
+		{2_000_000, ErrMaxDepth},
+	} {
+		data := []byte(`{"x":` + strings.Repeat("[", tc.depth) + strings.Repeat("]", tc.depth) + `}`)
+		var p domain.Payment
+		if err := DecodePayment(data, &p, false); !errors.Is(err, tc.want) {
+			t.Errorf("depth %d: err = %v, want %v", tc.depth, err, tc.want)
+		}
+	}
+}
+
+func BenchmarkDecodePaymentRequest(b *testing.B) {
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var req domain.PaymentRequest
+			if err := DecodePaymentRequest(requestBody, &req, true); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var req domain.PaymentRequest
+			dec := json.NewDecoder(bytes.NewReader(requestBody))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecodePayment(b *testing.B) {
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var p domain.Payment
+			if err := DecodePayment(paymentBody, &p, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var p domain.Payment
+			if err := json.Unmarshal(paymentBody, &p); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkAppendPaymentRequest(b *testing.B) {
+	req := domain.PaymentRequest{CorrelationID: "4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3", Amount: 19.9, RequestedAt: "2025-07-15T12:34:56.000Z"}
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := GetBuffer()
+			var err error
+			if *buf, err = AppendPaymentRequest(*buf, req); err != nil {
+				b.Fatal(err)
+			}
+			PutBuffer(buf)
+		}
+	})
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := json.Marshal(req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkAppendPayment(b *testing.B) {
+	p := domain.Payment{CorrelationID: "4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3", Amount: 19.9, RequestedAt: time.Date(2025, 7, 15, 12, 34, 56, 123e6, time.UTC), Processor: "default"}
+	b.Run("codec", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := GetBuffer()
+			var err error
+			if *buf, err = AppendPayment(*buf, p); err != nil {
+				b.Fatal(err)
+			}
+			PutBuffer(buf)
+		}
+	})
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := json.Marshal(p); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,495 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+var ErrSyntax = errors.New("codec: invalid JSON")
+
+// ErrMaxDepth é devolvido para valores aninhados além de maxDepth níveis.
+var ErrMaxDepth = errors.New("codec: exceeded max depth")
+
+// maxDepth é o mesmo limite do encoding/json; sem ele um corpo como
+// "[[[[..." de poucos MB estoura a pilha na recursão de skipValue.
+const maxDepth = 10000
+
+type UnknownFieldError struct {
+	Field string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("codec: unknown field %q", e.Field)
+}
+
+type FieldTypeError struct {
+	Field string
+	Type  string
+}
+
+func (e *FieldTypeError) Error() string {
+	return fmt.Sprintf("codec: field %q must be of type %s", e.Field, e.Type)
+}
+
+// DecodePaymentRequest decodifica data em req com a mesma semântica de
+// json.Unmarshal: chaves sem diferenciar maiúsculas, null não altera o campo e
+// erros de tipo não interrompem o restante do objeto. Com strict, campos
+// desconhecidos viram UnknownFieldError, como em Decoder.DisallowUnknownFields.
+func DecodePaymentRequest(data []byte, req *domain.PaymentRequest, strict bool) error {
+	d := decoder{data: data, strict: strict}
+	return d.decode(func(key []byte) {
+		switch {
+		case matchKey(key, "correlationId"):
+			d.stringField("correlationId", &req.CorrelationID)
+		case matchKey(key, "amount"):
+			d.floatField("amount", &req.Amount)
+		case matchKey(key, "requestedAt"):
+			d.stringField("requestedAt", &req.RequestedAt)
+		default:
+			d.unknownField(key)
+		}
+	})
+}
+
+func DecodePayment(data []byte, p *domain.Payment, strict bool) error {
+	d := decoder{data: data, strict: strict}
+	return d.decode(func(key []byte) {
+		switch {
+		case matchKey(key, "correlationId"):
+			d.stringField("correlationId", &p.CorrelationID)
+		case matchKey(key, "amount"):
+			d.floatField("amount", &p.Amount)
+		case matchKey(key, "requestedAt"):
+			start := d.pos
+			if !d.skipValue() {
+				d.syntax = true
+			} else if d.fieldErr == nil {
+				if err := p.RequestedAt.UnmarshalJSON(d.data[start:d.pos]); err != nil {
+					d.fieldErr = err
+				}
+			}
+		case matchKey(key, "processor"):
+			d.stringField("processor", &p.Processor)
+		default:
+			d.unknownField(key)
+		}
+	})
+}
+
+func matchKey(key []byte, name string) bool {
+	return string(key) == name || bytes.EqualFold(key, []byte(name))
+}
+
+type decoder struct {
+	data     []byte
+	pos      int
+	strict   bool
+	syntax   bool
+	depth    int
+	tooDeep  bool
+	fieldErr error
+	scratch  []byte
+}
+
+// decode percorre um único objeto JSON chamando field para cada chave, com o
+// cursor posicionado no início do valor. field deve consumir o valor.
+func (d *decoder) decode(field func(key []byte)) error {
+	d.skipSpace()
+	if d.peek() == 'n' {
+		// null no topo não altera o destino
+		if d.literal("null") {
+			d.skipSpace()
+			if d.pos == len(d.data) {
+				return nil
+			}
+		}
+		return ErrSyntax
+	}
+	if !d.consume('{') {
+		return ErrSyntax
+	}
+	d.depth = 1
+	d.skipSpace()
+	if !d.consume('}') {
+		for {
+			d.skipSpace()
+			key, ok := d.string()
+			if !ok {
+				return ErrSyntax
+			}
+			d.skipSpace()
+			if !d.consume(':') {
+				return ErrSyntax
+			}
+			d.skipSpace()
+			field(key)
+			if d.tooDeep {
+				return ErrMaxDepth
+			}
+			if d.syntax {
+				return ErrSyntax
+			}
+			d.skipSpace()
+			if d.consume(',') {
+				continue
+			}
+			if d.consume('}') {
+				break
+			}
+			return ErrSyntax
+		}
+	}
+	d.skipSpace()
+	if d.pos != len(d.data) {
+		return ErrSyntax
+	}
+	return d.fieldErr
+}
+
+func (d *decoder) stringField(name string, dst *string) {
+	switch d.peek() {
+	case '"':
+		s, ok := d.string()
+		if !ok {
+			d.syntax = true
+			return
+		}
+		*dst = string(s)
+	case 'n':
+		d.literal("null")
+	default:
+		d.typeError(name, "string")
+	}
+}
+
+func (d *decoder) floatField(name string, dst *float64) {
+	switch c := d.peek(); {
+	case c == '-' || '0' <= c && c <= '9':
+		num, ok := d.number()
+		if !ok {
+			d.syntax = true
+			return
+		}
+		f, err := strconv.ParseFloat(string(num), 64)
+		if err != nil {
+			d.setFieldErr(&FieldTypeError{name, "number"})
+			return
+		}
+		*dst = f
+	case c == 'n':
+		d.literal("null")
+	default:
+		d.typeError(name, "number")
+	}
+}
+
+func (d *decoder) unknownField(key []byte) {
+	if d.strict {
+		d.setFieldErr(&UnknownFieldError{string(key)})
+	}
+	if !d.skipValue() {
+		d.syntax = true
+	}
+}
+
+func (d *decoder) typeError(name, typ string) {
+	d.setFieldErr(&FieldTypeError{name, typ})
+	if !d.skipValue() {
+		d.syntax = true
+	}
+}
+
+func (d *decoder) setFieldErr(err error) {
+	if d.fieldErr == nil {
+		d.fieldErr = err
+	}
+}
+
+func (d *decoder) peek() byte {
+	if d.pos < len(d.data) {
+		return d.data[d.pos]
+	}
+	return 0
+}
+
+func (d *decoder) consume(c byte) bool {
+	if d.pos < len(d.data) && d.data[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *decoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *decoder) literal(lit string) bool {
+	if len(d.data)-d.pos < len(lit) || string(d.data[d.pos:d.pos+len(lit)]) != lit {
+		d.syntax = true
+		return false
+	}
+	d.pos += len(lit)
+	return true
+}
+
+// number valida a gramática de número do JSON, que é mais restrita que a
+// aceita por strconv.ParseFloat.
+func (d *decoder) number() ([]byte, bool) {
+	start := d.pos
+	d.consume('-')
+	switch c := d.peek(); {
+	case c == '0':
+		d.pos++
+	case '1' <= c && c <= '9':
+		d.digits()
+	default:
+		return nil, false
+	}
+	if d.consume('.') {
+		if d.digits() == 0 {
+			return nil, false
+		}
+	}
+	if c := d.peek(); c == 'e' || c == 'E' {
+		d.pos++
+		if c := d.peek(); c == '+' || c == '-' {
+			d.pos++
+		}
+		if d.digits() == 0 {
+			return nil, false
+		}
+	}
+	return d.data[start:d.pos], true
+}
+
+func (d *decoder) digits() int {
+	start := d.pos
+	for d.pos < len(d.data) && '0' <= d.data[d.pos] && d.data[d.pos] <= '9' {
+		d.pos++
+	}
+	return d.pos - start
+}
+
+// string lê uma string JSON e devolve seu conteúdo. Sem escapes e com UTF-8
+// válido o retorno aponta para data; caso contrário é montado em scratch.
+func (d *decoder) string() ([]byte, bool) {
+	if !d.consume('"') {
+		return nil, false
+	}
+	start := d.pos
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return d.data[start : d.pos-1], true
+		case c == '\\':
+			return d.slowString(start)
+		case c < 0x20:
+			return nil, false
+		case c < utf8.RuneSelf:
+			d.pos++
+		default:
+			r, size := utf8.DecodeRune(d.data[d.pos:])
+			if r == utf8.RuneError && size == 1 {
+				return d.slowString(start)
+			}
+			d.pos += size
+		}
+	}
+	return nil, false
+}
+
+func (d *decoder) slowString(start int) ([]byte, bool) {
+	buf := append(d.scratch[:0], d.data[start:d.pos]...)
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			d.scratch = buf
+			return buf, true
+		case c == '\\':
+			d.pos++
+			switch e := d.peek(); e {
+			case '"', '\\', '/':
+				buf = append(buf, e)
+				d.pos++
+			case 'b':
+				buf = append(buf, '\b')
+				d.pos++
+			case 'f':
+				buf = append(buf, '\f')
+				d.pos++
+			case 'n':
+				buf = append(buf, '\n')
+				d.pos++
+			case 'r':
+				buf = append(buf, '\r')
+				d.pos++
+			case 't':
+				buf = append(buf, '\t')
+				d.pos++
+			case 'u':
+				d.pos++
+				r := d.hex4()
+				if r < 0 {
+					return nil, false
+				}
+				if utf16.IsSurrogate(r) {
+					// Igual ao encoding/json: par inválido vira U+FFFD e o
+					// segundo escape é lido de novo como caractere próprio.
+					if d.peek() == '\\' && d.pos+1 < len(d.data) && d.data[d.pos+1] == 'u' {
+						save := d.pos
+						d.pos += 2
+						r1 := d.hex4()
+						if dec := utf16.DecodeRune(r, r1); r1 >= 0 && dec != unicode.ReplacementChar {
+							buf = utf8.AppendRune(buf, dec)
+							continue
+						}
+						d.pos = save
+					}
+					r = unicode.ReplacementChar
+				}
+				buf = utf8.AppendRune(buf, r)
+			default:
+				return nil, false
+			}
+		case c < 0x20:
+			return nil, false
+		case c < utf8.RuneSelf:
+			buf = append(buf, c)
+			d.pos++
+		default:
+			r, size := utf8.DecodeRune(d.data[d.pos:])
+			if r == utf8.RuneError && size == 1 {
+				buf = utf8.AppendRune(buf, unicode.ReplacementChar)
+			} else {
+				buf = append(buf, d.data[d.pos:d.pos+size]...)
+			}
+			d.pos += size
+		}
+	}
+	return nil, false
+}
+
+func (d *decoder) hex4() rune {
+	if len(d.data)-d.pos < 4 {
+		return -1
+	}
+	var r rune
+	for _, c := range d.data[d.pos : d.pos+4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c = c - '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return -1
+		}
+		r = r*16 + rune(c)
+	}
+	d.pos += 4
+	return r
+}
+
+// nest entra num array ou objeto; false além de maxDepth níveis, contando o
+// objeto do topo.
+func (d *decoder) nest() bool {
+	d.depth++
+	if d.depth > maxDepth {
+		d.tooDeep = true
+		return false
+	}
+	return true
+}
+
+func (d *decoder) unnest() {
+	d.depth--
+}
+
+// skipValue consome qualquer valor JSON, validando a sintaxe.
+func (d *decoder) skipValue() bool {
+	switch c := d.peek(); {
+	case c == '"':
+		_, ok := d.string()
+		return ok
+	case c == '-' || '0' <= c && c <= '9':
+		_, ok := d.number()
+		return ok
+	case c == 't':
+		return d.literal("true")
+	case c == 'f':
+		return d.literal("false")
+	case c == 'n':
+		return d.literal("null")
+	case c == '[':
+		if !d.nest() {
+			return false
+		}
+		defer d.unnest()
+		d.pos++
+		d.skipSpace()
+		if d.consume(']') {
+			return true
+		}
+		for {
+			d.skipSpace()
+			if !d.skipValue() {
+				return false
+			}
+			d.skipSpace()
+			if d.consume(',') {
+				continue
+			}
+			return d.consume(']')
+		}
+	case c == '{':
+		if !d.nest() {
+			return false
+		}
+		defer d.unnest()
+		d.pos++
+		d.skipSpace()
+		if d.consume('}') {
+			return true
+		}
+		for {
+			d.skipSpace()
+			if _, ok := d.string(); !ok {
+				return false
+			}
+			d.skipSpace()
+			if !d.consume(':') {
+				return false
+			}
+			d.skipSpace()
+			if !d.skipValue() {
+				return false
+			}
+			d.skipSpace()
+			if d.consume(',') {
+				continue
+			}
+			return d.consume('}')
+		}
+	}
+	return false
+}
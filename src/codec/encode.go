@@ -0,0 +1,146 @@
+package codec
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+var ErrUnsupportedValue = errors.New("codec: unsupported value")
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 256)
+		return &b
+	},
+}
+
+func GetBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+func PutBuffer(b *[]byte) {
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// AppendPaymentRequest produz exatamente os mesmos bytes que json.Marshal.
+func AppendPaymentRequest(dst []byte, req domain.PaymentRequest) ([]byte, error) {
+	dst = append(dst, `{"correlationId":`...)
+	dst = appendString(dst, req.CorrelationID)
+	dst = append(dst, `,"amount":`...)
+	dst, err := appendFloat(dst, req.Amount)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"requestedAt":`...)
+	dst = appendString(dst, req.RequestedAt)
+	return append(dst, '}'), nil
+}
+
+func AppendPayment(dst []byte, p domain.Payment) ([]byte, error) {
+	dst = append(dst, `{"correlationId":`...)
+	dst = appendString(dst, p.CorrelationID)
+	dst = append(dst, `,"amount":`...)
+	dst, err := appendFloat(dst, p.Amount)
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"requestedAt":`...)
+	if dst, err = appendTime(dst, p.RequestedAt); err != nil {
+		return dst, err
+	}
+	dst = append(dst, `,"processor":`...)
+	dst = appendString(dst, p.Processor)
+	return append(dst, '}'), nil
+}
+
+func appendTime(dst []byte, t time.Time) ([]byte, error) {
+	if y := t.Year(); y < 0 || y > 9999 {
+		return dst, ErrUnsupportedValue
+	}
+	dst = append(dst, '"')
+	dst = t.AppendFormat(dst, time.RFC3339Nano)
+	return append(dst, '"'), nil
+}
+
+// appendFloat segue as regras de formatação de float64 do encoding/json.
+func appendFloat(dst []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return dst, ErrUnsupportedValue
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// e-09 vira e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
+
+const hex = "0123456789abcdef"
+
+// appendString escapa como o encoding/json com escapeHTML: <, >, &, U+2028 e
+// U+2029 viram \u.... e UTF-8 inválido vira U+FFFD.
+func appendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
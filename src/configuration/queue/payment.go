@@ -1,9 +0,0 @@
-package queue
-
-import (
-	"github.com/alexsandroveiga/rdb25/src/domain"
-)
-
-var (
-	Queue chan domain.PaymentRequest
-)
@@ -34,3 +34,24 @@ func (s *InMemoryStorage) Get(key string) []any {
 	defer s.mu.RUnlock()
 	return append([]any(nil), s.data[key]...)
 }
+
+func (s *InMemoryStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+}
+
+// Update aplica fn às listas guardadas em keys sob o mesmo lock, para mover
+// itens entre elas sem que um leitor veja o meio do caminho.
+func (s *InMemoryStorage) Update(fn func(lists map[string][]any), keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lists := make(map[string][]any, len(keys))
+	for _, k := range keys {
+		lists[k] = s.data[k]
+	}
+	fn(lists)
+	for _, k := range keys {
+		s.data[k] = lists[k]
+	}
+}
@@ -15,11 +15,34 @@ type PaymentRequest struct {
 	RequestedAt   string  `json:"requestedAt"`
 }
 
+// RequestedAtLayout é o formato do requestedAt enviado aos processors.
+const RequestedAtLayout = "2006-01-02T15:04:05.999Z"
+
+// Stamp carimba o requestedAt na primeira chamada e devolve o mesmo instante
+// nas seguintes, para que retentativas, processor e repositório vejam um só
+// valor. O instante é truncado em milissegundos, a precisão que vai no JSON.
+func (r *PaymentRequest) Stamp(now time.Time) time.Time {
+	if at, err := time.Parse(time.RFC3339Nano, r.RequestedAt); err == nil {
+		return at
+	}
+	now = now.UTC().Truncate(time.Millisecond)
+	r.RequestedAt = now.Format(RequestedAtLayout)
+	return now
+}
+
 type PaymentSummary struct {
 	Default  SummaryItem `json:"default"`
 	Fallback SummaryItem `json:"fallback"`
 }
 
+// ClusterSummary é o resumo somado entre instâncias. Consistent fica false
+// quando algum peer não respondeu e o total pode estar incompleto.
+type ClusterSummary struct {
+	PaymentSummary
+	Consistent  bool     `json:"consistent"`
+	Unreachable []string `json:"unreachable,omitempty"`
+}
+
 type SummaryItem struct {
 	TotalAmount   float64 `json:"totalAmount"`
 	TotalRequests int     `json:"totalRequests"`
@@ -29,3 +52,20 @@ type HealthResponse struct {
 	Failing         bool `json:"failing"`
 	MinResponseTime int  `json:"minResponseTime"`
 }
+
+type ReconciliationReport struct {
+	From     time.Time   `json:"from"`
+	To       time.Time   `json:"to"`
+	Pending  int         `json:"pending"`
+	Default  Discrepancy `json:"default"`
+	Fallback Discrepancy `json:"fallback"`
+}
+
+type Discrepancy struct {
+	Local        SummaryItem `json:"local"`
+	Processor    SummaryItem `json:"processor"`
+	AmountDiff   float64     `json:"amountDiff"`
+	RequestsDiff int         `json:"requestsDiff"`
+	Consistent   bool        `json:"consistent"`
+	Error        string      `json:"error,omitempty"`
+}
@@ -0,0 +1,47 @@
+package domain
+
+import "time"
+
+// PaymentFilter seleciona pagamentos por intervalo de requestedAt e por
+// processor. Campos zerados não filtram: o zero value pega tudo.
+type PaymentFilter struct {
+	From      time.Time
+	To        time.Time
+	Processor string
+}
+
+// PurgeFilter limita purge e restore aos pagamentos de PaymentFilter.
+type PurgeFilter struct {
+	PaymentFilter
+	DryRun bool
+	// Archive move os pagamentos para o arquivo em vez de apagá-los, para que
+	// possam voltar com Restore.
+	Archive bool
+}
+
+func (f PaymentFilter) Matches(p Payment) bool {
+	if !f.From.IsZero() && p.RequestedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && p.RequestedAt.After(f.To) {
+		return false
+	}
+	return f.Processor == "" || f.Processor == p.Processor
+}
+
+// PurgeResult traz o total por processor do que foi (ou, no dry-run, seria)
+// removido ou restaurado.
+type PurgeResult struct {
+	PaymentSummary
+	DryRun   bool `json:"dryRun"`
+	Archived bool `json:"archived"`
+}
+
+func (r *PurgeResult) Add(p Payment) {
+	item := &r.Default
+	if p.Processor == "fallback" {
+		item = &r.Fallback
+	}
+	item.TotalAmount += p.Amount
+	item.TotalRequests++
+}
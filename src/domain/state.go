@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+type PaymentState string
+
+const (
+	StatePending   PaymentState = "pending"
+	StateInFlight  PaymentState = "in_flight"
+	StateRetrying  PaymentState = "retrying"
+	StateUnknown   PaymentState = "unknown"
+	StateFailed    PaymentState = "failed"
+	StateCompleted PaymentState = "completed"
+)
+
+var ErrInvalidTransition = errors.New("invalid payment state transition")
+
+// transitions lista, para cada estado, os estados seguintes permitidos.
+// Failed e Completed são finais. O pending é gravado depois da admissão e
+// sem esperar, então o worker pode chegar antes dele.
+var transitions = map[PaymentState][]PaymentState{
+	"":             {StatePending, StateInFlight},
+	StatePending:   {StateInFlight, StateFailed},
+	StateInFlight:  {StateCompleted, StateRetrying, StateUnknown, StateFailed},
+	StateRetrying:  {StateInFlight, StateFailed},
+	StateUnknown:   {StateCompleted, StateRetrying, StateFailed},
+	StateFailed:    {},
+	StateCompleted: {},
+}
+
+func (s PaymentState) CanTransition(to PaymentState) bool {
+	return slices.Contains(transitions[s], to)
+}
+
+// Sources devolve os estados a partir dos quais se pode chegar em s.
+func (s PaymentState) Sources() []PaymentState {
+	var sources []PaymentState
+	for from, next := range transitions {
+		if slices.Contains(next, s) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
+
+type StateTransition struct {
+	From      PaymentState `json:"from,omitempty"`
+	To        PaymentState `json:"to"`
+	Processor string       `json:"processor,omitempty"`
+	At        time.Time    `json:"at"`
+}
+
+type PaymentStatus struct {
+	CorrelationID string            `json:"correlationId"`
+	State         PaymentState      `json:"state"`
+	Processor     string            `json:"processor,omitempty"`
+	Attempts      int               `json:"attempts"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+	History       []StateTransition `json:"history"`
+}
+
+func (s *PaymentStatus) Transition(to PaymentState, processor string, at time.Time) error {
+	if !s.State.CanTransition(to) {
+		return ErrInvalidTransition
+	}
+	if s.State == "" {
+		s.CreatedAt = at
+	}
+	if to == StateInFlight {
+		s.Attempts++
+	}
+	if processor != "" {
+		s.Processor = processor
+	}
+	s.History = append(s.History, StateTransition{From: s.State, To: to, Processor: processor, At: at})
+	s.State = to
+	s.UpdatedAt = at
+	return nil
+}
@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+// SummaryReport é o /payments-summary com os extras pedidos na query string.
+// Sem extras serializa igual a PaymentSummary.
+type SummaryReport struct {
+	Default       ProcessorSummary `json:"default"`
+	Fallback      ProcessorSummary `json:"fallback"`
+	FallbackRatio *float64         `json:"fallbackRatio,omitempty"`
+	Buckets       []SummaryBucket  `json:"buckets,omitempty"`
+}
+
+type ProcessorSummary struct {
+	SummaryItem
+	*SummaryDetail
+}
+
+// SummaryDetail são os números por processor que só vêm com details=true.
+// As retentativas vêm do estado de cada pagamento, que expira 24h depois da
+// última mudança: RetriesUnknown conta os pagamentos sem estado, cujas
+// retentativas não entram em Retries.
+type SummaryDetail struct {
+	FeeAmount      float64 `json:"feeAmount"`
+	NetAmount      float64 `json:"netAmount"`
+	AverageAmount  float64 `json:"averageAmount"`
+	MinAmount      float64 `json:"minAmount"`
+	MaxAmount      float64 `json:"maxAmount"`
+	P50Amount      float64 `json:"p50Amount"`
+	P90Amount      float64 `json:"p90Amount"`
+	P99Amount      float64 `json:"p99Amount"`
+	Retries        int     `json:"retries"`
+	RetriesUnknown int     `json:"retriesUnknown,omitempty"`
+}
+
+type SummaryBucket struct {
+	Start time.Time `json:"start"`
+	PaymentSummary
+}
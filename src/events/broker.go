@@ -0,0 +1,311 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Payment = "payment"
+	Health  = "health"
+	Summary = "summary"
+)
+
+// relayEpoch é a época dos IDs com relay: as versões vêm do Redis e valem em
+// todas as instâncias, então um Last-Event-ID de uma serve na outra.
+const relayEpoch = "r"
+
+// Event é uma mensagem já serializada para o stream. Version ordena os
+// eventos que alteram os totais: um snapshot tirado na versão V já contém
+// todos os de versão até V. O ID carrega a época do broker, então um
+// Last-Event-ID de antes de um restart nunca casa com o histórico local.
+// Eventos só desta instância (health) têm Version zero e ID vazio: não
+// entram no histórico.
+type Event struct {
+	ID      string
+	Type    string
+	Data    []byte
+	Version uint64
+}
+
+// NewBroker cria o broker; com relay os eventos que alteram os totais passam
+// pelo Redis e chegam a todas as instâncias.
+func NewBroker(history int, relay *RedisRelay) *Broker {
+	b := &Broker{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		relay:   relay,
+		history: make([]Event, 0, history),
+		size:    history,
+		subs:    make(map[chan Event]struct{}),
+	}
+	if relay != nil {
+		b.epoch = relayEpoch
+		b.broken = true
+	}
+	return b
+}
+
+// Broker distribui os eventos para os streams abertos e guarda os últimos
+// para quem reconectar com Last-Event-ID. Sem relay as versões são uma
+// sequência local; com relay vêm do Redis.
+//
+// Sem nenhum stream aberto (nesta instância ou, com relay, em qualquer uma)
+// os eventos não são nem serializados. Por isso o histórico só vale enquanto
+// há streams: quando o último fecha, ele é descartado.
+type Broker struct {
+	mu      sync.Mutex
+	epoch   string
+	relay   *RedisRelay
+	seq     uint64 // versão do último evento entregue
+	floor   uint64 // o histórico cobre as versões de floor+1 a seq
+	broken  bool   // com relay: histórico interrompido, recomeça no continuity
+	history []Event
+	size    int
+	subs    map[chan Event]struct{}
+	closed  bool
+}
+
+// Start liga o relay, se houver.
+func (b *Broker) Start() error {
+	if b.relay == nil {
+		return nil
+	}
+	return b.relay.start(b)
+}
+
+// Publish publica um evento que altera os totais.
+func (b *Broker) Publish(kind string, v any) {
+	if !b.listening() {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if b.relay != nil {
+		// Volta pelo receive, com a versão global
+		b.relay.send(b, kind, data)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.deliver(b.seq+1, kind, data)
+	}
+}
+
+// PublishLocal entrega um evento só aos streams desta instância, sem versão
+// e fora do histórico.
+func (b *Broker) PublishLocal(kind string, v any) {
+	if !b.hasSubscribers() {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fanOut(Event{Type: kind, Data: data})
+}
+
+func (b *Broker) listening() bool {
+	if b.relay != nil && b.relay.active.Load() {
+		return true
+	}
+	return b.hasSubscribers()
+}
+
+func (b *Broker) hasSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs) > 0
+}
+
+// receive recebe do relay um evento de qualquer instância.
+func (b *Broker) receive(version uint64, kind string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	if len(b.subs) == 0 {
+		// Sem streams aqui o histórico já está descartado (forget)
+		b.seq = version
+		return
+	}
+	if version != b.seq+1 {
+		// Mensagens perdidas no pub/sub ou contador reiniciado no Redis: o
+		// histórico não serve mais para retomar
+		b.broken = true
+	}
+	b.continuity()
+	b.deliver(version, kind, data)
+}
+
+// interrupt marca o histórico como interrompido (reconexão do relay).
+func (b *Broker) interrupt() {
+	b.mu.Lock()
+	b.broken = true
+	b.mu.Unlock()
+}
+
+// continuity recomeça o histórico depois de uma interrupção, assim que as
+// outras instâncias já publicam para esta.
+func (b *Broker) continuity() {
+	if b.broken && b.relay.ready() {
+		b.broken = false
+		b.floor = b.seq
+		b.history = b.history[:0]
+	}
+}
+
+func (b *Broker) deliver(version uint64, kind string, data []byte) {
+	b.seq = version
+	e := Event{ID: fmt.Sprintf("%s-%d", b.epoch, version), Type: kind, Data: data, Version: version}
+	if len(b.history) == b.size {
+		b.floor = b.history[0].Version
+		copy(b.history, b.history[1:])
+		b.history = b.history[:b.size-1]
+	}
+	b.history = append(b.history, e)
+	b.fanOut(e)
+}
+
+func (b *Broker) fanOut(e Event) {
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// Assinante lento: fecha e deixa o cliente retomar pelo Last-Event-ID
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscription é um stream registrado no broker.
+type Subscription struct {
+	// Events é fechado no Close do broker ou se o cliente ficar para trás.
+	Events chan Event
+	// Replay traz o que veio depois do Last-Event-ID, quando Resumed.
+	Replay  []Event
+	Resumed bool
+}
+
+// Subscribe registra um novo stream. Sem Resumed o lastID é desconhecido ou
+// velho demais e o cliente precisa de um snapshot (Wait e Version).
+func (b *Broker) Subscribe(lastID string) Subscription {
+	b.mu.Lock()
+	s := Subscription{Events: make(chan Event, 256)}
+	if b.closed {
+		b.mu.Unlock()
+		close(s.Events)
+		return s
+	}
+	b.subs[s.Events] = struct{}{}
+	if b.relay != nil {
+		b.continuity()
+	}
+	if seq, ok := b.parseID(lastID); ok && !b.broken {
+		s.Resumed = seq >= b.floor && seq <= b.seq
+		for _, e := range b.history {
+			if s.Resumed && e.Version > seq {
+				s.Replay = append(s.Replay, e)
+			}
+		}
+	}
+	b.mu.Unlock()
+	if b.relay != nil {
+		b.relay.listen(b.hasSubscribers)
+	}
+	return s
+}
+
+func (b *Broker) Unsubscribe(events chan Event) {
+	b.mu.Lock()
+	if _, ok := b.subs[events]; ok {
+		delete(b.subs, events)
+		close(events)
+	}
+	b.forget()
+	b.mu.Unlock()
+	if b.relay != nil {
+		b.relay.listen(b.hasSubscribers)
+	}
+}
+
+// forget descarta o histórico quando não há mais streams: daqui em diante
+// os eventos nem são publicados, e retomar dele perderia pagamentos.
+func (b *Broker) forget() {
+	if len(b.subs) > 0 {
+		return
+	}
+	if b.relay != nil {
+		b.broken = true
+		return
+	}
+	b.seq++
+	b.floor = b.seq
+	b.history = b.history[:0]
+}
+
+// Wait espera até os eventos de todas as instâncias chegarem a esta, para o
+// snapshot não perder os que outras gravarem logo depois dele.
+func (b *Broker) Wait() {
+	if b.relay != nil {
+		b.relay.wait()
+	}
+}
+
+// Version devolve a versão do último evento publicado e o ID para um
+// snapshot tirado a partir de agora: eventos até essa versão já estão nele.
+func (b *Broker) Version() (uint64, string, error) {
+	var version uint64
+	if b.relay != nil {
+		var err error
+		if version, err = b.relay.version(); err != nil {
+			return 0, "", err
+		}
+	} else {
+		b.mu.Lock()
+		version = b.seq
+		b.mu.Unlock()
+	}
+	return version, fmt.Sprintf("%s-%d", b.epoch, version), nil
+}
+
+// Dropped conta os eventos descartados com a fila do relay cheia.
+func (b *Broker) Dropped() uint64 {
+	if b.relay == nil {
+		return 0
+	}
+	return b.relay.dropped.Load()
+}
+
+// Close encerra todos os streams, para o Shutdown não esperar por eles.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+	if b.relay != nil {
+		b.relay.close()
+	}
+}
+
+func (b *Broker) parseID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
@@ -0,0 +1,142 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func next(t *testing.T, events chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("nenhum evento")
+		return Event{}
+	}
+}
+
+func TestBrokerLocal(t *testing.T) {
+	b := NewBroker(2, nil)
+	b.Publish(Payment, 1) // ninguém ouvindo: descartado
+	sub := b.Subscribe("")
+	if sub.Resumed {
+		t.Fatal("resumed without Last-Event-ID")
+	}
+	version, _, _ := b.Version()
+	for i := 0; i < 3; i++ {
+		b.Publish(Payment, i)
+	}
+	var last Event
+	for i := 0; i < 3; i++ {
+		if last = next(t, sub.Events); last.Version <= version {
+			t.Fatalf("version %d not after snapshot %d", last.Version, version)
+		}
+	}
+	b.PublishLocal(Health, "up")
+	if e := next(t, sub.Events); e.ID != "" || e.Version != 0 {
+		t.Errorf("health event = %+v, want no id", e)
+	}
+
+	// Só os dois últimos ficam no histórico
+	again := b.Subscribe(last.ID)
+	if !again.Resumed || len(again.Replay) != 0 {
+		t.Errorf("resume from last: %+v", again)
+	}
+	if old := b.Subscribe(b.epoch + "-0"); old.Resumed {
+		t.Error("resumed from an event out of the history")
+	}
+	if other := b.Subscribe("x-1"); other.Resumed {
+		t.Error("resumed from another epoch")
+	}
+	b.Close()
+	if _, ok := <-sub.Events; ok {
+		t.Error("events open after Close")
+	}
+}
+
+func TestBrokerForgetsWithoutSubscribers(t *testing.T) {
+	b := NewBroker(16, nil)
+	sub := b.Subscribe("")
+	b.Publish(Payment, 1)
+	id := next(t, sub.Events).ID
+	b.Unsubscribe(sub.Events)
+	b.Publish(Payment, 2) // perdido: ninguém ouvindo
+	if again := b.Subscribe(id); again.Resumed {
+		t.Error("resumed across a gap with no subscribers")
+	}
+}
+
+// TestRedisRelay liga dois brokers ao mesmo Redis, como duas instâncias.
+func TestRedisRelay(t *testing.T) {
+	mr := miniredis.RunT(t)
+	brokers := make([]*Broker, 2)
+	for i := range brokers {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		brokers[i] = NewBroker(16, NewRedisRelay(client))
+		if err := brokers[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(brokers[i].Close)
+	}
+	a, b := brokers[0], brokers[1]
+
+	sub := b.Subscribe("")
+	b.Wait()
+	version, id, err := b.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != relayEpoch+"-0" {
+		t.Errorf("id = %q", id)
+	}
+	// A outra instância já sabe que há alguém ouvindo
+	if !a.listening() {
+		t.Fatal("publisher not listening after Wait")
+	}
+	a.Publish(Payment, "x")
+	a.Publish(Payment, "y")
+	first, second := next(t, sub.Events), next(t, sub.Events)
+	if first.Version != version+1 || second.Version != version+2 || string(second.Data) != `"y"` {
+		t.Errorf("events = %+v, %+v", first, second)
+	}
+
+	// Last-Event-ID vale em qualquer instância com histórico contínuo
+	a.Publish(Payment, "z")
+	next(t, sub.Events)
+	if again := b.Subscribe(second.ID); !again.Resumed || len(again.Replay) != 1 {
+		t.Errorf("resume = %+v", again)
+	}
+}
+
+// TestRelayDrop: com a fila do relay cheia o Publish não bloqueia; o evento é
+// descartado, contado e o histórico deixa de servir para retomar.
+func TestRelayDrop(t *testing.T) {
+	relay := &RedisRelay{out: make(chan outgoing, 1), stop: make(chan struct{})}
+	relay.active.Store(true)
+	b := NewBroker(16, relay)
+	b.broken = false
+
+	done := make(chan struct{})
+	go func() {
+		for range 3 {
+			b.Publish(Payment, "x")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full relay")
+	}
+	if got := b.Dropped(); got != 2 {
+		t.Errorf("dropped = %d, want 2", got)
+	}
+	if !b.broken {
+		t.Error("history not interrupted after a drop")
+	}
+}
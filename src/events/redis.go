@@ -0,0 +1,252 @@
+package events
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisChannel = "events"
+	// listenerChannel não transporta nada: as instâncias com streams abertos
+	// ficam inscritas nele e o PUBSUB NUMSUB diz se alguém está ouvindo.
+	listenerChannel = "events:listeners"
+	versionKey      = "events:version"
+	relayPoll       = 500 * time.Millisecond
+	relayBatch      = 128
+)
+
+// publishScript numera e publica o evento de uma vez: a ordem das versões é
+// a ordem em que as instâncias recebem as mensagens.
+var publishScript = redis.NewScript(`
+local v = redis.call('INCR', KEYS[1])
+redis.call('PUBLISH', ARGV[1], v .. '\t' .. ARGV[2] .. '\t' .. ARGV[3])
+return v`)
+
+type outgoing struct {
+	kind string
+	data []byte
+}
+
+// NewRedisRelay cria o relay que leva os eventos de uma instância para os
+// streams de todas, pelo pub/sub do Redis.
+func NewRedisRelay(client *redis.Client) *RedisRelay {
+	return &RedisRelay{
+		client: client,
+		out:    make(chan outgoing, 4096),
+		stop:   make(chan struct{}),
+	}
+}
+
+// RedisRelay publica sem bloquear quem grava o pagamento: os eventos vão em
+// pipeline, em lotes, por uma goroutine só. Com a fila cheia o evento é
+// descartado e contado, e o histórico do broker passa a valer como
+// interrompido.
+type RedisRelay struct {
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	out     chan outgoing
+	dropped atomic.Uint64
+	// active diz se alguma instância tem stream aberto; sem ninguém, o
+	// Publish nem serializa.
+	active atomic.Bool
+
+	mu        sync.Mutex
+	listening bool
+	// readyAt é quando todas as instâncias já viram esta ouvindo (dois polls)
+	readyAt atomic.Int64
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func (r *RedisRelay) start(b *Broker) error {
+	ctx := context.Background()
+	r.mu.Lock()
+	r.pubsub = r.client.Subscribe(ctx, redisChannel)
+	r.mu.Unlock()
+	if _, err := r.pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	r.wg.Add(3)
+	go r.receive(b)
+	go r.run()
+	go r.poll()
+	return nil
+}
+
+func (r *RedisRelay) receive(b *Broker) {
+	defer r.wg.Done()
+	for {
+		msg, err := r.pubsub.Receive(context.Background())
+		if err != nil {
+			select {
+			case <-r.stop:
+				return
+			default:
+			}
+			log.Println("Erro no relay de eventos:", err)
+			b.interrupt()
+			time.Sleep(time.Second)
+			continue
+		}
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			// Reinscrição depois de uma reconexão: o que foi publicado no meio se perdeu
+			if m.Channel == redisChannel && m.Kind == "subscribe" {
+				b.interrupt()
+			}
+		case *redis.Message:
+			if m.Channel != redisChannel {
+				continue
+			}
+			version, rest, _ := strings.Cut(m.Payload, "\t")
+			kind, data, ok := strings.Cut(rest, "\t")
+			v, err := strconv.ParseUint(version, 10, 64)
+			if !ok || err != nil {
+				continue
+			}
+			b.receive(v, kind, []byte(data))
+		}
+	}
+}
+
+func (r *RedisRelay) run() {
+	defer r.wg.Done()
+	batch := make([]outgoing, 0, relayBatch)
+	for {
+		select {
+		case m := <-r.out:
+			batch = append(batch[:0], m)
+		fill:
+			for len(batch) < relayBatch {
+				select {
+				case m := <-r.out:
+					batch = append(batch, m)
+				default:
+					break fill
+				}
+			}
+			r.flush(batch)
+		case <-r.stop:
+			for {
+				select {
+				case m := <-r.out:
+					r.flush([]outgoing{m})
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *RedisRelay) flush(batch []outgoing) {
+	ctx := context.Background()
+	pipe := r.client.Pipeline()
+	for _, m := range batch {
+		publishScript.Eval(ctx, pipe, []string{versionKey}, redisChannel, m.kind, m.data)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠ %d eventos não publicados: %v", len(batch), err)
+	}
+}
+
+func (r *RedisRelay) poll() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(relayPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		counts, err := r.client.PubSubNumSub(context.Background(), listenerChannel).Result()
+		if err != nil {
+			// Na dúvida publica: perder evento é pior que serializar à toa
+			r.active.Store(true)
+			continue
+		}
+		r.active.Store(counts[listenerChannel] > 0)
+	}
+}
+
+// listen inscreve ou tira esta instância do listenerChannel conforme ela
+// tenha streams abertos.
+func (r *RedisRelay) listen(on func() bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	want := on()
+	if want == r.listening || r.pubsub == nil {
+		return
+	}
+	ctx := context.Background()
+	var err error
+	if want {
+		err = r.pubsub.Subscribe(ctx, listenerChannel)
+		r.active.Store(true)
+		r.readyAt.Store(time.Now().Add(2 * relayPoll).UnixNano())
+	} else {
+		err = r.pubsub.Unsubscribe(ctx, listenerChannel)
+		r.readyAt.Store(0)
+	}
+	if err != nil {
+		log.Println("Erro ao anunciar streams de eventos:", err)
+	}
+	r.listening = want
+}
+
+// ready diz se as outras instâncias já publicam para esta.
+func (r *RedisRelay) ready() bool {
+	at := r.readyAt.Load()
+	return at != 0 && time.Now().UnixNano() >= at
+}
+
+func (r *RedisRelay) wait() {
+	if at := r.readyAt.Load(); at != 0 {
+		time.Sleep(time.Until(time.Unix(0, at)))
+	}
+}
+
+func (r *RedisRelay) version() (uint64, error) {
+	v, err := r.client.Get(context.Background(), versionKey).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+func (r *RedisRelay) send(b *Broker, kind string, data []byte) {
+	select {
+	case r.out <- outgoing{kind, data}:
+	case <-r.stop:
+	default:
+		// Redis lento: quem grava o pagamento não espera, mas os streams não
+		// podem retomar por cima do buraco
+		if r.dropped.Add(1) == 1 {
+			log.Println("⚠ Fila do relay de eventos cheia, descartando eventos")
+		}
+		b.interrupt()
+	}
+}
+
+func (r *RedisRelay) close() {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		r.mu.Lock()
+		pubsub := r.pubsub
+		r.mu.Unlock()
+		if pubsub != nil {
+			pubsub.Close()
+		}
+		r.wg.Wait()
+	})
+}
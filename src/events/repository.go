@@ -0,0 +1,46 @@
+package events
+
+import (
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+const (
+	Purge   = "purge"
+	Restore = "restore"
+)
+
+// Wrap publica em b cada pagamento gravado e cada purge/restore efetivado
+// em payments.
+func Wrap(b *Broker, payments repository.RedisPaymentRepository) repository.RedisPaymentRepository {
+	return &publishingRepository{payments, b}
+}
+
+type publishingRepository struct {
+	repository.RedisPaymentRepository
+	broker *Broker
+}
+
+func (r *publishingRepository) Process(p domain.Payment) error {
+	if err := r.RedisPaymentRepository.Process(p); err != nil {
+		return err
+	}
+	r.broker.Publish(Payment, p)
+	return nil
+}
+
+func (r *publishingRepository) Purge(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	result, err := r.RedisPaymentRepository.Purge(filter)
+	if err == nil && !filter.DryRun {
+		r.broker.Publish(Purge, result)
+	}
+	return result, err
+}
+
+func (r *publishingRepository) Restore(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	result, err := r.RedisPaymentRepository.Restore(filter)
+	if err == nil && !filter.DryRun {
+		r.broker.Publish(Restore, result)
+	}
+	return result, err
+}
@@ -3,6 +3,7 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/alexsandroveiga/rdb25/src/domain"
@@ -30,10 +31,26 @@ func (pm *paymentMessaging) Produce(ctx context.Context, p domain.PaymentRequest
 	return pm.client.RPush(ctx, "payment_queue", data).Err()
 }
 
+// consumeWait é quanto cada BLPOP bloqueia. O go-redis não interrompe um
+// comando bloqueante quando ctx é cancelado, então o Consume bloqueia em
+// fatias e confere ctx entre elas.
+const consumeWait = time.Second
+
 func (m *paymentMessaging) Consume(ctx context.Context) (domain.PaymentRequest, error) {
-	res, err := m.client.BLPop(ctx, 0*time.Second, "payment_queue").Result()
-	if err != nil {
-		return domain.PaymentRequest{}, err
+	var res []string
+	for {
+		var err error
+		res, err = m.client.BLPop(ctx, consumeWait, "payment_queue").Result()
+		if errors.Is(err, redis.Nil) {
+			if ctx.Err() != nil {
+				return domain.PaymentRequest{}, ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return domain.PaymentRequest{}, err
+		}
+		break
 	}
 
 	var p domain.PaymentRequest
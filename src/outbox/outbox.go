@@ -0,0 +1,296 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/codec"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+// New prepara o outbox com o log em path e o offset aplicado em
+// path+".offset"; os arquivos só são abertos no Start. apply grava um
+// pagamento no repositório e precisa ser idempotente, porque depois de uma
+// queda o último registro pode ser aplicado de novo.
+func New(path string, apply func(domain.Payment) error) *Outbox {
+	o := &Outbox{
+		path:    path,
+		apply:   apply,
+		wake:    make(chan struct{}, 1),
+		drained: make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	o.synced = sync.NewCond(&o.mu)
+	return o
+}
+
+// Outbox é um log local de pagamentos já cobrados. Append só retorna depois
+// do fsync, mas os Appends concorrentes dividem o mesmo fsync (group commit):
+// quem chega enquanto um fsync está em andamento espera o próximo, que cobre
+// todos de uma vez. Um worker sozinho ainda paga um fsync inteiro por
+// pagamento; com vários workers o custo se divide entre eles. Um único applier leva os registros, em ordem e com retentativas,
+// para o repositório. Assim uma falha do Redis depois da cobrança atrasa o
+// registro em vez de perdê-lo.
+//
+// O arquivo é de um processo só: o offset e a compactação supõem um único
+// escritor, por isso o servidor desliga o prefork quando o outbox está ligado.
+type Outbox struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	offsets *os.File
+	size    int64 // bytes no log
+	applied int64 // bytes já aplicados no repositório
+	// written conta os Appends e flushed até qual deles já passou por um
+	// fsync; syncing diz se há um fsync em andamento.
+	written uint64
+	flushed uint64
+	syncing bool
+	synced  *sync.Cond
+	drained chan struct{}
+	apply   func(domain.Payment) error
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// recover descarta um registro cortado no fim do log (queda no meio de um
+// Append) e lê o offset já aplicado.
+func (o *Outbox) recover() error {
+	data, err := io.ReadAll(io.NewSectionReader(o.file, 0, 1<<62))
+	if err != nil {
+		return err
+	}
+	o.size = int64(bytes.LastIndexByte(data, '\n') + 1)
+	if o.size != int64(len(data)) {
+		log.Printf("⚠ Outbox: descartando %d bytes de um registro incompleto", int64(len(data))-o.size)
+		if err := o.file.Truncate(o.size); err != nil {
+			return err
+		}
+	}
+	var buf [8]byte
+	if _, err := o.offsets.ReadAt(buf[:], 0); err == nil {
+		o.applied = min(int64(binary.LittleEndian.Uint64(buf[:])), o.size)
+	}
+	if o.applied == o.size {
+		close(o.drained)
+	}
+	return nil
+}
+
+func (o *Outbox) Append(p domain.Payment) error {
+	buf := codec.GetBuffer()
+	defer codec.PutBuffer(buf)
+	var err error
+	if *buf, err = codec.AppendPayment((*buf)[:0], p); err != nil {
+		return err
+	}
+	*buf = append(*buf, '\n')
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := o.file.Write(*buf); err != nil {
+		return err
+	}
+	// size anda antes do fsync: com mu solto durante o fsync, o applier e a
+	// compactação precisam ver o log como ele está no arquivo
+	select {
+	case <-o.drained:
+		o.drained = make(chan struct{})
+	default:
+	}
+	o.size += int64(len(*buf))
+	o.written++
+	if err := o.sync(o.written); err != nil {
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// sync espera um fsync que cubra o Append seq, fazendo ele mesmo o fsync se
+// ninguém estiver fazendo. Chamado com mu travado; solta mu durante o fsync.
+func (o *Outbox) sync(seq uint64) error {
+	for o.flushed < seq {
+		if o.syncing {
+			o.synced.Wait()
+			continue
+		}
+		o.syncing = true
+		target := o.written
+		o.mu.Unlock()
+		err := o.file.Sync()
+		o.mu.Lock()
+		o.syncing = false
+		o.synced.Broadcast()
+		if err != nil {
+			return err
+		}
+		o.flushed = max(o.flushed, target)
+	}
+	return nil
+}
+
+// Start abre o log, retoma o que ficou pendente e sobe o applier.
+func (o *Outbox) Start() error {
+	file, err := os.OpenFile(o.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	offsets, err := os.OpenFile(o.path+".offset", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	o.file, o.offsets = file, offsets
+	if err := o.recover(); err != nil {
+		file.Close()
+		offsets.Close()
+		return err
+	}
+	if pending := o.size - o.applied; pending > 0 {
+		log.Printf("♻ Outbox: retomando %d bytes pendentes de %s", pending, o.path)
+	}
+	go o.run()
+	return nil
+}
+
+// Stop para o applier e fecha os arquivos. O que não foi aplicado fica no
+// log para o próximo Open.
+func (o *Outbox) Stop() {
+	close(o.stop)
+	<-o.done
+	o.file.Close()
+	o.offsets.Close()
+}
+
+// Wait espera o log ser todo aplicado ou o timeout. Retorna false se ainda
+// restarem registros.
+func (o *Outbox) Wait(timeout time.Duration) bool {
+	o.mu.Lock()
+	drained := o.drained
+	o.mu.Unlock()
+	select {
+	case <-drained:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Pending é quantos bytes do log ainda não chegaram ao repositório.
+func (o *Outbox) Pending() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size - o.applied
+}
+
+func (o *Outbox) run() {
+	defer close(o.done)
+	for {
+		o.mu.Lock()
+		from, to := o.applied, o.size
+		o.mu.Unlock()
+		if from < to && !o.applyRange(from, to) {
+			return
+		}
+		o.compact()
+		select {
+		case <-o.stop:
+			return
+		case <-o.wake:
+		}
+	}
+}
+
+// applyRange aplica os registros entre from e to. Retorna false no Stop.
+func (o *Outbox) applyRange(from, to int64) bool {
+	r := bufio.NewReader(io.NewSectionReader(o.file, from, to-from))
+	offset := from
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return true
+		}
+		if err != nil {
+			log.Println("❌ Outbox: erro lendo o log:", err)
+			return true
+		}
+		var p domain.Payment
+		if err := codec.DecodePayment(line, &p, false); err != nil {
+			log.Printf("❌ Outbox: registro inválido em %d ignorado: %v", offset, err)
+		} else if !o.applyWithRetry(p) {
+			return false
+		}
+		offset += int64(len(line))
+		o.mu.Lock()
+		o.applied = offset
+		o.mu.Unlock()
+		o.saveOffset(offset)
+	}
+}
+
+func (o *Outbox) applyWithRetry(p domain.Payment) bool {
+	backoff := minBackoff
+	for {
+		err := o.apply(p)
+		if err == nil {
+			return true
+		}
+		log.Printf("⚠ Outbox: %s não gravado, nova tentativa em %s: %v", p.CorrelationID, backoff, err)
+		select {
+		case <-o.stop:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// saveOffset não faz fsync: se o offset se perder numa queda, os registros
+// são só aplicados de novo.
+func (o *Outbox) saveOffset(offset int64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(offset))
+	if _, err := o.offsets.WriteAt(buf[:], 0); err != nil {
+		log.Println("⚠ Outbox: offset não salvo:", err)
+	}
+}
+
+// compact zera o log quando tudo já foi aplicado, para ele não crescer sem fim.
+func (o *Outbox) compact() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.applied != o.size {
+		return
+	}
+	if o.size > 0 {
+		if err := o.file.Truncate(0); err != nil {
+			log.Println("⚠ Outbox: não foi possível compactar o log:", err)
+			return
+		}
+		o.size, o.applied = 0, 0
+		o.saveOffset(0)
+	}
+	select {
+	case <-o.drained:
+	default:
+		close(o.drained)
+	}
+}
@@ -0,0 +1,204 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+// recorder é o repositório do applier: guarda os ids aplicados, em ordem, e
+// falha enquanto fail disser que sim.
+type recorder struct {
+	mu      sync.Mutex
+	applied []string
+	calls   int
+	fail    func(p domain.Payment, calls int) bool
+}
+
+func (r *recorder) apply(p domain.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.fail != nil && r.fail(p, r.calls) {
+		return errors.New("repositório fora")
+	}
+	r.applied = append(r.applied, p.CorrelationID)
+	return nil
+}
+
+func (r *recorder) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.applied)
+}
+
+func (r *recorder) attempts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+func start(t *testing.T, path string, r *recorder) *Outbox {
+	t.Helper()
+	o := New(path, r.apply)
+	if err := o.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func payment(id string) domain.Payment {
+	return domain.Payment{CorrelationID: id, Amount: 10, RequestedAt: time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC), Processor: "default"}
+}
+
+func size(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+// TestRestart: o applier para no meio com o repositório fora e o processo cai
+// no meio de um Append. Reaberto, o outbox descarta o registro cortado, retoma
+// do offset e aplica cada pagamento uma vez, em ordem.
+func TestRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	first := &recorder{fail: func(p domain.Payment, _ int) bool { return p.CorrelationID == "b" }}
+	o := start(t, path, first)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := o.Append(payment(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for first.attempts() < 2 || len(first.ids()) < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("applied %v before the failure", first.ids())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	o.Stop()
+
+	// Queda no meio de um Append: metade de um registro no fim do log
+	full := size(t, path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"correlationId":"d","amou`)
+	f.Close()
+
+	second := &recorder{}
+	o = start(t, path, second)
+	defer o.Stop()
+	if got := size(t, path); got > full {
+		t.Errorf("log has %d bytes after recover, want the torn record truncated (%d)", got, full)
+	}
+	if !o.Wait(time.Second) {
+		t.Fatalf("not drained, %d bytes pending", o.Pending())
+	}
+	all := append(first.ids(), second.ids()...)
+	if !slices.Equal(all, []string{"a", "b", "c"}) {
+		t.Errorf("applied %v then %v, want a, b and c once each", first.ids(), second.ids())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	r := &recorder{fail: func(_ domain.Payment, calls int) bool { return calls <= 2 }}
+	o := start(t, filepath.Join(t.TempDir(), "outbox.log"), r)
+	defer o.Stop()
+	began := time.Now()
+	if err := o.Append(payment("a")); err != nil {
+		t.Fatal(err)
+	}
+	if !o.Wait(5 * time.Second) {
+		t.Fatal("not applied after the repository came back")
+	}
+	if r.attempts() != 3 || !slices.Equal(r.ids(), []string{"a"}) {
+		t.Errorf("%d calls, applied %v; want 3 calls and a once", r.attempts(), r.ids())
+	}
+	// Duas falhas: espera minBackoff e depois o dobro
+	if elapsed := time.Since(began); elapsed < 3*minBackoff {
+		t.Errorf("applied after %v, want the %v backoff", elapsed, 3*minBackoff)
+	}
+}
+
+// TestCompaction: aplicado tudo, o log e o offset voltam a zero e o outbox
+// segue aceitando registros.
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	r := &recorder{}
+	o := start(t, path, r)
+	defer o.Stop()
+	for round := range 2 {
+		id := fmt.Sprint(round)
+		if err := o.Append(payment(id)); err != nil {
+			t.Fatal(err)
+		}
+		if !o.Wait(time.Second) {
+			t.Fatalf("round %d: not drained", round)
+		}
+		if got := size(t, path); got != 0 || o.Pending() != 0 {
+			t.Errorf("round %d: log has %d bytes, %d pending", round, got, o.Pending())
+		}
+		offset, _ := os.ReadFile(path + ".offset")
+		if !slices.Equal(offset, make([]byte, 8)) {
+			t.Errorf("round %d: offset %v, want 0", round, offset)
+		}
+	}
+	if !slices.Equal(r.ids(), []string{"0", "1"}) {
+		t.Errorf("applied %v", r.ids())
+	}
+}
+
+// TestConcurrentAppend: Appends concorrentes dividem os fsyncs e nenhum
+// registro se perde nem se repete.
+func TestConcurrentAppend(t *testing.T) {
+	r := &recorder{}
+	o := start(t, filepath.Join(t.TempDir(), "outbox.log"), r)
+	defer o.Stop()
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := o.Append(payment(fmt.Sprint(i))); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if !o.Wait(time.Second) {
+		t.Fatalf("not drained, %d bytes pending", o.Pending())
+	}
+	ids := r.ids()
+	slices.Sort(ids)
+	if distinct := len(slices.Compact(ids)); distinct != 50 || len(r.ids()) != 50 {
+		t.Errorf("applied %d payments (%d distinct), want 50", len(r.ids()), distinct)
+	}
+}
+
+func BenchmarkAppend(b *testing.B) {
+	o := New(filepath.Join(b.TempDir(), "outbox.log"), func(domain.Payment) error { return nil })
+	if err := o.Start(); err != nil {
+		b.Fatal(err)
+	}
+	defer o.Stop()
+	p := payment("a")
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := o.Append(p); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,21 @@
+package outbox
+
+import (
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+// Wrap faz o Process de payments passar pelo outbox: grava no log e retorna,
+// e o applier de o chama o Process original depois.
+func Wrap(o *Outbox, payments repository.RedisPaymentRepository) repository.RedisPaymentRepository {
+	return &outboxRepository{payments, o}
+}
+
+type outboxRepository struct {
+	repository.RedisPaymentRepository
+	outbox *Outbox
+}
+
+func (r *outboxRepository) Process(p domain.Payment) error {
+	return r.outbox.Append(p)
+}
@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/codec"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+const (
+	Default  = "default"
+	Fallback = "fallback"
+)
+
+type Outcome int
+
+const (
+	Failed Outcome = iota
+	Succeeded
+	// Unknown significa que a requisição pode ter chegado ao processor,
+	// mas não recebemos resposta (timeout, conexão resetada...).
+	Unknown
+)
+
+// DefaultTimeout vale quando PROCESSOR_TIMEOUT não está definido. Precisa ser
+// finito: sem timeout um processor lento nunca vira Unknown e a
+// reconciliação não entra em ação.
+const DefaultTimeout = 5 * time.Second
+
+func NewClient() *Client {
+	timeout, err := time.ParseDuration(os.Getenv("PROCESSOR_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	token := os.Getenv("PROCESSOR_TOKEN")
+	if token == "" {
+		token = "123"
+	}
+	return &Client{http: &http.Client{Timeout: timeout}, token: token}
+}
+
+type Client struct {
+	http  *http.Client
+	token string
+}
+
+// Timeout é quanto Send espera pela resposta antes de dar Unknown.
+func (c *Client) Timeout() time.Duration {
+	return c.http.Timeout
+}
+
+func URL(processor string) string {
+	return map[string]string{
+		Default:  os.Getenv("URL_PROCESSOR_DEFAULT"),
+		Fallback: os.Getenv("URL_PROCESSOR_FALLBACK"),
+	}[processor]
+}
+
+func (c *Client) Send(processor string, req domain.PaymentRequest) Outcome {
+	buf := codec.GetBuffer()
+	var err error
+	*buf, err = codec.AppendPaymentRequest(*buf, req)
+	// O corpo vai numa cópia: o transport pode continuar lendo depois que Do
+	// retorna (o processor pode responder antes de ler tudo), então buf não
+	// pode voltar ao pool enquanto a requisição estiver viva.
+	body := bytes.Clone(*buf)
+	codec.PutBuffer(buf)
+	if err != nil {
+		return Failed
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, URL(processor), bytes.NewReader(body))
+	if err != nil {
+		return Failed
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return Failed
+		}
+		return Unknown
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		log.Printf("🔴🔴🔴 ERRO 4XX => %d 🔴🔴🔴", resp.StatusCode)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return Succeeded
+	}
+	return Failed
+}
+
+// Lookup consulta GET /payments/{id} no processor. found=false quando o
+// processor responde 404, ou seja, o pagamento nunca foi aceito.
+func (c *Client) Lookup(processor, correlationID string) (p domain.Payment, found bool, err error) {
+	resp, err := c.http.Get(URL(processor) + "/" + url.PathEscape(correlationID))
+	if err != nil {
+		return p, false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return p, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return p, false, fmt.Errorf("lookup on %s returned %d", processor, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return p, false, err
+	}
+	p.Processor = processor
+	return p, true, nil
+}
+
+func (c *Client) Summary(processor string, from, to time.Time) (domain.SummaryItem, error) {
+	var item domain.SummaryItem
+	q := url.Values{}
+	q.Set("from", from.UTC().Format(time.RFC3339Nano))
+	q.Set("to", to.UTC().Format(time.RFC3339Nano))
+	base := strings.TrimSuffix(URL(processor), "/payments")
+	httpReq, err := http.NewRequest(http.MethodGet, base+"/admin/payments-summary?"+q.Encode(), nil)
+	if err != nil {
+		return item, err
+	}
+	httpReq.Header.Set("X-Rinha-Token", c.token)
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return item, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return item, fmt.Errorf("summary on %s returned %d", processor, resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&item)
+	return item, err
+}
@@ -0,0 +1,166 @@
+package reconciliation
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+// settleMargin soma ao timeout do processor o tempo que uma requisição
+// abandonada por nós ainda pode levar para ser aplicada do lado dele.
+const settleMargin = 2 * time.Second
+
+func NewReconciler(client *processor.Client, payments repository.RedisPaymentRepository, unknowns repository.ReconciliationRepository, statuses repository.StatusRepository, requeue func(domain.PaymentRequest) bool) *Reconciler {
+	return &Reconciler{
+		client:   client,
+		payments: payments,
+		unknowns: unknowns,
+		statuses: statuses,
+		requeue:  requeue,
+		minAge:   client.Timeout() + settleMargin,
+		done:     make(chan struct{}),
+	}
+}
+
+type Reconciler struct {
+	client   *processor.Client
+	payments repository.RedisPaymentRepository
+	unknowns repository.ReconciliationRepository
+	statuses repository.StatusRepository
+	requeue  func(domain.PaymentRequest) bool
+	// minAge é a idade mínima de uma marcação antes da consulta: antes disso
+	// o pagamento ainda pode estar em andamento no processor, e um 404 não
+	// quer dizer que ele nunca vai chegar.
+	minAge   time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func (r *Reconciler) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+			}
+			if err := r.Run(); err != nil {
+				log.Println("Erro na reconciliação:", err)
+			}
+		}
+	}()
+}
+
+func (r *Reconciler) Stop() {
+	r.stopOnce.Do(func() { close(r.done) })
+}
+
+// Run consulta cada processor pelos pagamentos com resultado desconhecido
+// marcados há pelo menos minAge. Encontrado em um deles, o pagamento é
+// gravado como concluído; não encontrado em nenhum, volta para a fila. Erros
+// de consulta deixam o pagamento pendente para a próxima rodada.
+//
+// Várias instâncias podem rodar ao mesmo tempo: cada entrada é tomada com
+// Claim e só quem a tomou reenfileira, então o pagamento não é cobrado duas
+// vezes.
+func (r *Reconciler) Run() error {
+	unknowns, err := r.unknowns.ListUnknown()
+	if err != nil {
+		return err
+	}
+	for _, u := range unknowns {
+		if time.Since(u.MarkedAt) < r.minAge {
+			continue
+		}
+		p, name, err := r.lookup(u.CorrelationID)
+		if err != nil {
+			continue
+		}
+		// Gravar de novo um pagamento encontrado é idempotente, então isso
+		// pode vir antes do Claim; o reenvio não.
+		if name != "" {
+			if err := r.payments.Process(p); err != nil {
+				return err
+			}
+		}
+		claimed, err := r.unknowns.Claim(u)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if name != "" {
+			log.Printf("✅ Reconciliado: %s no %s", u.CorrelationID, name)
+			r.track(u.CorrelationID, domain.StateCompleted, name)
+			continue
+		}
+		r.track(u.CorrelationID, domain.StateRetrying, "")
+		if !r.requeue(u.PaymentRequest) {
+			if err := r.unknowns.Release(u); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup procura o pagamento nos dois processors. name vazio sem erro quer
+// dizer que nenhum deles o conhece.
+func (r *Reconciler) lookup(correlationID string) (domain.Payment, string, error) {
+	var lookupErr error
+	for _, name := range []string{processor.Default, processor.Fallback} {
+		p, ok, err := r.client.Lookup(name, correlationID)
+		if err != nil {
+			lookupErr = err
+			continue
+		}
+		if ok {
+			return p, name, nil
+		}
+	}
+	return domain.Payment{}, "", lookupErr
+}
+
+func (r *Reconciler) track(correlationID string, to domain.PaymentState, processor string) {
+	if err := r.statuses.Transition(correlationID, to, processor); err != nil {
+		log.Printf("⚠ Estado de %s não registrado: %v", correlationID, err)
+	}
+}
+
+func (r *Reconciler) Report(from, to time.Time) (domain.ReconciliationReport, error) {
+	report := domain.ReconciliationReport{From: from, To: to}
+	local, err := r.payments.GetSummary(from, to)
+	if err != nil {
+		return report, err
+	}
+	pending, err := r.unknowns.ListUnknown()
+	if err != nil {
+		return report, err
+	}
+	report.Pending = len(pending)
+	report.Default = r.compare(processor.Default, local.Default, from, to)
+	report.Fallback = r.compare(processor.Fallback, local.Fallback, from, to)
+	return report, nil
+}
+
+func (r *Reconciler) compare(name string, local domain.SummaryItem, from, to time.Time) domain.Discrepancy {
+	d := domain.Discrepancy{Local: local}
+	remote, err := r.client.Summary(name, from, to)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	d.Processor = remote
+	d.AmountDiff = math.Round((remote.TotalAmount-local.TotalAmount)*100) / 100
+	d.RequestsDiff = remote.TotalRequests - local.TotalRequests
+	d.Consistent = d.AmountDiff == 0 && d.RequestsDiff == 0
+	return d
+}
@@ -0,0 +1,183 @@
+package reconciliation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// env é o Redis compartilhado e os dois processors; known são os pagamentos
+// que o default conhece.
+type env struct {
+	client   *redis.Client
+	known    map[string]domain.PaymentRequest
+	lookups  atomic.Int32
+	requeued atomic.Int32
+}
+
+func newEnv(t *testing.T) *env {
+	t.Helper()
+	e := &env{known: make(map[string]domain.PaymentRequest)}
+	mr := miniredis.RunT(t)
+	e.client = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { e.client.Close() })
+	for _, name := range []string{"DEFAULT", "FALLBACK"} {
+		known := e.known
+		if name == "FALLBACK" {
+			known = nil
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /payments/{id}", func(w http.ResponseWriter, r *http.Request) {
+			e.lookups.Add(1)
+			// Devagar o bastante para duas instâncias se sobreporem
+			time.Sleep(10 * time.Millisecond)
+			req, ok := known[r.PathValue("id")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(req)
+		})
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+		t.Setenv("URL_PROCESSOR_"+name, srv.URL+"/payments")
+	}
+	return e
+}
+
+// reconciler é uma instância; todas compartilham o Redis de e.
+func (e *env) reconciler(minAge time.Duration) (*Reconciler, repository.RedisPaymentRepository) {
+	payments := repository.NewRedisPaymentRepository(e.client)
+	r := NewReconciler(processor.NewClient(), payments, repository.NewRedisReconciliationRepository(e.client),
+		repository.NewRedisStatusRepository(e.client), func(domain.PaymentRequest) bool {
+			e.requeued.Add(1)
+			return true
+		})
+	r.minAge = minAge
+	return r, payments
+}
+
+func (e *env) mark(t *testing.T, id string) {
+	t.Helper()
+	statuses := repository.NewRedisStatusRepository(e.client)
+	statuses.Transition(id, domain.StateInFlight, "")
+	statuses.Transition(id, domain.StateUnknown, "")
+	if err := repository.NewRedisReconciliationRepository(e.client).MarkUnknown(domain.PaymentRequest{CorrelationID: id, Amount: 10}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (e *env) pending(t *testing.T) int {
+	t.Helper()
+	unknowns, err := repository.NewRedisReconciliationRepository(e.client).ListUnknown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(unknowns)
+}
+
+func TestRunFound(t *testing.T) {
+	e := newEnv(t)
+	e.known["a"] = domain.PaymentRequest{CorrelationID: "a", Amount: 10, RequestedAt: "2025-07-15T12:00:00.000Z"}
+	e.mark(t, "a")
+	r, payments := e.reconciler(0)
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := payments.GetSummary(time.Time{}, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if s.Default.TotalRequests != 1 || e.requeued.Load() != 0 || e.pending(t) != 0 {
+		t.Errorf("summary %+v, requeued %d, pending %d", s, e.requeued.Load(), e.pending(t))
+	}
+	status, _, _ := r.statuses.Get("a")
+	if status.State != domain.StateCompleted || status.Processor != processor.Default {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestRunNotFound(t *testing.T) {
+	e := newEnv(t)
+	e.mark(t, "a")
+	r, _ := e.reconciler(0)
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if e.requeued.Load() != 1 || e.pending(t) != 0 {
+		t.Errorf("requeued %d, pending %d", e.requeued.Load(), e.pending(t))
+	}
+	// Fila cheia: a entrada volta para a próxima rodada
+	e.mark(t, "b")
+	r.requeue = func(domain.PaymentRequest) bool { return false }
+	r.Run()
+	if e.pending(t) != 1 {
+		t.Errorf("pending after full queue = %d, want 1", e.pending(t))
+	}
+}
+
+// TestRunSkipsRecent: uma marcação recente pode estar em andamento no
+// processor, então nem é consultada.
+func TestRunSkipsRecent(t *testing.T) {
+	e := newEnv(t)
+	e.mark(t, "a")
+	r, _ := e.reconciler(time.Hour)
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if e.lookups.Load() != 0 || e.requeued.Load() != 0 || e.pending(t) != 1 {
+		t.Errorf("lookups %d, requeued %d, pending %d", e.lookups.Load(), e.requeued.Load(), e.pending(t))
+	}
+}
+
+// TestRunTwoInstances: duas instâncias lendo as mesmas entradas ao mesmo
+// tempo reenfileiram cada pagamento uma vez só.
+func TestRunTwoInstances(t *testing.T) {
+	e := newEnv(t)
+	for _, id := range []string{"a", "b", "c"} {
+		e.mark(t, id)
+	}
+	var wg sync.WaitGroup
+	for range 2 {
+		r, _ := e.reconciler(0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Run(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := e.requeued.Load(); n != 3 {
+		t.Errorf("requeued %d, want 3", n)
+	}
+}
+
+// TestClaimStale: uma entrada marcada de novo depois da leitura não é tomada
+// por quem leu a versão antiga.
+func TestClaimStale(t *testing.T) {
+	e := newEnv(t)
+	unknowns := repository.NewRedisReconciliationRepository(e.client)
+	e.mark(t, "a")
+	listed, _ := unknowns.ListUnknown()
+	time.Sleep(time.Millisecond)
+	e.mark(t, "a")
+	if claimed, err := unknowns.Claim(listed[0]); err != nil || claimed {
+		t.Fatalf("claimed a stale entry: %v, %v", claimed, err)
+	}
+	fresh, _ := unknowns.ListUnknown()
+	if claimed, _ := unknowns.Claim(fresh[0]); !claimed {
+		t.Fatal("fresh entry not claimed")
+	}
+	if claimed, _ := unknowns.Claim(fresh[0]); claimed {
+		t.Error("claimed twice")
+	}
+}
@@ -0,0 +1,623 @@
+package repository
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/codec"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+const (
+	FsyncAlways   = "always"   // fsync a cada escrita, antes de retornar
+	FsyncInterval = "interval" // fsync periódico, como o appendfsync everysec do Redis
+	FsyncNever    = "never"    // fica a cargo do sistema operacional
+)
+
+type FileConfig struct {
+	Dir              string
+	Fsync            string
+	FsyncInterval    time.Duration
+	SnapshotInterval time.Duration
+	// SegmentSize é o tamanho a partir do qual o log passa para um novo segmento.
+	SegmentSize int64
+}
+
+// FileConfigFromEnv lê STORAGE_DIR, STORAGE_FSYNC, STORAGE_FSYNC_INTERVAL,
+// STORAGE_SNAPSHOT_INTERVAL e STORAGE_SEGMENT_SIZE (em bytes).
+func FileConfigFromEnv() FileConfig {
+	config := FileConfig{
+		Dir:              os.Getenv("STORAGE_DIR"),
+		Fsync:            os.Getenv("STORAGE_FSYNC"),
+		FsyncInterval:    time.Second,
+		SnapshotInterval: time.Minute,
+		SegmentSize:      64 << 20,
+	}
+	if config.Dir == "" {
+		config.Dir = "data"
+	}
+	if config.Fsync == "" {
+		config.Fsync = FsyncInterval
+	}
+	if v, err := time.ParseDuration(os.Getenv("STORAGE_FSYNC_INTERVAL")); err == nil && v > 0 {
+		config.FsyncInterval = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("STORAGE_SNAPSHOT_INTERVAL")); err == nil && v > 0 {
+		config.SnapshotInterval = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("STORAGE_SEGMENT_SIZE"), 10, 64); err == nil && v > 0 {
+		config.SegmentSize = v
+	}
+	return config
+}
+
+// ErrClosed é devolvido por escritas depois do Close.
+var ErrClosed = errors.New("storage closed")
+
+// aggregate é o total de um processor em centavos, para que somar e
+// subtrair pagamentos não acumule erro de ponto flutuante.
+type aggregate struct {
+	Cents    int64 `json:"cents"`
+	Requests int   `json:"requests"`
+}
+
+// OpenFilePaymentRepository abre (ou cria) o storage em config.Dir: carrega o
+// snapshot, reaplica os segmentos posteriores e segue escrevendo no último.
+// Só um processo pode abrir o mesmo diretório: um flock em config.Dir/LOCK
+// faz o segundo Open falhar.
+func OpenFilePaymentRepository(config FileConfig) (*FilePaymentRepository, error) {
+	switch config.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("unknown fsync policy %q", config.Fsync)
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := lockDir(config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	r := &FilePaymentRepository{
+		config:   config,
+		lock:     lock,
+		payments: make(map[string]domain.Payment),
+		archive:  make(map[string]domain.Payment),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	log.Printf("💾 Storage: %d pagamentos e %d arquivados carregados de %s", len(r.payments), len(r.archive), config.Dir)
+	go r.run()
+	return r, nil
+}
+
+// load carrega o snapshot, reaplica os segmentos posteriores e abre o último
+// para escrita.
+func (r *FilePaymentRepository) load() error {
+	first, err := r.loadSnapshot()
+	if err != nil {
+		return err
+	}
+	segments, err := listSegments(r.config.Dir)
+	if err != nil {
+		return err
+	}
+	r.segment = max(first, 1)
+	for i, n := range segments {
+		if n < first {
+			// Sobra de uma compactação interrompida: já está no snapshot
+			os.Remove(filepath.Join(r.config.Dir, segmentName(n)))
+			continue
+		}
+		if err := r.replay(n, i == len(segments)-1); err != nil {
+			return err
+		}
+		r.segment = n
+	}
+	return r.openSegment()
+}
+
+// FilePaymentRepository guarda os pagamentos em memória e cada mudança num
+// log append-only em segmentos. Periodicamente o estado e os totais vão para
+// um snapshot e os segmentos que ele cobre são apagados, então a recuperação
+// lê o snapshot e só o fim do log.
+type FilePaymentRepository struct {
+	config   FileConfig
+	lock     *os.File // segura o flock do diretório até o Close
+	mu       sync.Mutex
+	snapMu   sync.Mutex // um snapshot por vez
+	payments map[string]domain.Payment
+	archive  map[string]domain.Payment
+	// order são os mesmos pagamentos de payments em ordem de requestedAt e
+	// correlationId, para ler um intervalo sem varrer nem ordenar tudo.
+	order []domain.Payment
+	// totals são os totais de default e fallback de payments; latest é o
+	// maior requestedAt já visto, para saber quando eles respondem um resumo.
+	totals  [2]aggregate
+	latest  time.Time
+	file    *os.File
+	segment uint64
+	size    int64
+	dirty   bool // escrito sem fsync
+	changes int  // registros desde o último snapshot
+	record  []byte
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func side(p domain.Payment) int {
+	if p.Processor == "fallback" {
+		return 1
+	}
+	return 0
+}
+
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func (r *FilePaymentRepository) put(p domain.Payment) {
+	if old, ok := r.drop(p.CorrelationID); ok {
+		r.unindex(old)
+	}
+	r.add(p)
+	// Quase sempre chega o mais recente, que só vai para o fim
+	if n := len(r.order); n == 0 || comparePayments(r.order[n-1], p) < 0 {
+		r.order = append(r.order, p)
+		return
+	}
+	i, _ := slices.BinarySearchFunc(r.order, p, comparePayments)
+	r.order = slices.Insert(r.order, i, p)
+}
+
+// add e drop mexem em payments e nos totais; o índice order fica a cargo
+// de quem chama.
+func (r *FilePaymentRepository) add(p domain.Payment) {
+	r.payments[p.CorrelationID] = p
+	total := &r.totals[side(p)]
+	total.Cents += cents(p.Amount)
+	total.Requests++
+	if p.RequestedAt.After(r.latest) {
+		r.latest = p.RequestedAt
+	}
+}
+
+func (r *FilePaymentRepository) drop(id string) (domain.Payment, bool) {
+	p, ok := r.payments[id]
+	if !ok {
+		return p, false
+	}
+	delete(r.payments, id)
+	total := &r.totals[side(p)]
+	total.Cents -= cents(p.Amount)
+	total.Requests--
+	return p, true
+}
+
+func (r *FilePaymentRepository) unindex(p domain.Payment) {
+	if i, found := slices.BinarySearchFunc(r.order, p, comparePayments); found {
+		r.order = slices.Delete(r.order, i, i+1)
+	}
+}
+
+// move aplica um purge ou restore e refaz o índice uma vez só, em vez de
+// deslocar order a cada pagamento.
+func (r *FilePaymentRepository) move(op byte, ids []string) {
+	removed := make(map[string]bool, len(ids))
+	var restored []domain.Payment
+	for _, id := range ids {
+		switch op {
+		case opDelete:
+			if _, ok := r.drop(id); ok {
+				removed[id] = true
+			}
+		case opArchive:
+			if p, ok := r.drop(id); ok {
+				removed[id] = true
+				r.archive[id] = p
+			}
+		case opRestore:
+			if p, ok := r.archive[id]; ok {
+				delete(r.archive, id)
+				if _, ok := r.drop(id); ok {
+					removed[id] = true
+				}
+				r.add(p)
+				restored = append(restored, p)
+			}
+		}
+	}
+	if len(removed) > 0 {
+		r.order = slices.DeleteFunc(r.order, func(p domain.Payment) bool { return removed[p.CorrelationID] })
+	}
+	if len(restored) > 0 {
+		r.order = append(r.order, restored...)
+		slices.SortFunc(r.order, comparePayments)
+	}
+}
+
+// window devolve o trecho de order com requestedAt entre from e to (zero é
+// sem limite), sem copiar. Só vale enquanto o lock estiver seguro.
+func (r *FilePaymentRepository) window(from, to time.Time) []domain.Payment {
+	lo := 0
+	if !from.IsZero() {
+		lo, _ = slices.BinarySearchFunc(r.order, from, func(p domain.Payment, t time.Time) int {
+			return p.RequestedAt.Compare(t)
+		})
+	}
+	hi := len(r.order)
+	if !to.IsZero() {
+		hi, _ = slices.BinarySearchFunc(r.order, to, func(p domain.Payment, t time.Time) int {
+			if p.RequestedAt.After(t) {
+				return 1
+			}
+			return -1
+		})
+	}
+	return r.order[lo:max(lo, hi)]
+}
+
+func (r *FilePaymentRepository) openSegment() error {
+	f, err := os.OpenFile(filepath.Join(r.config.Dir, segmentName(r.segment)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return syncDir(r.config.Dir)
+}
+
+// rotate fecha o segmento atual e passa a escrever no próximo.
+func (r *FilePaymentRepository) rotate() error {
+	if err := r.file.Sync(); err != nil {
+		return err
+	}
+	r.dirty = false
+	r.file.Close()
+	r.segment++
+	return r.openSegment()
+}
+
+// write anexa um registro ao log.
+func (r *FilePaymentRepository) write(op byte, data []byte) error {
+	r.record = appendRecord(r.record[:0], op, data)
+	return r.append(r.record, 1)
+}
+
+// append grava count registros já codificados com um só write (e um só
+// fsync). Em caso de erro tudo é desfeito, para não deixar uma linha pela
+// metade no meio do segmento.
+func (r *FilePaymentRepository) append(records []byte, count int) error {
+	if r.closed {
+		return ErrClosed
+	}
+	if r.size >= r.config.SegmentSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(records)
+	if err == nil && r.config.Fsync == FsyncAlways {
+		err = r.file.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			r.file.Truncate(r.size)
+		}
+		return err
+	}
+	r.size += int64(n)
+	r.dirty = r.config.Fsync == FsyncInterval
+	r.changes += count
+	return nil
+}
+
+func (r *FilePaymentRepository) Process(p domain.Payment) error {
+	buf := codec.GetBuffer()
+	defer codec.PutBuffer(buf)
+	var err error
+	if *buf, err = codec.AppendPayment(*buf, p); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.write(opPut, *buf); err != nil {
+		return err
+	}
+	r.put(p)
+	return nil
+}
+
+// ProcessBatch grava os pagamentos com um só write, o que com
+// STORAGE_FSYNC=always também quer dizer um só fsync para o lote.
+func (r *FilePaymentRepository) ProcessBatch(payments []domain.Payment) error {
+	buf := codec.GetBuffer()
+	defer codec.PutBuffer(buf)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record = r.record[:0]
+	for _, p := range payments {
+		var err error
+		if *buf, err = codec.AppendPayment((*buf)[:0], p); err != nil {
+			return err
+		}
+		r.record = appendRecord(r.record, opPut, *buf)
+	}
+	if err := r.append(r.record, len(payments)); err != nil {
+		return err
+	}
+	for _, p := range payments {
+		r.put(p)
+	}
+	return nil
+}
+
+// GetSummary responde direto dos totais quando o intervalo cobre todos os
+// pagamentos; senão soma só o trecho do índice entre from e to.
+func (r *FilePaymentRepository) GetSummary(from, to time.Time) (domain.PaymentSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := r.totals
+	if !from.IsZero() || (!to.IsZero() && to.Before(r.latest)) {
+		totals = [2]aggregate{}
+		for _, p := range r.window(from, to) {
+			totals[side(p)].Cents += cents(p.Amount)
+			totals[side(p)].Requests++
+		}
+	}
+	var summary domain.PaymentSummary
+	for i, item := range []*domain.SummaryItem{&summary.Default, &summary.Fallback} {
+		item.TotalAmount = float64(totals[i].Cents) / 100
+		item.TotalRequests = totals[i].Requests
+	}
+	return summary, nil
+}
+
+func (r *FilePaymentRepository) Payments(from, to time.Time) ([]domain.Payment, error) {
+	return r.matching(domain.PaymentFilter{From: from, To: to}), nil
+}
+
+// matching copia os pagamentos que batem com filter, para o chamador
+// percorrê-los sem segurar o lock.
+func (r *FilePaymentRepository) matching(filter domain.PaymentFilter) []domain.Payment {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var payments []domain.Payment
+	for _, p := range r.window(filter.From, filter.To) {
+		if filter.Matches(p) {
+			payments = append(payments, p)
+		}
+	}
+	return payments
+}
+
+// page copia até limit pagamentos que batem com filter, começando depois de
+// after (ou do início, se started for false). more diz se sobrou algum.
+func (r *FilePaymentRepository) page(filter domain.PaymentFilter, after domain.Payment, started bool, limit int) (payments []domain.Payment, more bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	window := r.window(filter.From, filter.To)
+	if started {
+		i, found := slices.BinarySearchFunc(window, after, comparePayments)
+		if found {
+			i++
+		}
+		window = window[i:]
+	}
+	for _, p := range window {
+		if !filter.Matches(p) {
+			continue
+		}
+		if len(payments) == limit {
+			return payments, true
+		}
+		payments = append(payments, p)
+	}
+	return payments, false
+}
+
+// ListPayments pagina em ordem de requestedAt e correlationId. O cursor é
+// o último item entregue (keyCursor), então a página
+// seguinte continua certa mesmo com inserções ou remoções no meio.
+func (r *FilePaymentRepository) ListPayments(filter domain.PaymentFilter, cursor string, limit int) ([]domain.Payment, string, error) {
+	after, err := parseKeyCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	payments, more := r.page(filter, after, cursor != "", limit)
+	if !more {
+		return payments, "", nil
+	}
+	return payments, keyCursor(payments[len(payments)-1]), nil
+}
+
+// keyCursor e parseKeyCursor codificam a posição de um pagamento na ordem
+// de requestedAt e correlationId, para paginação por chave.
+func keyCursor(p domain.Payment) string {
+	return fmt.Sprintf("%d.%s", p.RequestedAt.UnixNano(), p.CorrelationID)
+}
+
+func parseKeyCursor(cursor string) (domain.Payment, error) {
+	if cursor == "" {
+		return domain.Payment{}, nil
+	}
+	nanos, id, ok := strings.Cut(cursor, ".")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil || id == "" {
+		return domain.Payment{}, ErrInvalidCursor
+	}
+	return domain.Payment{CorrelationID: id, RequestedAt: time.Unix(0, n).UTC()}, nil
+}
+
+func comparePayments(a, b domain.Payment) int {
+	if c := a.RequestedAt.Compare(b.RequestedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.CorrelationID, b.CorrelationID)
+}
+
+// EachPayment percorre o índice em páginas de batchSize, soltando o lock
+// entre elas, então fn pode ser lento (ou usar o próprio repositório) sem
+// travar as escritas nem copiar tudo de uma vez.
+func (r *FilePaymentRepository) EachPayment(filter domain.PaymentFilter, fn func(domain.Payment) error) error {
+	var after domain.Payment
+	for started := false; ; started = true {
+		payments, more := r.page(filter, after, started, batchSize)
+		for _, p := range payments {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+		after = payments[len(payments)-1]
+	}
+}
+
+// Purge remove (ou, com filter.Archive, arquiva) os pagamentos que batem com
+// filter. A operação vai para o log como um único registro, então uma queda
+// no meio não deixa metade aplicada.
+func (r *FilePaymentRepository) Purge(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	if filter.Archive {
+		return r.change(opArchive, r.payments, filter)
+	}
+	return r.change(opDelete, r.payments, filter)
+}
+
+func (r *FilePaymentRepository) Restore(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	return r.change(opRestore, r.archive, filter)
+}
+
+func (r *FilePaymentRepository) change(op byte, src map[string]domain.Payment, filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := domain.PurgeResult{DryRun: filter.DryRun, Archived: op == opArchive}
+	var ids []string
+	for id, p := range src {
+		if filter.Matches(p) {
+			result.Add(p)
+			ids = append(ids, id)
+		}
+	}
+	if filter.DryRun || len(ids) == 0 {
+		return result, nil
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return domain.PurgeResult{DryRun: filter.DryRun, Archived: result.Archived}, err
+	}
+	if err := r.write(op, data); err != nil {
+		return domain.PurgeResult{DryRun: filter.DryRun, Archived: result.Archived}, err
+	}
+	r.move(op, ids)
+	return result, nil
+}
+
+// Snapshot grava o estado atual e apaga os segmentos que ele cobre. Sem
+// mudanças desde o último, não faz nada.
+func (r *FilePaymentRepository) Snapshot() error {
+	r.snapMu.Lock()
+	defer r.snapMu.Unlock()
+	r.mu.Lock()
+	if r.changes == 0 || r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	// Daqui em diante as escritas vão para um segmento que o snapshot não cobre
+	if err := r.rotate(); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	header := snapshotHeader{
+		Segment:  r.segment,
+		Payments: len(r.payments),
+		Archived: len(r.archive),
+		Totals:   r.totals,
+	}
+	payments, archive := slices.Clone(r.order), maps.Clone(r.archive)
+	changes := r.changes
+	r.changes = 0
+	r.mu.Unlock()
+
+	if err := r.writeSnapshot(header, payments, archive); err != nil {
+		r.mu.Lock()
+		r.changes += changes
+		r.mu.Unlock()
+		return err
+	}
+	r.removeSegments(header.Segment)
+	return nil
+}
+
+func (r *FilePaymentRepository) run() {
+	defer close(r.done)
+	fsync := time.NewTicker(r.config.FsyncInterval)
+	defer fsync.Stop()
+	snapshot := time.NewTicker(r.config.SnapshotInterval)
+	defer snapshot.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-fsync.C:
+			if err := r.sync(); err != nil {
+				log.Println("⚠ Storage: fsync falhou:", err)
+			}
+		case <-snapshot.C:
+			if err := r.Snapshot(); err != nil {
+				log.Println("⚠ Storage: snapshot falhou:", err)
+			}
+		}
+	}
+}
+
+func (r *FilePaymentRepository) sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+	r.dirty = false
+	return r.file.Sync()
+}
+
+// Close tira um último snapshot, para o próximo Open não precisar reaplicar
+// o log, e fecha o segmento.
+func (r *FilePaymentRepository) Close() error {
+	close(r.stop)
+	<-r.done
+	if err := r.Snapshot(); err != nil {
+		log.Println("⚠ Storage: snapshot final falhou:", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.lock.Close()
+	r.closed = true
+	if err := r.file.Sync(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
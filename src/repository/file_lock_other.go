@@ -0,0 +1,14 @@
+//go:build !unix
+
+package repository
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockDir só cria o LOCK: fora de unix não há flock, e o storage confia em
+// quem o abre para não haver dois processos no mesmo diretório.
+func lockDir(dir string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE|os.O_RDWR, 0o644)
+}
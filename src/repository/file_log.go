@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alexsandroveiga/rdb25/src/codec"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+// Segmentos e snapshot usam o mesmo formato: uma linha por registro,
+// "<crc32 em hex>\t<op>\t<dados>\n", com o CRC cobrindo "op\tdados". Uma
+// linha cortada ou com CRC errado no fim do último segmento é o que sobrou
+// de uma escrita interrompida por uma queda.
+const (
+	opPut     = 'P' // dados: pagamento
+	opDelete  = 'D' // dados: ids em JSON
+	opArchive = 'A' // dados: ids em JSON
+	opRestore = 'R' // dados: ids em JSON
+	// Só no snapshot
+	opHeader   = 'S' // dados: snapshotHeader
+	opArchived = 'X' // dados: pagamento arquivado
+)
+
+const (
+	segmentExt   = ".seg"
+	snapshotName = "snapshot"
+	lockName     = "LOCK"
+)
+
+var errCorrupted = errors.New("corrupted record")
+
+func appendRecord(dst []byte, op byte, data []byte) []byte {
+	start := len(dst)
+	dst = append(dst, "00000000\t"...)
+	dst = append(dst, op, '\t')
+	dst = append(dst, data...)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(dst[start+9:]))
+	hex.Encode(dst[start:start+8], sum[:])
+	return append(dst, '\n')
+}
+
+// parseRecord valida uma linha sem o '\n' final.
+func parseRecord(line []byte) (byte, []byte, error) {
+	if len(line) < 11 || line[8] != '\t' || line[10] != '\t' {
+		return 0, nil, errCorrupted
+	}
+	var sum [4]byte
+	if _, err := hex.Decode(sum[:], line[:8]); err != nil {
+		return 0, nil, errCorrupted
+	}
+	if binary.BigEndian.Uint32(sum[:]) != crc32.ChecksumIEEE(line[9:]) {
+		return 0, nil, errCorrupted
+	}
+	return line[9], line[11:], nil
+}
+
+// snapshotHeader abre o snapshot. Segment é o primeiro segmento que ainda
+// precisa ser lido depois dele; os totais conferem os pagamentos carregados.
+type snapshotHeader struct {
+	Segment  uint64       `json:"segment"`
+	Payments int          `json:"payments"`
+	Archived int          `json:"archived"`
+	Totals   [2]aggregate `json:"totals"`
+}
+
+func segmentName(n uint64) string {
+	return fmt.Sprintf("%020d%s", n, segmentExt)
+}
+
+// listSegments devolve os números dos segmentos em dir, em ordem.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(name, 10, 64); err == nil {
+			segments = append(segments, n)
+		}
+	}
+	slices.Sort(segments)
+	return segments, nil
+}
+
+// syncDir garante que criações, renomeações e remoções em dir sobrevivam a
+// uma queda.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// loadSnapshot carrega o snapshot, se houver, e devolve o primeiro segmento
+// a reaplicar. Como o snapshot só aparece por rename depois do fsync,
+// qualquer defeito nele é erro, não queda.
+func (r *FilePaymentRepository) loadSnapshot() (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(r.config.Dir, snapshotName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var header *snapshotHeader
+	for line := range bytes.Lines(data) {
+		op, body, err := parseRecord(bytes.TrimSuffix(line, []byte{'\n'}))
+		if err != nil {
+			return 0, fmt.Errorf("snapshot: %w", err)
+		}
+		if header == nil {
+			header = new(snapshotHeader)
+			if op != opHeader || json.Unmarshal(body, header) != nil {
+				return 0, errors.New("snapshot: missing header")
+			}
+			continue
+		}
+		var p domain.Payment
+		if err := codec.DecodePayment(body, &p, false); err != nil {
+			return 0, fmt.Errorf("snapshot: %w", err)
+		}
+		switch op {
+		case opPut:
+			r.put(p)
+		case opArchived:
+			r.archive[p.CorrelationID] = p
+		default:
+			return 0, fmt.Errorf("snapshot: unexpected op %q", op)
+		}
+	}
+	if header == nil {
+		return 0, errors.New("snapshot: missing header")
+	}
+	if header.Payments != len(r.payments) || header.Archived != len(r.archive) || header.Totals != r.totals {
+		return 0, errors.New("snapshot: totals do not match its payments")
+	}
+	return header.Segment, nil
+}
+
+// replay reaplica o segmento n. No último segmento um registro inválido é
+// o rastro de uma queda e o arquivo é cortado ali; nos outros é corrupção.
+func (r *FilePaymentRepository) replay(n uint64, last bool) error {
+	path := filepath.Join(r.config.Dir, segmentName(n))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var offset int
+	for line := range bytes.Lines(data) {
+		err := errCorrupted
+		if bytes.HasSuffix(line, []byte{'\n'}) {
+			var op byte
+			var body []byte
+			if op, body, err = parseRecord(line[:len(line)-1]); err == nil {
+				err = r.apply(op, body)
+			}
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("segment %d at offset %d: %w", n, offset, err)
+			}
+			log.Printf("⚠ Storage: descartando %d bytes do fim de %s", len(data)-offset, segmentName(n))
+			return os.Truncate(path, int64(offset))
+		}
+		offset += len(line)
+	}
+	return nil
+}
+
+// apply aplica um registro de segmento ao estado em memória.
+func (r *FilePaymentRepository) apply(op byte, body []byte) error {
+	if op == opPut {
+		var p domain.Payment
+		if err := codec.DecodePayment(body, &p, false); err != nil {
+			return err
+		}
+		r.put(p)
+		return nil
+	}
+	var ids []string
+	if err := json.Unmarshal(body, &ids); err != nil {
+		return err
+	}
+	switch op {
+	case opDelete, opArchive, opRestore:
+		r.move(op, ids)
+		return nil
+	}
+	return fmt.Errorf("%w: unknown op %q", errCorrupted, op)
+}
+
+// writeSnapshot grava o estado num arquivo temporário e o renomeia por cima
+// do snapshot anterior só depois do fsync. Os pagamentos vão em ordem, para
+// o load reconstruir o índice só anexando.
+func (r *FilePaymentRepository) writeSnapshot(header snapshotHeader, payments []domain.Payment, archive map[string]domain.Payment) error {
+	tmp := filepath.Join(r.config.Dir, snapshotName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp) // no caminho feliz já foi renomeado
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	record := appendRecord(nil, opHeader, data)
+	var encoded []byte
+	write := func(op byte, p domain.Payment) error {
+		if encoded, err = codec.AppendPayment(encoded[:0], p); err != nil {
+			return err
+		}
+		record = appendRecord(record[:0], op, encoded)
+		_, err := w.Write(record)
+		return err
+	}
+	if _, err := w.Write(record); err != nil {
+		return err
+	}
+	for _, p := range payments {
+		if err := write(opPut, p); err != nil {
+			return err
+		}
+	}
+	for _, p := range archive {
+		if err := write(opArchived, p); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(r.config.Dir, snapshotName)); err != nil {
+		return err
+	}
+	return syncDir(r.config.Dir)
+}
+
+// removeSegments apaga os segmentos anteriores a before, já cobertos pelo
+// snapshot.
+func (r *FilePaymentRepository) removeSegments(before uint64) {
+	segments, err := listSegments(r.config.Dir)
+	if err != nil {
+		log.Println("⚠ Storage: não foi possível listar os segmentos:", err)
+		return
+	}
+	for _, n := range segments {
+		if n >= before {
+			break
+		}
+		if err := os.Remove(filepath.Join(r.config.Dir, segmentName(n))); err != nil {
+			log.Println("⚠ Storage: segmento não removido:", err)
+		}
+	}
+}
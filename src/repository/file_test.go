@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+func fileConfig(dir string, segmentSize int64) FileConfig {
+	return FileConfig{
+		Dir:              dir,
+		Fsync:            FsyncNever,
+		FsyncInterval:    time.Hour,
+		SnapshotInterval: time.Hour,
+		SegmentSize:      segmentSize,
+	}
+}
+
+func openFile(t *testing.T, dir string) *FilePaymentRepository {
+	t.Helper()
+	return openSegmented(t, dir, 1<<20)
+}
+
+// openSegmented abre com segmentos de segmentSize bytes; com 1, cada
+// registro vai para um segmento.
+func openSegmented(t *testing.T, dir string, segmentSize int64) *FilePaymentRepository {
+	t.Helper()
+	repo, err := OpenFilePaymentRepository(fileConfig(dir, segmentSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// crash larga o repositório como uma queda: sem snapshot final nem fsync.
+func crash(repo *FilePaymentRepository) {
+	close(repo.stop)
+	<-repo.done
+	repo.file.Close()
+	repo.lock.Close()
+}
+
+// seedFile grava os pagamentos a, b e c e devolve o repositório aberto.
+func seedFile(t *testing.T, dir string, segmentSize int64) *FilePaymentRepository {
+	t.Helper()
+	repo := openSegmented(t, dir, segmentSize)
+	for i, id := range []string{"a", "b", "c"} {
+		if err := repo.Process(domain.Payment{CorrelationID: id, Amount: 1, RequestedAt: t0.Add(time.Duration(i) * time.Second), Processor: "default"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func lastSegment(t *testing.T, dir string) string {
+	t.Helper()
+	segments, err := listSegments(dir)
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("segments = %v, %v", segments, err)
+	}
+	return filepath.Join(dir, segmentName(segments[len(segments)-1]))
+}
+
+func appendFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listAll pagina com limit e devolve tudo na ordem entregue.
+func listAll(t *testing.T, repo *FilePaymentRepository, filter domain.PaymentFilter, limit int) []string {
+	t.Helper()
+	var ids []string
+	cursor := ""
+	for {
+		payments, next, err := repo.ListPayments(filter, cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range payments {
+			ids = append(ids, p.CorrelationID)
+		}
+		if next == "" {
+			return ids
+		}
+		cursor = next
+	}
+}
+
+// TestFileIndex confere que o índice por requestedAt acompanha inserções
+// fora de ordem, regravações, purge, restore e a reabertura.
+func TestFileIndex(t *testing.T) {
+	dir := t.TempDir()
+	repo := openFile(t, dir)
+	n := batchSize + 30
+	// De trás para frente, para cada um cair no meio do índice
+	for i := n - 1; i >= 0; i-- {
+		processor := "default"
+		if i%2 == 1 {
+			processor = "fallback"
+		}
+		p := domain.Payment{CorrelationID: fmt.Sprintf("id-%04d", i), Amount: 1, RequestedAt: t0.Add(time.Duration(i) * time.Second), Processor: processor}
+		if err := repo.Process(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Regravar com outro requestedAt move o pagamento no índice
+	if err := repo.Process(domain.Payment{CorrelationID: "id-0000", Amount: 1, RequestedAt: t0.Add(time.Hour), Processor: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	want := make([]string, 0, n)
+	for i := 1; i < n; i++ {
+		want = append(want, fmt.Sprintf("id-%04d", i))
+	}
+	want = append(want, "id-0000")
+	if got := listAll(t, repo, domain.PaymentFilter{}, 37); !slices.Equal(got, want) {
+		t.Fatalf("list = %v", got)
+	}
+
+	window := domain.PaymentFilter{From: t0.Add(10 * time.Second), To: t0.Add(19 * time.Second)}
+	if s, _ := repo.GetSummary(window.From, window.To); s.Default.TotalRequests != 5 || s.Fallback.TotalRequests != 5 {
+		t.Errorf("summary = %+v", s)
+	}
+	if got := listAll(t, repo, domain.PaymentFilter{From: window.From, To: window.To, Processor: "fallback"}, 2); !slices.Equal(got, []string{"id-0011", "id-0013", "id-0015", "id-0017", "id-0019"}) {
+		t.Errorf("fallback window = %v", got)
+	}
+	var each int
+	repo.EachPayment(domain.PaymentFilter{}, func(domain.Payment) error { each++; return nil })
+	if each != n {
+		t.Errorf("each = %d, want %d", each, n)
+	}
+
+	if _, err := repo.Purge(domain.PurgeFilter{PaymentFilter: window, Archive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := repo.GetSummary(window.From, window.To); requests(s) != 0 {
+		t.Errorf("after archive = %+v", s)
+	}
+	if _, err := repo.Restore(domain.PurgeFilter{PaymentFilter: domain.PaymentFilter{Processor: "default"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := listAll(t, repo, window, 100); !slices.Equal(got, []string{"id-0010", "id-0012", "id-0014", "id-0016", "id-0018"}) {
+		t.Errorf("after restore = %v", got)
+	}
+
+	before := listAll(t, repo, domain.PaymentFilter{}, 1000)
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	repo = openFile(t, dir)
+	defer repo.Close()
+	if got := listAll(t, repo, domain.PaymentFilter{}, 1000); !slices.Equal(got, before) {
+		t.Errorf("after reopen = %d payments, want %d", len(got), len(before))
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	dir := t.TempDir()
+	repo := openFile(t, dir)
+	if _, err := OpenFilePaymentRepository(fileConfig(dir, 1<<20)); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("second open: %v, want the directory in use", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	openFile(t, dir).Close()
+}
+
+// TestFileRecovery cobre o que o Open encontra depois de uma queda ou de um
+// arquivo estragado.
+func TestFileRecovery(t *testing.T) {
+	torn := func(t *testing.T, dir string) {
+		appendFile(t, lastSegment(t, dir), []byte(`00000000	P	{"correlationId":"d"`))
+	}
+	badCRC := func(t *testing.T, dir string) {
+		record := appendRecord(nil, opPut, []byte(`{"correlationId":"d","amount":1,"requestedAt":"2025-07-15T12:00:00Z","processor":"default"}`))
+		record[0] ^= 1
+		appendFile(t, lastSegment(t, dir), record)
+	}
+	for name, damage := range map[string]func(*testing.T, string){"torn tail": torn, "bad crc tail": badCRC} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			crash(seedFile(t, dir, 1<<20))
+			before, _ := os.ReadFile(lastSegment(t, dir))
+			damage(t, dir)
+			repo := openFile(t, dir)
+			defer repo.Close()
+			if got := listAll(t, repo, domain.PaymentFilter{}, 10); !slices.Equal(got, []string{"a", "b", "c"}) {
+				t.Errorf("payments = %v", got)
+			}
+			// O fim estragado foi cortado e as escritas seguem dali
+			after, _ := os.ReadFile(lastSegment(t, dir))
+			if !bytes.Equal(after, before) {
+				t.Errorf("last segment has %d bytes, want %d", len(after), len(before))
+			}
+		})
+	}
+
+	t.Run("corrupted middle segment", func(t *testing.T) {
+		dir := t.TempDir()
+		crash(seedFile(t, dir, 1))
+		segments, _ := listSegments(dir)
+		if len(segments) < 3 {
+			t.Fatalf("segments = %v, want one per payment", segments)
+		}
+		path := filepath.Join(dir, segmentName(segments[1]))
+		data, _ := os.ReadFile(path)
+		data[len(data)/2] ^= 1
+		os.WriteFile(path, data, 0o644)
+		if repo, err := OpenFilePaymentRepository(fileConfig(dir, 1)); err == nil {
+			repo.Close()
+			t.Fatal("opened with a corrupted middle segment")
+		}
+		// A falha solta o lock
+		lock, err := lockDir(dir)
+		if err != nil {
+			t.Fatalf("lock after a failed open: %v", err)
+		}
+		lock.Close()
+		if data, _ := os.ReadFile(path); data == nil {
+			t.Error("middle segment was removed")
+		}
+	})
+
+	t.Run("snapshot totals mismatch", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := seedFile(t, dir, 1<<20).Close(); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, snapshotName)
+		data, _ := os.ReadFile(path)
+		first, rest, _ := bytes.Cut(data, []byte{'\n'})
+		_, body, err := parseRecord(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var header snapshotHeader
+		json.Unmarshal(body, &header)
+		header.Totals[0].Cents++
+		body, _ = json.Marshal(header)
+		os.WriteFile(path, append(appendRecord(nil, opHeader, body), rest...), 0o644)
+		if repo, err := OpenFilePaymentRepository(fileConfig(dir, 1<<20)); err == nil || !strings.Contains(err.Error(), "totals") {
+			if repo != nil {
+				repo.Close()
+			}
+			t.Fatalf("open: %v, want the totals mismatch", err)
+		}
+	})
+
+	t.Run("leftover segments", func(t *testing.T) {
+		dir := t.TempDir()
+		repo := seedFile(t, dir, 1)
+		if err := repo.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+		crash(repo)
+		// Segmento que a compactação não chegou a apagar, com um pagamento
+		// que o snapshot já não tem
+		leftover := filepath.Join(dir, segmentName(1))
+		record := appendRecord(nil, opPut, []byte(`{"correlationId":"ghost","amount":1,"requestedAt":"2025-07-15T12:00:00Z","processor":"default"}`))
+		if err := os.WriteFile(leftover, record, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		repo = openSegmented(t, dir, 1)
+		defer repo.Close()
+		if got := listAll(t, repo, domain.PaymentFilter{}, 10); !slices.Equal(got, []string{"a", "b", "c"}) {
+			t.Errorf("payments = %v", got)
+		}
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("leftover segment still there: %v", err)
+		}
+	})
+}
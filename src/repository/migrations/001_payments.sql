@@ -0,0 +1,12 @@
+CREATE TABLE payments (
+    correlation_id TEXT PRIMARY KEY,
+    amount NUMERIC(14, 2) NOT NULL,
+    requested_at TIMESTAMPTZ NOT NULL,
+    processor TEXT NOT NULL
+);
+
+-- O resumo soma por intervalo de requested_at; com amount e processor no
+-- índice ele é respondido sem ler a tabela.
+CREATE INDEX payments_requested_at_idx ON payments (requested_at, correlation_id) INCLUDE (amount, processor);
+
+CREATE TABLE payments_archive (LIKE payments INCLUDING ALL);
@@ -18,6 +18,8 @@ type paymentRepository struct {
 type PaymentRepository interface {
 	Process(p domain.Payment)
 	GetSummary(from, to time.Time) domain.PaymentSummary
+	Purge(filter domain.PurgeFilter) domain.PurgeResult
+	Restore(filter domain.PurgeFilter) domain.PurgeResult
 }
 
 func (pr *paymentRepository) Process(p domain.Payment) {
@@ -45,3 +47,34 @@ func (pr *paymentRepository) GetSummary(from, to time.Time) domain.PaymentSummar
 	}
 	return summary
 }
+
+func (pr *paymentRepository) Purge(filter domain.PurgeFilter) domain.PurgeResult {
+	return pr.move("payments", "payments_archive", filter, filter.Archive)
+}
+
+func (pr *paymentRepository) Restore(filter domain.PurgeFilter) domain.PurgeResult {
+	return pr.move("payments_archive", "payments", filter, true)
+}
+
+// move tira de src os pagamentos que batem com filter e, se keep, os anexa em dst.
+func (pr *paymentRepository) move(src, dst string, filter domain.PurgeFilter, keep bool) domain.PurgeResult {
+	result := domain.PurgeResult{DryRun: filter.DryRun, Archived: filter.Archive}
+	pr.storage.Update(func(lists map[string][]any) {
+		var remaining []any
+		for _, item := range lists[src] {
+			p, ok := item.(domain.Payment)
+			if !ok || !filter.Matches(p) {
+				remaining = append(remaining, item)
+				continue
+			}
+			result.Add(p)
+			if keep && !filter.DryRun {
+				lists[dst] = append(lists[dst], item)
+			}
+		}
+		if !filter.DryRun {
+			lists[src] = remaining
+		}
+	}, src, dst)
+	return result
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	pendingKey      = "payments:pending"       // score: requestedAt, para a barreira
+	pendingLeaseKey = "payments:pending:lease" // score: último registro, para o lease
+	// pendingLease é quanto um pagamento pode ficar pendente sem ser
+	// registrado de novo: depois disso ele é de uma instância que caiu e não
+	// segura mais a barreira. Conta do registro, não do requestedAt, para um
+	// pagamento antigo que ainda está sendo retentado não sair da barreira.
+	pendingLease = time.Minute
+)
+
+func NewRedisPendingRepository(client *redis.Client) PendingRepository {
+	return &redisPendingRepository{client}
+}
+
+// PendingRepository guarda os pagamentos já enviados ao processor e ainda
+// não gravados, de todas as instâncias, com o requestedAt e o horário do
+// último registro.
+type PendingRepository interface {
+	// Add registra o pagamento ou, se já estiver pendente, renova o lease.
+	Add(correlationID string, requestedAt time.Time) error
+	Remove(correlationID string) error
+	// Pending conta os pendentes com requestedAt <= to.
+	Pending(to time.Time) (int64, error)
+}
+
+type redisPendingRepository struct {
+	client *redis.Client
+}
+
+func (r *redisPendingRepository) Add(correlationID string, requestedAt time.Time) error {
+	ctx := context.Background()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, pendingKey, redis.Z{Score: float64(requestedAt.UnixMicro()), Member: correlationID})
+		pipe.ZAdd(ctx, pendingLeaseKey, redis.Z{Score: float64(time.Now().UnixMicro()), Member: correlationID})
+		return nil
+	})
+	return err
+}
+
+func (r *redisPendingRepository) Remove(correlationID string) error {
+	ctx := context.Background()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, pendingKey, correlationID)
+		pipe.ZRem(ctx, pendingLeaseKey, correlationID)
+		return nil
+	})
+	return err
+}
+
+// pendingScript tira dos dois sets os pendentes com lease vencido e conta os
+// que restam com requestedAt <= ARGV[2].
+var pendingScript = redis.NewScript(`
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1])
+for _, id in ipairs(stale) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZREM', KEYS[2], id)
+end
+return redis.call('ZCOUNT', KEYS[1], '-inf', ARGV[2])`)
+
+func (r *redisPendingRepository) Pending(to time.Time) (int64, error) {
+	stale := strconv.FormatInt(time.Now().Add(-pendingLease).UnixMicro(), 10)
+	return pendingScript.Run(context.Background(), r.client, []string{pendingKey, pendingLeaseKey}, stale, strconv.FormatInt(to.UnixMicro(), 10)).Int64()
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestPendingLease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	pending := NewRedisPendingRepository(client)
+	now := time.Now()
+
+	// requestedAt antigo, registrado agora: ainda pendente
+	if err := pending.Add("old", now.Add(-2*pendingLease)); err != nil {
+		t.Fatal(err)
+	}
+	pending.Add("new", now)
+	if n, err := pending.Pending(now); err != nil || n != 2 {
+		t.Fatalf("pending = %d, %v; want 2", n, err)
+	}
+	if n, _ := pending.Pending(now.Add(-pendingLease)); n != 1 {
+		t.Errorf("pending before the new one = %d, want 1", n)
+	}
+
+	// Registro de uma instância que caiu: o lease venceu e sai dos dois sets
+	expire := func(id string) {
+		client.ZAdd(context.Background(), pendingLeaseKey, redis.Z{Score: float64(now.Add(-2 * pendingLease).UnixMicro()), Member: id})
+	}
+	expire("old")
+	if n, _ := pending.Pending(now); n != 1 {
+		t.Errorf("pending after the lease expired = %d, want 1", n)
+	}
+	if len(members(t, mr, pendingKey)) != 1 || len(members(t, mr, pendingLeaseKey)) != 1 {
+		t.Error("expired entry left in the sets")
+	}
+
+	// Um novo Add renova o lease
+	expire("new")
+	pending.Add("new", now)
+	if n, _ := pending.Pending(now); n != 1 {
+		t.Errorf("pending after renewing = %d, want 1", n)
+	}
+	pending.Remove("new")
+	if n, _ := pending.Pending(now); n != 0 {
+		t.Errorf("pending after Remove = %d", n)
+	}
+}
+
+func members(t *testing.T, mr *miniredis.Miniredis, key string) []string {
+	t.Helper()
+	members, err := mr.ZMembers(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return members
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock é a chave do advisory lock que impede duas instâncias
+// subindo juntas de aplicarem a mesma migração.
+const migrationLock = 7_250_049
+
+const (
+	paymentsTable = "payments"
+	archiveTable  = "payments_archive"
+)
+
+var paymentColumns = []string{"correlation_id", "amount", "requested_at", "processor"}
+
+// upsert completa um INSERT em payments: o mesmo correlation_id sobrescreve,
+// como o SET do Redis, para que reprocessar um pagamento seja idempotente.
+const upsert = ` ON CONFLICT (correlation_id) DO UPDATE SET
+	amount = EXCLUDED.amount, requested_at = EXCLUDED.requested_at, processor = EXCLUDED.processor`
+
+// NewPostgresPaymentRepository conecta em url e aplica as migrações
+// pendentes antes de devolver o repositório.
+func NewPostgresPaymentRepository(ctx context.Context, url string) (*PostgresPaymentRepository, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return &PostgresPaymentRepository{pool}, nil
+}
+
+type PostgresPaymentRepository struct {
+	pool *pgxpool.Pool
+}
+
+func (r *PostgresPaymentRepository) Close() {
+	r.pool.Close()
+}
+
+// migrate aplica, em ordem de nome e cada uma na sua transação, os arquivos
+// de migrations/ que ainda não estão em schema_migrations.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLock)
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		version := strings.TrimSuffix(entry.Name(), ".sql")
+		var applied bool
+		if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+		script, err := migrations.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return err
+		}
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		log.Printf("🗄 Migração %s aplicada", version)
+	}
+	return nil
+}
+
+func (r *PostgresPaymentRepository) Process(p domain.Payment) error {
+	_, err := r.pool.Exec(context.Background(),
+		`INSERT INTO payments (correlation_id, amount, requested_at, processor) VALUES ($1, $2, $3, $4)`+upsert,
+		p.CorrelationID, p.Amount, p.RequestedAt, p.Processor)
+	return err
+}
+
+// ProcessBatch grava vários pagamentos numa transação: COPY para uma tabela
+// temporária e de lá um único upsert. O COPY sozinho não resolveria
+// conflitos de correlation_id.
+func (r *PostgresPaymentRepository) ProcessBatch(payments []domain.Payment) error {
+	if len(payments) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `CREATE TEMP TABLE payments_batch (LIKE payments) ON COMMIT DROP`); err != nil {
+			return err
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"payments_batch"}, paymentColumns, pgx.CopyFromSlice(len(payments), func(i int) ([]any, error) {
+			p := payments[i]
+			return []any{p.CorrelationID, p.Amount, p.RequestedAt, p.Processor}, nil
+		}))
+		if err != nil {
+			return err
+		}
+		// DISTINCT ON: o ON CONFLICT não aceita o mesmo id duas vezes no lote
+		_, err = tx.Exec(ctx, `INSERT INTO payments SELECT DISTINCT ON (correlation_id) * FROM payments_batch`+upsert)
+		return err
+	})
+}
+
+// GetSummary soma no banco; o índice em requested_at cobre a consulta.
+func (r *PostgresPaymentRepository) GetSummary(from, to time.Time) (domain.PaymentSummary, error) {
+	return r.summarize(context.Background(),
+		`SELECT processor = 'fallback', COALESCE(SUM(amount), 0)::float8, COUNT(*)
+		FROM payments WHERE requested_at BETWEEN $1 AND $2 GROUP BY 1`, from, to)
+}
+
+// summarize lê linhas (é fallback, total, quantidade) para um PaymentSummary.
+func (r *PostgresPaymentRepository) summarize(ctx context.Context, query string, args ...any) (domain.PaymentSummary, error) {
+	var summary domain.PaymentSummary
+	var fallback bool
+	var amount float64
+	var count int
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return summary, err
+	}
+	_, err = pgx.ForEachRow(rows, []any{&fallback, &amount, &count}, func() error {
+		item := &summary.Default
+		if fallback {
+			item = &summary.Fallback
+		}
+		item.TotalAmount += amount
+		item.TotalRequests += count
+		return nil
+	})
+	return summary, err
+}
+
+func (r *PostgresPaymentRepository) Payments(from, to time.Time) ([]domain.Payment, error) {
+	var payments []domain.Payment
+	err := r.EachPayment(domain.PaymentFilter{From: from, To: to}, func(p domain.Payment) error {
+		payments = append(payments, p)
+		return nil
+	})
+	return payments, err
+}
+
+// where traduz filter para uma condição SQL, acrescentando os valores a args.
+func where(filter domain.PaymentFilter, args []any) (string, []any) {
+	conds := []string{"TRUE"}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conds = append(conds, fmt.Sprintf("requested_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conds = append(conds, fmt.Sprintf("requested_at <= $%d", len(args)))
+	}
+	if filter.Processor != "" {
+		args = append(args, filter.Processor)
+		conds = append(conds, fmt.Sprintf("processor = $%d", len(args)))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func scanPayment(row pgx.CollectableRow) (domain.Payment, error) {
+	var p domain.Payment
+	err := row.Scan(&p.CorrelationID, &p.Amount, &p.RequestedAt, &p.Processor)
+	p.RequestedAt = p.RequestedAt.UTC()
+	return p, err
+}
+
+// ListPayments pagina por chave em (requested_at, correlation_id), a mesma
+// ordem do índice, com o cursor de keyCursor.
+func (r *PostgresPaymentRepository) ListPayments(filter domain.PaymentFilter, cursor string, limit int) ([]domain.Payment, string, error) {
+	after, err := parseKeyCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	cond, args := where(filter, nil)
+	if cursor != "" {
+		args = append(args, after.RequestedAt, after.CorrelationID)
+		cond += fmt.Sprintf(" AND (requested_at, correlation_id) > ($%d, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, limit+1)
+	rows, err := r.pool.Query(context.Background(),
+		`SELECT correlation_id, amount, requested_at, processor FROM payments WHERE `+cond+
+			fmt.Sprintf(` ORDER BY requested_at, correlation_id LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, "", err
+	}
+	payments, err := pgx.CollectRows(rows, scanPayment)
+	if err != nil || len(payments) <= limit {
+		return payments, "", err
+	}
+	return payments[:limit], keyCursor(payments[limit-1]), nil
+}
+
+// EachPayment percorre o resultado à medida que chega do banco, sem
+// carregar tudo na memória.
+func (r *PostgresPaymentRepository) EachPayment(filter domain.PaymentFilter, fn func(domain.Payment) error) error {
+	cond, args := where(filter, nil)
+	rows, err := r.pool.Query(context.Background(),
+		`SELECT correlation_id, amount, requested_at, processor FROM payments WHERE `+cond, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Purge apaga (ou, com filter.Archive, move para payments_archive) os
+// pagamentos que batem com filter num único comando.
+func (r *PostgresPaymentRepository) Purge(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	if filter.Archive {
+		return r.move(paymentsTable, archiveTable, filter)
+	}
+	return r.move(paymentsTable, "", filter)
+}
+
+func (r *PostgresPaymentRepository) Restore(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	return r.move(archiveTable, paymentsTable, filter)
+}
+
+// move tira de src as linhas que batem com filter e, com dst, as insere lá.
+// No dry-run só soma o que seria movido.
+func (r *PostgresPaymentRepository) move(src, dst string, filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	result := domain.PurgeResult{DryRun: filter.DryRun, Archived: dst == archiveTable}
+	cond, args := where(filter.PaymentFilter, nil)
+	const totals = `SELECT processor = 'fallback', COALESCE(SUM(amount), 0)::float8, COUNT(*) FROM moved GROUP BY 1`
+	var query string
+	switch {
+	case filter.DryRun:
+		query = `WITH moved AS (SELECT * FROM ` + src + ` WHERE ` + cond + `) ` + totals
+	case dst == "":
+		query = `WITH moved AS (DELETE FROM ` + src + ` WHERE ` + cond + ` RETURNING *) ` + totals
+	default:
+		query = `WITH moved AS (DELETE FROM ` + src + ` WHERE ` + cond + ` RETURNING *),
+			copied AS (INSERT INTO ` + dst + ` SELECT * FROM moved` + upsert + `) ` + totals
+	}
+	summary, err := r.summarize(context.Background(), query, args...)
+	if err != nil {
+		return result, err
+	}
+	result.PaymentSummary = summary
+	return result, nil
+}
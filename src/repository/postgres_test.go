@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// startPostgres sobe um postgres descartável com o initdb e o pg_ctl do PATH
+// e devolve a URL do banco postgres. Sem os binários o teste é pulado.
+func startPostgres(t *testing.T) string {
+	t.Helper()
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		t.Skip("initdb not in PATH")
+	}
+	pgCtl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		t.Skip("pg_ctl not in PATH")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("postgres refuses to run as root")
+	}
+	data := filepath.Join(t.TempDir(), "data")
+	if out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-N").CombinedOutput(); err != nil {
+		t.Fatalf("initdb: %v\n%s", err, out)
+	}
+	// O caminho do socket tem limite de tamanho; o TempDir do teste pode passar dele
+	sockets, err := os.MkdirTemp("", "pg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(sockets) })
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -F", port, sockets)
+	logFile := filepath.Join(data, "postgres.log")
+	if out, err := exec.Command(pgCtl, "-D", data, "-o", options, "-l", logFile, "-w", "start").CombinedOutput(); err != nil {
+		log, _ := os.ReadFile(logFile)
+		t.Fatalf("pg_ctl start: %v\n%s%s", err, out, log)
+	}
+	t.Cleanup(func() {
+		exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+	})
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+}
+
+// newDatabase cria um banco vazio no servidor de url, para cada subteste
+// começar sem tabelas.
+func newDatabase(t *testing.T, url string) string {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := conn.Exec(ctx, `CREATE DATABASE `+name); err != nil {
+		t.Fatal(err)
+	}
+	config, err := pgx.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("postgres://postgres@%s:%d/%s?sslmode=disable", config.Host, config.Port, name)
+}
+
+func newPostgres(t *testing.T, url string) *PostgresPaymentRepository {
+	t.Helper()
+	repo, err := NewPostgresPaymentRepository(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+func seedPostgres(t *testing.T, repo *PostgresPaymentRepository, n int) {
+	t.Helper()
+	payments := make([]domain.Payment, n)
+	for i := range payments {
+		processor := "default"
+		if i%2 == 1 {
+			processor = "fallback"
+		}
+		payments[i] = domain.Payment{CorrelationID: fmt.Sprintf("id-%04d", i), Amount: 1, RequestedAt: t0.Add(time.Duration(i) * time.Second), Processor: processor}
+	}
+	if err := repo.ProcessBatch(payments); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgres(t *testing.T) {
+	server := startPostgres(t)
+	all := func(repo *PostgresPaymentRepository) domain.PaymentSummary {
+		t.Helper()
+		s, err := repo.GetSummary(t0.Add(-time.Hour), t0.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	t.Run("migrate", func(t *testing.T) {
+		url := newDatabase(t, server)
+		newPostgres(t, url)
+		// A segunda abertura não reaplica nada
+		repo := newPostgres(t, url)
+		entries, _ := fs.ReadDir(migrations, "migrations")
+		var applied int
+		if err := repo.pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+			t.Fatal(err)
+		}
+		if applied != len(entries) {
+			t.Errorf("applied %d migrations, want %d", applied, len(entries))
+		}
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		repo := newPostgres(t, newDatabase(t, server))
+		p := domain.Payment{CorrelationID: "a", Amount: 10, RequestedAt: t0, Processor: "default"}
+		for range 2 {
+			if err := repo.Process(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p.Processor, p.Amount = "fallback", 20
+		if err := repo.ProcessBatch([]domain.Payment{p, {CorrelationID: "b", Amount: 1, RequestedAt: t0, Processor: "default"}}); err != nil {
+			t.Fatal(err)
+		}
+		s := all(repo)
+		if s.Default.TotalRequests != 1 || s.Fallback.TotalRequests != 1 || s.Fallback.TotalAmount != 20 {
+			t.Errorf("summary = %+v", s)
+		}
+		// O mesmo id duas vezes no lote não pode quebrar o upsert
+		if err := repo.ProcessBatch([]domain.Payment{p, p}); err != nil {
+			t.Fatal(err)
+		}
+		if n := requests(all(repo)); n != 2 {
+			t.Errorf("after duplicated batch = %d, want 2", n)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repo := newPostgres(t, newDatabase(t, server))
+		n := 95
+		seedPostgres(t, repo, n)
+		var got []string
+		cursor := ""
+		for page := 0; ; page++ {
+			payments, next, err := repo.ListPayments(domain.PaymentFilter{}, cursor, 7+page*11)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range payments {
+				got = append(got, p.CorrelationID)
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if len(got) != n || !slices.IsSorted(got) {
+			t.Errorf("listed %d in order %v", len(got), slices.IsSorted(got))
+		}
+		fallback, _, err := repo.ListPayments(domain.PaymentFilter{From: t0.Add(10 * time.Second), To: t0.Add(13 * time.Second), Processor: "fallback"}, "", 10)
+		if err != nil || len(fallback) != 2 || fallback[0].CorrelationID != "id-0011" {
+			t.Errorf("filtered = %+v, %v", fallback, err)
+		}
+		if _, _, err := repo.ListPayments(domain.PaymentFilter{}, "x", 10); err != ErrInvalidCursor {
+			t.Errorf("bad cursor: %v", err)
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		repo := newPostgres(t, newDatabase(t, server))
+		n := 20
+		seedPostgres(t, repo, n)
+		half := domain.PaymentFilter{To: t0.Add(time.Duration(n/2-1) * time.Second)}
+
+		dry, err := repo.Purge(domain.PurgeFilter{PaymentFilter: half, DryRun: true, Archive: true})
+		if err != nil || requests(dry.PaymentSummary) != n/2 || requests(all(repo)) != n {
+			t.Fatalf("dry run = %+v, %v", dry, err)
+		}
+		archived, err := repo.Purge(domain.PurgeFilter{PaymentFilter: half, Archive: true})
+		if err != nil || !archived.Archived || requests(archived.PaymentSummary) != n/2 || requests(all(repo)) != n-n/2 {
+			t.Fatalf("archive = %+v, %v", archived, err)
+		}
+		restored, err := repo.Restore(domain.PurgeFilter{PaymentFilter: domain.PaymentFilter{Processor: "fallback"}})
+		if err != nil || restored.Default.TotalRequests != 0 || restored.Fallback.TotalRequests != n/4 {
+			t.Fatalf("restore = %+v, %v", restored, err)
+		}
+		deleted, err := repo.Purge(domain.PurgeFilter{})
+		if err != nil || requests(deleted.PaymentSummary) != n-n/2+n/4 || requests(all(repo)) != 0 {
+			t.Fatalf("purge = %+v, %v", deleted, err)
+		}
+		var left int
+		if err := repo.pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM `+archiveTable).Scan(&left); err != nil || left != n/2-n/4 {
+			t.Errorf("archive has %d, want %d (%v)", left, n/2-n/4, err)
+		}
+	})
+}
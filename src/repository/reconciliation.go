@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const unknownKey = "payments:unknown"
+
+func NewRedisReconciliationRepository(client *redis.Client) ReconciliationRepository {
+	return &redisReconciliationRepository{client}
+}
+
+// ReconciliationRepository guarda os pagamentos cujo resultado no processor
+// é desconhecido até que o reconciliador descubra o que aconteceu.
+type ReconciliationRepository interface {
+	MarkUnknown(req domain.PaymentRequest) error
+	ListUnknown() ([]UnknownPayment, error)
+	// Claim tira u da lista se ela ainda estiver como foi lida. Só quem
+	// recebe true pode reenviar o pagamento: outra instância (ou uma marcação
+	// mais nova do mesmo id) faz o Claim falhar.
+	Claim(u UnknownPayment) (bool, error)
+	// Release devolve à lista um pagamento obtido com Claim, se nada o
+	// marcou de novo nesse meio tempo.
+	Release(u UnknownPayment) error
+}
+
+// UnknownPayment é um pagamento com resultado desconhecido e o instante em
+// que foi marcado. Entradas antigas, sem markedAt, ficam com o zero.
+type UnknownPayment struct {
+	domain.PaymentRequest
+	MarkedAt time.Time `json:"markedAt"`
+	raw      string
+}
+
+type redisReconciliationRepository struct {
+	client *redis.Client
+}
+
+func (r *redisReconciliationRepository) MarkUnknown(req domain.PaymentRequest) error {
+	data, err := json.Marshal(UnknownPayment{PaymentRequest: req, MarkedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(context.Background(), unknownKey, req.CorrelationID, data).Err()
+}
+
+func (r *redisReconciliationRepository) ListUnknown() ([]UnknownPayment, error) {
+	values, err := r.client.HVals(context.Background(), unknownKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	unknowns := make([]UnknownPayment, 0, len(values))
+	for _, val := range values {
+		var u UnknownPayment
+		if err := json.Unmarshal([]byte(val), &u); err != nil {
+			continue
+		}
+		u.raw = val
+		unknowns = append(unknowns, u)
+	}
+	return unknowns, nil
+}
+
+// claimScript apaga o campo só se o valor ainda for o lido em ListUnknown.
+var claimScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0`)
+
+func (r *redisReconciliationRepository) Claim(u UnknownPayment) (bool, error) {
+	n, err := claimScript.Run(context.Background(), r.client, []string{unknownKey}, u.CorrelationID, u.raw).Int()
+	return n == 1, err
+}
+
+func (r *redisReconciliationRepository) Release(u UnknownPayment) error {
+	return r.client.HSetNX(context.Background(), unknownKey, u.CorrelationID, u.raw).Err()
+}
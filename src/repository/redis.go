@@ -2,10 +2,13 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alexsandroveiga/rdb25/src/codec"
 	"github.com/alexsandroveiga/rdb25/src/domain"
 	"github.com/redis/go-redis/v9"
 )
@@ -17,30 +20,34 @@ func NewRedisPaymentRepository(client *redis.Client) RedisPaymentRepository {
 type RedisPaymentRepository interface {
 	Process(p domain.Payment) error
 	GetSummary(from, to time.Time) (domain.PaymentSummary, error)
-	Purge() error
+	Payments(from, to time.Time) ([]domain.Payment, error)
+	ListPayments(filter domain.PaymentFilter, cursor string, limit int) ([]domain.Payment, string, error)
+	EachPayment(filter domain.PaymentFilter, fn func(domain.Payment) error) error
+	Purge(filter domain.PurgeFilter) (domain.PurgeResult, error)
+	Restore(filter domain.PurgeFilter) (domain.PurgeResult, error)
 }
 
+// BatchProcessor é implementado pelos repositórios que gravam vários
+// pagamentos de uma vez mais barato que um Process por pagamento.
+type BatchProcessor interface {
+	ProcessBatch(payments []domain.Payment) error
+}
+
+const (
+	paymentPrefix = "payment:"
+	archivePrefix = "payment_archive:"
+	// batchSize é quantas chaves vão em cada SCAN/MGET/UNLINK.
+	batchSize = 500
+)
+
 type redisPaymentRepository struct {
 	client *redis.Client
 }
 
+// GetSummary soma lote a lote do SCAN, sem carregar todos os pagamentos.
 func (r *redisPaymentRepository) GetSummary(from time.Time, to time.Time) (domain.PaymentSummary, error) {
 	var summary domain.PaymentSummary
-	ctx := context.Background()
-	iter := r.client.Scan(ctx, 0, "payment:*", 0).Iterator()
-	for iter.Next(ctx) {
-		key := iter.Val()
-		val, err := r.client.Get(ctx, key).Result()
-		if err != nil {
-			continue
-		}
-		var p domain.Payment
-		if err := json.Unmarshal([]byte(val), &p); err != nil {
-			continue
-		}
-		if p.RequestedAt.Before(from) || p.RequestedAt.After(to) {
-			continue
-		}
+	err := r.EachPayment(domain.PaymentFilter{From: from, To: to}, func(p domain.Payment) error {
 		if p.Processor == "fallback" {
 			summary.Fallback.TotalAmount += p.Amount
 			summary.Fallback.TotalRequests++
@@ -48,28 +55,255 @@ func (r *redisPaymentRepository) GetSummary(from time.Time, to time.Time) (domai
 			summary.Default.TotalAmount += p.Amount
 			summary.Default.TotalRequests++
 		}
+		return nil
+	})
+	return summary, err
+}
+
+// Payments devolve os pagamentos gravados com requestedAt entre from e to.
+func (r *redisPaymentRepository) Payments(from, to time.Time) ([]domain.Payment, error) {
+	var payments []domain.Payment
+	err := r.EachPayment(domain.PaymentFilter{From: from, To: to}, func(p domain.Payment) error {
+		payments = append(payments, p)
+		return nil
+	})
+	return payments, err
+}
+
+// ListPayments devolve até limit pagamentos que batem com filter, a partir
+// de cursor ("" na primeira página), na ordem do SCAN: não é a ordem de
+// requestedAt, diferente do storage em arquivo e do Postgres. O cursor
+// devolvido guarda a posição do SCAN e quantos itens do lote já foram
+// entregues; volta "" na última página. O SCAN usa sempre COUNT batchSize,
+// para que repetir a posição traga o mesmo lote mesmo se o limit mudar entre
+// as páginas.
+func (r *redisPaymentRepository) ListPayments(filter domain.PaymentFilter, cursor string, limit int) ([]domain.Payment, string, error) {
+	ctx := context.Background()
+	scan, skip, err := parseCursor(cursor)
+	if err != nil {
+		return nil, "", err
 	}
-	if err := iter.Err(); err != nil {
-		return domain.PaymentSummary{}, err
+	var page []domain.Payment
+	for {
+		batch, next, err := r.scanPage(ctx, scan, batchSize, filter)
+		if err != nil {
+			return nil, "", err
+		}
+		rest := batch[min(skip, len(batch)):]
+		if need := limit - len(page); len(rest) > need {
+			page = append(page, rest[:need]...)
+			return page, fmt.Sprintf("%d.%d", scan, skip+need), nil
+		}
+		page = append(page, rest...)
+		scan, skip = next, 0
+		if scan == 0 {
+			return page, "", nil
+		}
+		if len(page) == limit {
+			return page, strconv.FormatUint(scan, 10), nil
+		}
 	}
-	return summary, nil
 }
 
-func (r *redisPaymentRepository) Process(p domain.Payment) error {
-	data, err := json.Marshal(p)
+// ErrInvalidCursor indica um cursor que não foi gerado por ListPayments.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func parseCursor(cursor string) (scan uint64, skip int, err error) {
+	if cursor == "" {
+		return 0, 0, nil
+	}
+	scanPart, skipPart, hasSkip := strings.Cut(cursor, ".")
+	if scan, err = strconv.ParseUint(scanPart, 10, 64); err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	if hasSkip {
+		if skip, err = strconv.Atoi(skipPart); err != nil || skip < 0 {
+			return 0, 0, ErrInvalidCursor
+		}
+	}
+	return scan, skip, nil
+}
+
+// EachPayment chama fn para cada pagamento que bate com filter, lendo o Redis
+// em lotes em vez de carregar tudo na memória. Um erro de fn interrompe a
+// varredura e é devolvido.
+func (r *redisPaymentRepository) EachPayment(filter domain.PaymentFilter, fn func(domain.Payment) error) error {
+	ctx := context.Background()
+	var cursor uint64
+	for {
+		batch, next, err := r.scanPage(ctx, cursor, batchSize, filter)
+		if err != nil {
+			return err
+		}
+		for _, p := range batch {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// scanPage faz um SCAN a partir de cursor e um MGET das chaves devolvidas.
+func (r *redisPaymentRepository) scanPage(ctx context.Context, cursor uint64, count int64, filter domain.PaymentFilter) ([]domain.Payment, uint64, error) {
+	keys, next, err := r.client.Scan(ctx, cursor, paymentPrefix+"*", count).Result()
+	if err != nil || len(keys) == 0 {
+		return nil, next, err
+	}
+	vals, err := r.client.MGet(ctx, keys...).Result()
 	if err != nil {
+		return nil, 0, err
+	}
+	payments := make([]domain.Payment, 0, len(vals))
+	for _, v := range vals {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var p domain.Payment
+		if err := codec.DecodePayment([]byte(raw), &p, false); err != nil || !filter.Matches(p) {
+			continue
+		}
+		payments = append(payments, p)
+	}
+	return payments, next, nil
+}
+
+func (r *redisPaymentRepository) Process(p domain.Payment) error {
+	buf := codec.GetBuffer()
+	defer codec.PutBuffer(buf)
+	var err error
+	if *buf, err = codec.AppendPayment(*buf, p); err != nil {
 		return err
 	}
-	return r.client.Set(context.Background(), fmt.Sprintf("payment:%s", p.CorrelationID), data, 0).Err()
+	return r.client.Set(context.Background(), paymentPrefix+p.CorrelationID, *buf, 0).Err()
 }
 
-func (r *redisPaymentRepository) Purge() error {
+// ProcessBatch grava vários pagamentos num só pipeline: uma ida ao Redis em
+// vez de uma por SET. Não é transacional; um erro pode deixar parte gravada,
+// o que é seguro porque reprocessar um pagamento sobrescreve a mesma chave.
+func (r *redisPaymentRepository) ProcessBatch(payments []domain.Payment) error {
 	ctx := context.Background()
-	iter := r.client.Scan(ctx, 0, "payment:*", 0).Iterator()
-	for iter.Next(ctx) {
-		if err := r.client.Del(ctx, iter.Val()).Err(); err != nil {
+	buf := codec.GetBuffer()
+	defer codec.PutBuffer(buf)
+	pipe := r.client.Pipeline()
+	for _, p := range payments {
+		var err error
+		if *buf, err = codec.AppendPayment((*buf)[:0], p); err != nil {
 			return err
 		}
+		// O pipeline guarda o valor até o Exec, então cada um precisa da própria cópia
+		pipe.Set(ctx, paymentPrefix+p.CorrelationID, string(*buf), 0)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Purge remove (ou, com filter.Archive, move para o arquivo) os pagamentos
+// que batem com filter. Removidos, levam junto o estado (GET
+// /payments/:correlationId); arquivados, o estado fica até expirar. Não é
+// atômico: veja move.
+func (r *redisPaymentRepository) Purge(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	if filter.Archive {
+		return r.move(paymentPrefix, archivePrefix, filter)
+	}
+	return r.move(paymentPrefix, "", filter)
+}
+
+// Restore devolve do arquivo os pagamentos que batem com filter.
+func (r *redisPaymentRepository) Restore(filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	return r.move(archivePrefix, paymentPrefix, filter)
+}
+
+// moveScript move uma chave só se ela ainda tiver o valor lido no SCAN: um
+// pagamento regravado no meio do purge fica onde está. Com ARGV[2] "delete"
+// a chave é apagada junto com o estado do pagamento (KEYS[2] e KEYS[3]); com
+// "move" ela vai para KEYS[2].
+var moveScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == 'move' then
+	redis.call('SET', KEYS[2], ARGV[1])
+	redis.call('UNLINK', KEYS[1])
+else
+	redis.call('UNLINK', KEYS[1], KEYS[2], KEYS[3])
+end
+return 1`)
+
+// move leva as chaves src* que batem com filter para dst* (ou só as apaga,
+// com dst vazio), um lote do SCAN por vez, com um pipeline por lote. Cada
+// chave é movida atomicamente, mas o conjunto não: pagamentos gravados
+// durante a varredura podem ficar de fora e um erro no meio deixa os lotes
+// anteriores já movidos. O resultado conta só o que de fato saiu.
+func (r *redisPaymentRepository) move(src, dst string, filter domain.PurgeFilter) (domain.PurgeResult, error) {
+	result := domain.PurgeResult{DryRun: filter.DryRun, Archived: dst == archivePrefix}
+	ctx := context.Background()
+	if !filter.DryRun {
+		if err := moveScript.Load(ctx, r.client).Err(); err != nil {
+			return result, err
+		}
+	}
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, src+"*", batchSize).Result()
+		if err != nil {
+			return result, err
+		}
+		if len(keys) > 0 {
+			if err := r.moveBatch(ctx, keys, src, dst, filter, &result); err != nil {
+				return result, err
+			}
+		}
+		if next == 0 {
+			return result, nil
+		}
+		cursor = next
+	}
+}
+
+func (r *redisPaymentRepository) moveBatch(ctx context.Context, keys []string, src, dst string, filter domain.PurgeFilter, result *domain.PurgeResult) error {
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return err
+	}
+	pipe := r.client.Pipeline()
+	var moved []*redis.Cmd
+	var payments []domain.Payment
+	for i, v := range vals {
+		raw, ok := v.(string)
+		if !ok {
+			continue // apagada depois do SCAN
+		}
+		var p domain.Payment
+		if err := codec.DecodePayment([]byte(raw), &p, false); err != nil || !filter.Matches(p) {
+			continue
+		}
+		if filter.DryRun {
+			result.Add(p)
+			continue
+		}
+		if dst == "" {
+			moveKeys := []string{keys[i], statusKey(p.CorrelationID), historyKey(p.CorrelationID)}
+			moved = append(moved, moveScript.EvalSha(ctx, pipe, moveKeys, raw, "delete"))
+		} else {
+			moveKeys := []string{keys[i], dst + strings.TrimPrefix(keys[i], src)}
+			moved = append(moved, moveScript.EvalSha(ctx, pipe, moveKeys, raw, "move"))
+		}
+		payments = append(payments, p)
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	_, err = pipe.Exec(ctx)
+	// Mesmo com erro, parte do lote pode ter saído
+	for i, cmd := range moved {
+		if n, _ := cmd.Int(); n == 1 {
+			result.Add(payments[i])
+		}
 	}
-	return iter.Err()
+	return err
 }
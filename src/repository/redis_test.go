@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedis(t *testing.T) (*redis.Client, RedisPaymentRepository) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, NewRedisPaymentRepository(client)
+}
+
+var t0 = time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC)
+
+// seed grava n pagamentos, um por segundo a partir de t0, alternando os processors.
+func seed(t *testing.T, repo RedisPaymentRepository, n int) {
+	t.Helper()
+	for i := range n {
+		processor := "default"
+		if i%2 == 1 {
+			processor = "fallback"
+		}
+		p := domain.Payment{CorrelationID: fmt.Sprintf("id-%04d", i), Amount: 1, RequestedAt: t0.Add(time.Duration(i) * time.Second), Processor: processor}
+		if err := repo.Process(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func requests(s domain.PaymentSummary) int {
+	return s.Default.TotalRequests + s.Fallback.TotalRequests
+}
+
+// TestRedisMove passa de um lote do SCAN para conferir o move em lotes.
+func TestRedisMove(t *testing.T) {
+	client, repo := newRedis(t)
+	n := 2*batchSize + 7
+	seed(t, repo, n)
+	half := domain.PaymentFilter{To: t0.Add(time.Duration(n/2-1) * time.Second)}
+
+	dry, err := repo.Purge(domain.PurgeFilter{PaymentFilter: half, DryRun: true, Archive: true})
+	if err != nil || requests(dry.PaymentSummary) != n/2 {
+		t.Fatalf("dry run = %+v, %v", dry, err)
+	}
+	if s, _ := repo.GetSummary(time.Time{}, t0.Add(time.Hour)); requests(s) != n {
+		t.Fatalf("dry run removed payments: %+v", s)
+	}
+
+	archived, err := repo.Purge(domain.PurgeFilter{PaymentFilter: half, Archive: true})
+	if err != nil || requests(archived.PaymentSummary) != n/2 || !archived.Archived {
+		t.Fatalf("archive = %+v, %v", archived, err)
+	}
+	if s, _ := repo.GetSummary(time.Time{}, t0.Add(time.Hour)); requests(s) != n-n/2 {
+		t.Fatalf("after archive = %+v", s)
+	}
+
+	restored, err := repo.Restore(domain.PurgeFilter{PaymentFilter: domain.PaymentFilter{Processor: "fallback"}})
+	if err != nil || restored.Default.TotalRequests != 0 || restored.Fallback.TotalRequests != n/4 {
+		t.Fatalf("restore = %+v, %v", restored, err)
+	}
+
+	deleted, err := repo.Purge(domain.PurgeFilter{})
+	if err != nil || requests(deleted.PaymentSummary) != n-n/2+n/4 {
+		t.Fatalf("purge = %+v, %v", deleted, err)
+	}
+	if keys, _ := client.Keys(context.Background(), paymentPrefix+"*").Result(); len(keys) != 0 {
+		t.Errorf("%d payments left", len(keys))
+	}
+	if keys, _ := client.Keys(context.Background(), archivePrefix+"*").Result(); len(keys) != n/2-n/4 {
+		t.Errorf("archive has %d, want %d", len(keys), n/2-n/4)
+	}
+}
+
+// TestMoveScriptSkipsChanged confere que uma chave regravada depois da
+// leitura não é movida.
+func TestMoveScriptSkipsChanged(t *testing.T) {
+	client, _ := newRedis(t)
+	ctx := context.Background()
+	client.Set(ctx, "payment:a", "new", 0)
+	moved, err := moveScript.Run(ctx, client, []string{"payment:a", "payment_archive:a"}, "old", "move").Int()
+	if err != nil || moved != 0 {
+		t.Fatalf("moved = %d, %v", moved, err)
+	}
+	if v, _ := client.Get(ctx, "payment:a").Result(); v != "new" {
+		t.Errorf("payment:a = %q", v)
+	}
+	moved, err = moveScript.Run(ctx, client, []string{"payment:a", "payment_archive:a"}, "new", "move").Int()
+	if err != nil || moved != 1 {
+		t.Fatalf("moved = %d, %v", moved, err)
+	}
+	if v, _ := client.Get(ctx, "payment_archive:a").Result(); v != "new" {
+		t.Errorf("payment_archive:a = %q", v)
+	}
+}
+
+// TestRedisListPayments pagina com limits diferentes a cada página: o cursor
+// não pode depender do limit.
+func TestRedisListPayments(t *testing.T) {
+	_, repo := newRedis(t)
+	n := batchSize + 50
+	seed(t, repo, n)
+	seen := make(map[string]bool)
+	cursor := ""
+	for page := 0; ; page++ {
+		payments, next, err := repo.ListPayments(domain.PaymentFilter{}, cursor, 7+page*31)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range payments {
+			if seen[p.CorrelationID] {
+				t.Fatalf("%s repeated", p.CorrelationID)
+			}
+			seen[p.CorrelationID] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != n {
+		t.Errorf("listed %d, want %d", len(seen), n)
+	}
+	if _, _, err := repo.ListPayments(domain.PaymentFilter{}, "x", 10); err != ErrInvalidCursor {
+		t.Errorf("bad cursor: %v", err)
+	}
+}
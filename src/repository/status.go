@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// statusTTL é quanto o estado de um pagamento fica no Redis depois da última
+// transição.
+const statusTTL = 24 * time.Hour
+
+func NewRedisStatusRepository(client *redis.Client) StatusRepository {
+	return &redisStatusRepository{client}
+}
+
+type StatusRepository interface {
+	Transition(correlationID string, to domain.PaymentState, processor string) error
+	Get(correlationID string) (domain.PaymentStatus, bool, error)
+	Attempts(correlationIDs []string) (map[string]int, error)
+}
+
+type redisStatusRepository struct {
+	client *redis.Client
+}
+
+// O estado fica num hash e o histórico numa lista à parte, para a transição
+// ser um script só, sem ler e regravar o JSON inteiro com WATCH.
+func statusKey(correlationID string) string {
+	return fmt.Sprintf("payment_status:%s", correlationID)
+}
+
+func historyKey(correlationID string) string {
+	return fmt.Sprintf("payment_status_history:%s", correlationID)
+}
+
+// transitionScript aplica a transição se o estado atual for um dos estados
+// de origem permitidos (ARGV[6] em diante) e devolve {aplicou, estado atual}.
+// Um estado no formato antigo (JSON numa string) é descartado.
+var transitionScript = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok == 'string' then
+	redis.call('DEL', KEYS[1])
+end
+local from = redis.call('HGET', KEYS[1], 'state') or ''
+local allowed = false
+for i = 6, #ARGV do
+	if ARGV[i] == from then
+		allowed = true
+		break
+	end
+end
+if not allowed then
+	return {0, from}
+end
+if from == '' then
+	redis.call('HSET', KEYS[1], 'createdAt', ARGV[3])
+end
+if ARGV[5] == '1' then
+	redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+end
+if ARGV[2] ~= '' then
+	redis.call('HSET', KEYS[1], 'processor', ARGV[2])
+end
+redis.call('HSET', KEYS[1], 'state', ARGV[1], 'updatedAt', ARGV[3])
+redis.call('RPUSH', KEYS[2], cjson.encode({from = from, to = ARGV[1], processor = ARGV[2], at = ARGV[3]}))
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+return {1, from}`)
+
+func (r *redisStatusRepository) Get(correlationID string) (domain.PaymentStatus, bool, error) {
+	ctx := context.Background()
+	status := domain.PaymentStatus{CorrelationID: correlationID}
+	var fields *redis.MapStringStringCmd
+	var history *redis.StringSliceCmd
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(ctx, statusKey(correlationID))
+		history = pipe.LRange(ctx, historyKey(correlationID), 0, -1)
+		return nil
+	})
+	if err != nil {
+		return status, false, err
+	}
+	f := fields.Val()
+	if f["state"] == "" {
+		return status, false, nil
+	}
+	status.State = domain.PaymentState(f["state"])
+	status.Processor = f["processor"]
+	status.Attempts, _ = strconv.Atoi(f["attempts"])
+	status.CreatedAt, _ = time.Parse(time.RFC3339Nano, f["createdAt"])
+	status.UpdatedAt, _ = time.Parse(time.RFC3339Nano, f["updatedAt"])
+	status.History = make([]domain.StateTransition, 0, len(history.Val()))
+	for _, raw := range history.Val() {
+		var t domain.StateTransition
+		if err := json.Unmarshal([]byte(raw), &t); err != nil {
+			return status, false, err
+		}
+		status.History = append(status.History, t)
+	}
+	return status, true, nil
+}
+
+// Transition aplica a transição no Redis numa ida só: o script confere o
+// estado atual e grava o novo atomicamente.
+func (r *redisStatusRepository) Transition(correlationID string, to domain.PaymentState, processor string) error {
+	inFlight := "0"
+	if to == domain.StateInFlight {
+		inFlight = "1"
+	}
+	args := []any{string(to), processor, time.Now().UTC().Format(time.RFC3339Nano), int(statusTTL.Seconds()), inFlight}
+	for _, from := range to.Sources() {
+		args = append(args, string(from))
+	}
+	res, err := transitionScript.Run(context.Background(), r.client, []string{statusKey(correlationID), historyKey(correlationID)}, args...).Slice()
+	if err != nil {
+		return err
+	}
+	if applied, _ := res[0].(int64); applied != 1 {
+		return fmt.Errorf("%w: %v -> %s", domain.ErrInvalidTransition, res[1], to)
+	}
+	return nil
+}
+
+// Attempts devolve quantas vezes cada pagamento foi enviado. Pagamentos sem
+// estado registrado ficam de fora do mapa.
+func (r *redisStatusRepository) Attempts(correlationIDs []string) (map[string]int, error) {
+	ctx := context.Background()
+	attempts := make(map[string]int, len(correlationIDs))
+	for batch := range slices.Chunk(correlationIDs, 500) {
+		cmds := make([]*redis.SliceCmd, len(batch))
+		_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, id := range batch {
+				cmds[i] = pipe.HMGet(ctx, statusKey(id), "state", "attempts")
+			}
+			return nil
+		})
+		// Erro de um comando (um estado no formato antigo) só tira aquele do mapa
+		var cmdErr redis.Error
+		if err != nil && !errors.As(err, &cmdErr) {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			vals := cmd.Val()
+			if len(vals) != 2 || vals[0] == nil {
+				continue
+			}
+			raw, _ := vals[1].(string)
+			attempts[batch[i]], _ = strconv.Atoi(raw)
+		}
+	}
+	return attempts, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+func TestRedisStatusTransition(t *testing.T) {
+	client, _ := newRedis(t)
+	statuses := NewRedisStatusRepository(client)
+	ctx := context.Background()
+
+	steps := []struct {
+		to        domain.PaymentState
+		processor string
+		invalid   bool
+	}{
+		{domain.StatePending, "", false},
+		{domain.StateInFlight, "", false},
+		{domain.StateRetrying, "", false},
+		{domain.StatePending, "", true},
+		{domain.StateInFlight, "", false},
+		{domain.StateCompleted, "fallback", false},
+		{domain.StateFailed, "", true},
+	}
+	for _, step := range steps {
+		err := statuses.Transition("a", step.to, step.processor)
+		if step.invalid != errors.Is(err, domain.ErrInvalidTransition) || (!step.invalid && err != nil) {
+			t.Fatalf("-> %s: %v", step.to, err)
+		}
+	}
+	status, found, err := statuses.Get("a")
+	if err != nil || !found {
+		t.Fatalf("get = %v, %v", found, err)
+	}
+	if status.State != domain.StateCompleted || status.Processor != "fallback" || status.Attempts != 2 || len(status.History) != 5 {
+		t.Errorf("status = %+v", status)
+	}
+	if h := status.History[0]; h.From != "" || h.To != domain.StatePending || h.At.IsZero() {
+		t.Errorf("history[0] = %+v", h)
+	}
+	if status.CreatedAt.IsZero() || status.UpdatedAt.Before(status.CreatedAt) {
+		t.Errorf("times = %v, %v", status.CreatedAt, status.UpdatedAt)
+	}
+	for _, key := range []string{statusKey("a"), historyKey("a")} {
+		if ttl := client.TTL(ctx, key).Val(); ttl <= 0 || ttl > statusTTL {
+			t.Errorf("TTL(%s) = %v", key, ttl)
+		}
+	}
+
+	attempts, err := statuses.Attempts([]string{"a", "missing"})
+	if err != nil || len(attempts) != 1 || attempts["a"] != 2 {
+		t.Errorf("attempts = %v, %v", attempts, err)
+	}
+	if _, found, _ := statuses.Get("missing"); found {
+		t.Error("found a payment without status")
+	}
+}
+
+// TestRedisStatusLatePending: o worker pode chegar antes do pending gravado
+// pelo POST, que então é descartado.
+func TestRedisStatusLatePending(t *testing.T) {
+	client, _ := newRedis(t)
+	statuses := NewRedisStatusRepository(client)
+	if err := statuses.Transition("a", domain.StateInFlight, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := statuses.Transition("a", domain.StatePending, ""); !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Fatalf("late pending: %v", err)
+	}
+	if status, _, _ := statuses.Get("a"); status.State != domain.StateInFlight || status.Attempts != 1 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestRedisStatusOldFormat(t *testing.T) {
+	client, _ := newRedis(t)
+	statuses := NewRedisStatusRepository(client)
+	client.Set(context.Background(), statusKey("a"), `{"state":"completed"}`, 0)
+	if attempts, err := statuses.Attempts([]string{"a"}); err != nil || len(attempts) != 0 {
+		t.Errorf("attempts = %v, %v", attempts, err)
+	}
+	if err := statuses.Transition("a", domain.StatePending, ""); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, _ := statuses.Get("a"); status.State != domain.StatePending {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+// TestRedisPurgeStatus confere que o purge leva o estado junto e o arquivo não.
+func TestRedisPurgeStatus(t *testing.T) {
+	client, repo := newRedis(t)
+	statuses := NewRedisStatusRepository(client)
+	seed(t, repo, 2)
+	for _, id := range []string{"id-0000", "id-0001"} {
+		statuses.Transition(id, domain.StateInFlight, "")
+	}
+	archive := domain.PurgeFilter{PaymentFilter: domain.PaymentFilter{To: t0}, Archive: true}
+	if _, err := repo.Purge(archive); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Purge(domain.PurgeFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := statuses.Get("id-0000"); !found {
+		t.Error("archived payment lost its status")
+	}
+	if _, found, _ := statuses.Get("id-0001"); found {
+		t.Error("purged payment kept its status")
+	}
+	if n := client.Exists(context.Background(), historyKey("id-0001")).Val(); n != 0 {
+		t.Error("purged payment kept its history")
+	}
+}
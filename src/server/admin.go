@@ -0,0 +1,252 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/alexsandroveiga/rdb25/src/admission"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/util"
+	"github.com/alexsandroveiga/rdb25/src/webhook"
+)
+
+// AdminTokenHeader é o mesmo header usado pela API administrativa dos processors.
+const AdminTokenHeader = "X-Rinha-Token"
+
+// Scope diz nas respostas até onde um comando vale. Fila, pausa e override
+// ficam em memória (ProcessScope): com várias instâncias ou prefork cada
+// processo precisa receber o comando. O cache de health fica no Redis
+// (SharedScope) e vale para todos.
+const (
+	ProcessScope = "process"
+	SharedScope  = "shared"
+)
+
+// instance identifica o processo que atendeu, para quem precisa saber quais
+// já receberam o comando.
+var instance = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}()
+
+// workerControl é o estado de pausa e override deste processo.
+type workerControl struct {
+	Paused   bool   `json:"paused"`
+	Override string `json:"override"`
+	Scope    string `json:"scope"`
+	Instance string `json:"instance"`
+}
+
+type queueInfo struct {
+	admission.Stats
+	workerControl
+	// OutboxPending é quantos bytes do outbox ainda não chegaram ao Redis.
+	OutboxPending int64 `json:"outboxPending,omitempty"`
+	// EventsDropped é quantos eventos do stream o relay descartou com a fila
+	// cheia.
+	EventsDropped uint64 `json:"eventsDropped,omitempty"`
+}
+
+type overrideRequest struct {
+	Processor string `json:"processor"`
+}
+
+func (s *Server) adminRoutes() []transport.Route {
+	return []transport.Route{
+		{Method: http.MethodPost, Path: "/admin/purge-payments", Handler: s.admin("purge", s.handlePurge)},
+		{Method: http.MethodPost, Path: "/admin/restore-payments", Handler: s.admin("restore", s.handleRestore)},
+		{Method: http.MethodGet, Path: "/admin/queue", Handler: s.admin("", s.handleQueue)},
+		{Method: http.MethodPost, Path: "/admin/workers/pause", Handler: s.admin("pause workers", s.handlePause)},
+		{Method: http.MethodPost, Path: "/admin/workers/resume", Handler: s.admin("resume workers", s.handleResume)},
+		{Method: http.MethodPut, Path: "/admin/processor-override", Handler: s.admin("processor override", s.handleOverride)},
+		{Method: http.MethodPost, Path: "/admin/health/invalidate", Handler: s.admin("invalidate health", s.handleInvalidateHealth)},
+		{Method: http.MethodGet, Path: "/admin/webhooks/deliveries", Handler: s.admin("", s.handleWebhookDeliveries)},
+		{Method: http.MethodGet, Path: "/admin/webhooks/deliveries/:id", Handler: s.admin("", s.handleWebhookDelivery)},
+	}
+}
+
+// admin exige o token e registra no log toda ação que altera estado (action
+// vazio para consultas).
+func (s *Server) admin(action string, next transport.Handler) transport.Handler {
+	return func(r transport.Request) transport.Response {
+		token := r.Header(AdminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminToken)) != 1 {
+			log.Printf("🛡 admin: token inválido em %s %s", r.Method(), r.Path())
+			return transport.Error(http.StatusUnauthorized, "invalid token")
+		}
+		resp := next(r)
+		if action != "" {
+			body := r.Body()
+			if len(body) > 256 {
+				body = body[:256]
+			}
+			log.Printf("🛡 admin: %s ?%s %q -> %d", action, r.RawQuery(), body, resp.Status)
+		}
+		return resp
+	}
+}
+
+// handlePurge aceita from, to, processor, dryRun e archive na query string.
+// Sem filtros apaga tudo, como antes.
+func (s *Server) handlePurge(r transport.Request) transport.Response {
+	filter, err := parsePurgeFilter(r)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	result, err := s.payments.Purge(filter)
+	if err != nil {
+		return transport.Error(http.StatusBadGateway, err.Error())
+	}
+	return transport.JSON(http.StatusOK, result)
+}
+
+// handleLegacyPurge mantém o POST /purge-payments de antes da API
+// administrativa: apaga tudo e responde 204, agora exigindo o token.
+func (s *Server) handleLegacyPurge(r transport.Request) transport.Response {
+	if _, err := s.payments.Purge(domain.PurgeFilter{}); err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	return transport.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleRestore(r transport.Request) transport.Response {
+	filter, err := parsePurgeFilter(r)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	filter.Archive = false
+	result, err := s.payments.Restore(filter)
+	if err != nil {
+		return transport.Error(http.StatusBadGateway, err.Error())
+	}
+	return transport.JSON(http.StatusOK, result)
+}
+
+func (s *Server) handleQueue(r transport.Request) transport.Response {
+	info := queueInfo{
+		Stats:         s.admission.Stats(),
+		workerControl: s.workerControl(),
+		EventsDropped: s.events.Dropped(),
+	}
+	if s.outbox != nil {
+		info.OutboxPending = s.outbox.Pending()
+	}
+	return transport.JSON(http.StatusOK, info)
+}
+
+func (s *Server) workerControl() workerControl {
+	return workerControl{
+		Paused:   s.worker.Paused(),
+		Override: s.worker.Override(),
+		Scope:    ProcessScope,
+		Instance: instance,
+	}
+}
+
+func (s *Server) handlePause(r transport.Request) transport.Response {
+	s.worker.Pause()
+	return transport.JSON(http.StatusOK, s.workerControl())
+}
+
+func (s *Server) handleResume(r transport.Request) transport.Response {
+	s.worker.Resume()
+	return transport.JSON(http.StatusOK, s.workerControl())
+}
+
+func (s *Server) handleOverride(r transport.Request) transport.Response {
+	var req overrideRequest
+	if err := json.Unmarshal(r.Body(), &req); err != nil {
+		return transport.Error(http.StatusBadRequest, "invalid body")
+	}
+	if err := s.worker.SetOverride(req.Processor); err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	return transport.JSON(http.StatusOK, s.workerControl())
+}
+
+func (s *Server) handleInvalidateHealth(r transport.Request) transport.Response {
+	names := []string{processor.Default, processor.Fallback}
+	if name := r.Query("processor"); name != "" {
+		if name != processor.Default && name != processor.Fallback {
+			return transport.Error(http.StatusBadRequest, "unknown processor")
+		}
+		names = []string{name}
+	}
+	for _, name := range names {
+		if err := util.InvalidateHealth(name); err != nil {
+			return transport.Error(http.StatusBadGateway, err.Error())
+		}
+	}
+	return transport.JSON(http.StatusOK, map[string]any{"invalidated": names, "scope": SharedScope})
+}
+
+func parsePurgeFilter(r transport.Request) (domain.PurgeFilter, error) {
+	var filter domain.PurgeFilter
+	var err error
+	if filter.PaymentFilter, err = parsePaymentFilter(r); err != nil {
+		return filter, err
+	}
+	if filter.DryRun, err = parseFlag(r.Query("dryRun")); err != nil {
+		return filter, errors.New("invalid dryRun")
+	}
+	if filter.Archive, err = parseFlag(r.Query("archive")); err != nil {
+		return filter, errors.New("invalid archive")
+	}
+	return filter, nil
+}
+
+func parseFlag(v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// handleWebhookDeliveries lista as entregas mais recentes (limit, padrão 50),
+// opcionalmente só as com status=pending|delivered|failed.
+func (s *Server) handleWebhookDeliveries(r transport.Request) transport.Response {
+	if s.webhooks == nil {
+		return transport.Error(http.StatusNotFound, "webhooks not configured")
+	}
+	status := r.Query("status")
+	switch status {
+	case "", webhook.Pending, webhook.Delivered, webhook.Failed:
+	default:
+		return transport.Error(http.StatusBadRequest, "invalid status")
+	}
+	limit := 50
+	if v := r.Query("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			return transport.Error(http.StatusBadRequest, "invalid limit")
+		}
+		limit = min(limit, 500)
+	}
+	deliveries, err := s.webhooks.Deliveries(status, limit)
+	if err != nil {
+		return transport.Error(http.StatusBadGateway, err.Error())
+	}
+	return transport.JSON(http.StatusOK, deliveries)
+}
+
+func (s *Server) handleWebhookDelivery(r transport.Request) transport.Response {
+	if s.webhooks == nil {
+		return transport.Error(http.StatusNotFound, "webhooks not configured")
+	}
+	delivery, found, err := s.webhooks.Delivery(r.Param("id"))
+	if err != nil {
+		return transport.Error(http.StatusBadGateway, err.Error())
+	}
+	if !found {
+		return transport.Error(http.StatusNotFound, "delivery not found")
+	}
+	return transport.JSON(http.StatusOK, delivery)
+}
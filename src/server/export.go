@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/codec"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type paymentPage struct {
+	Payments   []domain.Payment `json:"payments"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// handleListPayments pagina com cursor em JSON (padrão) ou, com
+// format=ndjson|csv, exporta o intervalo inteiro em stream. A ordem é a do
+// repositório: no Redis, a do SCAN, sem relação com requestedAt.
+func (s *Server) handleListPayments(r transport.Request) transport.Response {
+	filter, err := parsePaymentFilter(r)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	switch r.Query("format") {
+	case "", "json":
+	case "ndjson":
+		return transport.Stream(http.StatusOK, "application/x-ndjson", func(w *bufio.Writer) error {
+			return s.exportNDJSON(w, filter)
+		})
+	case "csv":
+		return transport.Stream(http.StatusOK, "text/csv", func(w *bufio.Writer) error {
+			return s.exportCSV(w, filter)
+		}).WithHeader("Content-Disposition", `attachment; filename="payments.csv"`)
+	default:
+		return transport.Error(http.StatusBadRequest, "invalid format, use json, ndjson or csv")
+	}
+
+	limit := defaultPageSize
+	if v := r.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			return transport.Error(http.StatusBadRequest, "invalid limit")
+		}
+		limit = min(limit, maxPageSize)
+	}
+	payments, next, err := s.payments.ListPayments(filter, r.Query("cursor"), limit)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return transport.Error(http.StatusBadGateway, err.Error())
+	}
+	page := paymentPage{Payments: payments}
+	if page.Payments == nil {
+		page.Payments = []domain.Payment{}
+	}
+	page.NextCursor = next
+	return transport.JSON(http.StatusOK, page)
+}
+
+func (s *Server) exportNDJSON(w *bufio.Writer, filter domain.PaymentFilter) error {
+	buf := codec.GetBuffer()
+	defer codec.PutBuffer(buf)
+	err := s.payments.EachPayment(filter, func(p domain.Payment) error {
+		var err error
+		if *buf, err = codec.AppendPayment((*buf)[:0], p); err != nil {
+			return err
+		}
+		*buf = append(*buf, '\n')
+		_, err = w.Write(*buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (s *Server) exportCSV(w *bufio.Writer, filter domain.PaymentFilter) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"correlationId", "amount", "requestedAt", "processor"})
+	err := s.payments.EachPayment(filter, func(p domain.Payment) error {
+		return cw.Write([]string{
+			p.CorrelationID,
+			strconv.FormatFloat(p.Amount, 'f', -1, 64),
+			p.RequestedAt.UTC().Format(time.RFC3339Nano),
+			p.Processor,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
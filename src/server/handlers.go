@@ -0,0 +1,274 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/admission"
+	"github.com/alexsandroveiga/rdb25/src/cluster"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/summary"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/validation"
+)
+
+func (s *Server) handleSummary(r transport.Request) transport.Response {
+	from, to, err := parseRange(r)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	opts, err := parseSummaryOptions(r)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	opts.Fees = s.config.Fees
+	settled := s.settle(to)
+	if opts.Extended() {
+		return s.extendedSummary(from, to, opts, settled)
+	}
+	if s.aggregator != nil {
+		summary := s.aggregator.Summary(from, to)
+		summary.Consistent = summary.Consistent && settled
+		return transport.JSON(http.StatusOK, summary)
+	}
+	summary, err := s.payments.GetSummary(from, to)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	if !settled {
+		return transport.JSON(http.StatusOK, summary).WithHeader("X-Summary-Consistent", "false")
+	}
+	return transport.JSON(http.StatusOK, summary)
+}
+
+// extendedSummary lê os pagamentos direto do repositório, que tem os de
+// todas as instâncias, inclusive no modo com peers. Soma lote a lote dentro do
+// EachPayment, buscando as tentativas de cada lote, sem carregar o intervalo
+// inteiro.
+func (s *Server) extendedSummary(from, to time.Time, opts summary.Options, settled bool) transport.Response {
+	builder := summary.NewBuilder(opts)
+	page := make([]domain.Payment, 0, summaryPage)
+	flush := func() error {
+		var attempts map[string]int
+		if opts.Details {
+			ids := make([]string, len(page))
+			for i, p := range page {
+				ids[i] = p.CorrelationID
+			}
+			var err error
+			if attempts, err = s.statuses.Attempts(ids); err != nil {
+				return err
+			}
+		}
+		for _, p := range page {
+			builder.Add(p, attempts[p.CorrelationID])
+		}
+		page = page[:0]
+		return nil
+	}
+	err := s.payments.EachPayment(domain.PaymentFilter{From: from, To: to}, func(p domain.Payment) error {
+		page = append(page, p)
+		if len(page) == summaryPage {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	resp := transport.JSON(http.StatusOK, builder.Report())
+	if !settled {
+		resp = resp.WithHeader("X-Summary-Consistent", "false")
+	}
+	return resp
+}
+
+// summaryPage é quantos pagamentos o resumo estendido junta antes de buscar
+// as tentativas deles.
+const summaryPage = 500
+
+func parseSummaryOptions(r transport.Request) (summary.Options, error) {
+	var opts summary.Options
+	switch r.Query("bucket") {
+	case "":
+	case "minute":
+		opts.Bucket = time.Minute
+	case "hour":
+		opts.Bucket = time.Hour
+	default:
+		return opts, errors.New("invalid bucket, use minute or hour")
+	}
+	if v := r.Query("details"); v != "" {
+		details, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, errors.New("invalid details")
+		}
+		opts.Details = details
+	}
+	return opts, nil
+}
+
+func (s *Server) handleLocalSummary(r transport.Request) transport.Response {
+	from, to, err := parseRange(r)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	s.settle(to)
+	resp := transport.JSON(http.StatusOK, s.aggregator.Local(from, to))
+	if !s.aggregator.Seeded() {
+		return resp.WithHeader(cluster.SeededHeader, "false")
+	}
+	return resp
+}
+
+// handleLocalPurge e handleLocalRestore recebem de um peer o purge ou restore
+// que ele já aplicou no Redis, para os totais desta instância acompanharem.
+func (s *Server) handleLocalPurge(r transport.Request) transport.Response {
+	var filter domain.PurgeFilter
+	if err := json.Unmarshal(r.Body(), &filter); err != nil {
+		return transport.Error(http.StatusBadRequest, "invalid filter")
+	}
+	s.aggregator.PurgeLocal(filter)
+	return transport.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleLocalRestore(r transport.Request) transport.Response {
+	var filter domain.PurgeFilter
+	if err := json.Unmarshal(r.Body(), &filter); err != nil {
+		return transport.Error(http.StatusBadRequest, "invalid filter")
+	}
+	s.aggregator.RestoreLocal(filter)
+	return transport.Status(http.StatusNoContent)
+}
+
+// settle aplica a barreira do resumo: com SUMMARY_BARRIER espera os
+// pagamentos já enviados até "to" serem gravados antes de somar.
+func (s *Server) settle(to time.Time) bool {
+	if s.config.SummaryBarrier <= 0 {
+		return true
+	}
+	deadline := time.Now().Add(s.config.SummaryBarrier)
+	if !s.worker.Settle(to, s.config.SummaryBarrier) {
+		log.Printf("⚠ Resumo até %s com pagamentos ainda em voo", to.Format(time.RFC3339Nano))
+		return false
+	}
+	// Com outbox, gravado pelo worker ainda não quer dizer que chegou ao Redis
+	if s.outbox != nil && !s.outbox.Wait(time.Until(deadline)) {
+		log.Printf("⚠ Resumo até %s com pagamentos ainda no outbox", to.Format(time.RFC3339Nano))
+		return false
+	}
+	return true
+}
+
+func (s *Server) handlePayment(r transport.Request) transport.Response {
+	if problem := validation.CheckContentType(r.Header("Content-Type")); problem != nil {
+		return transport.JSONType(problem.Status, problem, validation.ProblemContentType)
+	}
+	var req domain.PaymentRequest
+	if problem := validation.DecodePaymentRequest(r.Body(), &req, s.config.MaxAmount); problem != nil {
+		return transport.JSONType(problem.Status, problem, validation.ProblemContentType)
+	}
+	// O requestedAt é nosso: na admissão ou na primeira tentativa do worker
+	req.RequestedAt = ""
+	if s.config.StampAtAdmission {
+		req.Stamp(time.Now())
+	}
+	// Recusados não ganham estado: o cliente recebe o erro e pode reenviar o
+	// mesmo correlationId
+	switch s.admission.Admit(req) {
+	case admission.Admitted, admission.Spilled:
+		go s.recordPending(req.CorrelationID)
+		return transport.Status(http.StatusNoContent)
+	case admission.Shed:
+		return transport.Error(http.StatusTooManyRequests, "overloaded").
+			WithHeader("Retry-After", strconv.Itoa(s.admission.RetryAfter()))
+	default:
+		return transport.Error(http.StatusServiceUnavailable, "full queue").
+			WithHeader("Retry-After", strconv.Itoa(s.admission.RetryAfter()))
+	}
+}
+
+// recordPending grava o pending fora do caminho da resposta. Se o worker já
+// pegou o pagamento, o pending chega atrasado e é descartado.
+func (s *Server) recordPending(correlationID string) {
+	err := s.statuses.Transition(correlationID, domain.StatePending, "")
+	if err != nil && !errors.Is(err, domain.ErrInvalidTransition) {
+		log.Printf("⚠ Estado de %s não registrado: %v", correlationID, err)
+	}
+}
+
+func (s *Server) handleStatus(r transport.Request) transport.Response {
+	status, found, err := s.statuses.Get(r.Param("correlationId"))
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	if !found {
+		return transport.Error(http.StatusNotFound, "payment not found")
+	}
+	return transport.JSON(http.StatusOK, status)
+}
+
+func (s *Server) handleReconciliationReport(r transport.Request) transport.Response {
+	from, to, err := parseRange(r)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	report, err := s.reconciler.Report(from, to)
+	if err != nil {
+		return transport.Error(http.StatusBadRequest, err.Error())
+	}
+	return transport.JSON(http.StatusOK, report)
+}
+
+func parseRange(r transport.Request) (from, to time.Time, err error) {
+	fromStr := r.Query("from")
+	toStr := r.Query("to")
+	if fromStr == "" {
+		from = time.Time{} // zero time, início do tempo Go
+	} else {
+		from, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return from, to, errors.New("invalid from datetime")
+		}
+	}
+	if toStr == "" {
+		to = time.Now().UTC()
+	} else {
+		to, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return from, to, errors.New("invalid to datetime")
+		}
+	}
+	return from, to, nil
+}
+
+// parsePaymentFilter lê from, to e processor. Diferente de parseRange, sem to
+// não há limite superior.
+func parsePaymentFilter(r transport.Request) (domain.PaymentFilter, error) {
+	var filter domain.PaymentFilter
+	var err error
+	if v := r.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.New("invalid from datetime")
+		}
+	}
+	if v := r.Query("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.New("invalid to datetime")
+		}
+	}
+	switch filter.Processor = r.Query("processor"); filter.Processor {
+	case "", processor.Default, processor.Fallback:
+	default:
+		return filter, errors.New("unknown processor")
+	}
+	return filter, nil
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/admission"
+	"github.com/alexsandroveiga/rdb25/src/batch"
+	"github.com/alexsandroveiga/rdb25/src/cluster"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/events"
+	"github.com/alexsandroveiga/rdb25/src/messaging"
+	"github.com/alexsandroveiga/rdb25/src/outbox"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/reconciliation"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/util"
+	"github.com/alexsandroveiga/rdb25/src/validation"
+	"github.com/alexsandroveiga/rdb25/src/webhook"
+	"github.com/alexsandroveiga/rdb25/src/worker"
+)
+
+type Config struct {
+	Addr       string
+	Socket     string
+	SocketMode os.FileMode
+	Transport  string
+	Prefork    bool
+	QueueSize  int
+	Workers    int
+	BodyLimit  int
+	// MaxAmount é o maior amount aceito em POST /payments; zero usa
+	// validation.DefaultMaxAmount.
+	MaxAmount         float64
+	ReconcileInterval time.Duration
+	PeerTimeout       time.Duration
+	SummaryBarrier    time.Duration
+	StampAtAdmission  bool
+	// AdminToken protege a API administrativa; vazio, ela não é montada e só
+	// o /purge-payments antigo fica de pé, sem token. Os docker-compose usam
+	// "123", o mesmo padrão do -token do cmd/loadtest.
+	AdminToken string
+	// OutboxPath liga o outbox: pagamentos cobrados vão primeiro para este
+	// arquivo e depois para o repositório.
+	OutboxPath string
+	// Fees é a taxa de cada processor usada no resumo com details=true.
+	Fees map[string]float64
+	// WriteBatch agrupa as gravações de pagamentos quando o repositório
+	// aceita lotes; Size menor que 2 desliga.
+	WriteBatch batch.Config
+}
+
+// ConfigFromEnv lê as mesmas variáveis de ambiente usadas no docker-compose.
+func ConfigFromEnv() Config {
+	config := Config{
+		Addr:              os.Getenv("PORT"),
+		Socket:            os.Getenv("UNIX_SOCKET"),
+		SocketMode:        0o666,
+		Transport:         os.Getenv("TRANSPORT"),
+		AdminToken:        os.Getenv("ADMIN_TOKEN"),
+		OutboxPath:        os.Getenv("OUTBOX_PATH"),
+		Prefork:           os.Getenv("PREFORK") != "false",
+		StampAtAdmission:  os.Getenv("REQUESTED_AT_POLICY") == "admission",
+		QueueSize:         10000,
+		Workers:           worker.WorkerCount,
+		ReconcileInterval: 5 * time.Second,
+		PeerTimeout:       500 * time.Millisecond,
+		Fees:              map[string]float64{processor.Default: 0.05, processor.Fallback: 0.15},
+		WriteBatch:        batch.Config{Size: 256, Linger: time.Millisecond},
+	}
+	if v, err := strconv.Atoi(os.Getenv("QUEUE_SIZE")); err == nil && v > 0 {
+		config.QueueSize = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("WORKER_COUNT")); err == nil && v > 0 {
+		config.Workers = v
+	}
+	if v, err := strconv.ParseUint(os.Getenv("UNIX_SOCKET_MODE"), 8, 32); err == nil {
+		config.SocketMode = os.FileMode(v)
+	}
+	config.BodyLimit, _ = strconv.Atoi(os.Getenv("MAX_BODY_SIZE"))
+	config.MaxAmount, _ = strconv.ParseFloat(os.Getenv("VALIDATION_MAX_AMOUNT"), 64)
+	if v, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL")); err == nil {
+		config.ReconcileInterval = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("SUMMARY_PEER_TIMEOUT")); err == nil {
+		config.PeerTimeout = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("FEE_DEFAULT"), 64); err == nil {
+		config.Fees[processor.Default] = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("FEE_FALLBACK"), 64); err == nil {
+		config.Fees[processor.Fallback] = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("SUMMARY_BARRIER")); err == nil {
+		config.SummaryBarrier = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("WRITE_BATCH_SIZE")); err == nil {
+		config.WriteBatch.Size = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("WRITE_BATCH_LINGER")); err == nil {
+		config.WriteBatch.Linger = v
+	}
+	return config
+}
+
+// Dependencies são os recursos externos do gateway. Overflow é opcional; com
+// Discovery o resumo passa a somar os totais locais de cada instância, com
+// Webhooks os pagamentos concluídos ou desistidos são notificados e com
+// Events o stream do resumo recebe os eventos de todas as instâncias. Com
+// Pending a barreira do resumo (SUMMARY_BARRIER) espera também os pagamentos
+// em voo nas outras instâncias.
+type Dependencies struct {
+	Payments  repository.RedisPaymentRepository
+	Unknowns  repository.ReconciliationRepository
+	Statuses  repository.StatusRepository
+	Processor *processor.Client
+	Overflow  messaging.PaymentMessaging
+	Discovery cluster.Discovery
+	Webhooks  *webhook.Dispatcher
+	Events    *events.RedisRelay
+	Pending   repository.PendingRepository
+}
+
+type Server struct {
+	config     Config
+	http       transport.Server
+	payments   repository.RedisPaymentRepository
+	statuses   repository.StatusRepository
+	queue      chan domain.PaymentRequest
+	admission  *admission.Controller
+	worker     *worker.Worker
+	reconciler *reconciliation.Reconciler
+	aggregator *cluster.Aggregator
+	discovery  cluster.Discovery
+	events     *events.Broker
+	webhooks   *webhook.Dispatcher
+	outbox     *outbox.Outbox
+	writer     *batch.Writer
+}
+
+func New(config Config, deps Dependencies) *Server {
+	var aggregator *cluster.Aggregator
+	payments := deps.Payments
+	var writer *batch.Writer
+	if backend, ok := payments.(repository.BatchProcessor); ok && config.WriteBatch.Size > 1 {
+		writer = batch.NewWriter(backend, config.WriteBatch)
+		payments = batch.Wrap(writer, payments)
+	}
+	if deps.Discovery != nil {
+		if config.Prefork {
+			// Cada processo filho teria seus próprios totais sem endereço próprio para ser consultado
+			log.Println("Prefork desativado: incompatível com o resumo entre peers")
+			config.Prefork = false
+		}
+		auth := http.Header{AdminTokenHeader: {config.AdminToken}}
+		aggregator = cluster.NewAggregator(deps.Discovery, config.PeerTimeout, auth)
+		payments = aggregator.Wrap(payments)
+	}
+	statuses := deps.Statuses
+	if deps.Webhooks != nil {
+		payments = webhook.WrapPayments(deps.Webhooks, payments)
+		statuses = webhook.WrapStatuses(deps.Webhooks, statuses)
+	}
+	broker := events.NewBroker(1024, deps.Events)
+	payments = events.Wrap(broker, payments)
+	util.OnHealthChange(func(name string, status util.HealthStatus) {
+		// Cada instância vê a saúde dos processors por conta própria
+		broker.PublishLocal(events.Health, healthEvent{name, status})
+	})
+	var ob *outbox.Outbox
+	if config.OutboxPath != "" {
+		if config.Prefork {
+			// Os processos filhos disputariam o mesmo arquivo e a compactação de
+			// um apagaria o que os outros ainda não entregaram
+			log.Println("Prefork desativado: o outbox é de um processo só")
+			config.Prefork = false
+		}
+		ob = outbox.New(config.OutboxPath, payments.Process)
+		payments = outbox.Wrap(ob, payments)
+	}
+	if config.AdminToken == "" {
+		log.Println("API administrativa desativada: ADMIN_TOKEN não definido (só /purge-payments, sem token)")
+	}
+	queue := make(chan domain.PaymentRequest, config.QueueSize)
+	var pending repository.PendingRepository
+	if config.SummaryBarrier > 0 {
+		// Sem barreira, registrar os pendentes seria uma ida ao Redis à toa
+		pending = deps.Pending
+	}
+	w := worker.NewWorker(queue, deps.Processor, payments, deps.Unknowns, statuses, pending)
+	s := &Server{
+		config:     config,
+		payments:   payments,
+		statuses:   statuses,
+		queue:      queue,
+		admission:  admission.NewController(queue, deps.Overflow),
+		worker:     w,
+		reconciler: reconciliation.NewReconciler(deps.Processor, payments, deps.Unknowns, statuses, w.Requeue),
+		aggregator: aggregator,
+		discovery:  deps.Discovery,
+		events:     broker,
+		webhooks:   deps.Webhooks,
+		outbox:     ob,
+		writer:     writer,
+	}
+	return s
+}
+
+// Routes devolve os handlers do gateway para quem quiser servi-los no próprio
+// servidor (transport.Mount, transport.HTTPHandler ou transport.RequestHandler).
+func (s *Server) Routes() []transport.Route {
+	routes := []transport.Route{
+		{Method: http.MethodGet, Path: "/payments-summary", Handler: s.handleSummary},
+		{Method: http.MethodGet, Path: "/payments-summary/stream", Handler: s.handleSummaryStream},
+		{Method: http.MethodPost, Path: "/payments", Handler: s.handlePayment},
+		{Method: http.MethodGet, Path: "/payments", Handler: s.handleListPayments},
+		{Method: http.MethodGet, Path: "/payments/:correlationId", Handler: s.handleStatus},
+		{Method: http.MethodGet, Path: "/reconciliation-report", Handler: s.handleReconciliationReport},
+	}
+	if s.config.AdminToken != "" {
+		routes = append(routes, transport.Route{Method: http.MethodPost, Path: "/purge-payments", Handler: s.admin("purge (legacy)", s.handleLegacyPurge)})
+		routes = append(routes, s.adminRoutes()...)
+	} else {
+		// O /purge-payments já existia sem token; sem ADMIN_TOKEN continua assim
+		routes = append(routes, transport.Route{Method: http.MethodPost, Path: "/purge-payments", Handler: s.handleLegacyPurge})
+	}
+	if s.aggregator != nil {
+		routes = append(routes, transport.Route{Method: http.MethodGet, Path: cluster.LocalSummaryPath, Handler: s.handleLocalSummary})
+		if s.config.AdminToken != "" {
+			routes = append(routes,
+				transport.Route{Method: http.MethodPost, Path: cluster.LocalPurgePath, Handler: s.admin("purge (peer)", s.handleLocalPurge)},
+				transport.Route{Method: http.MethodPost, Path: cluster.LocalRestorePath, Handler: s.admin("restore (peer)", s.handleLocalRestore)},
+			)
+		}
+	}
+	return routes
+}
+
+// TransportConfig é a configuração do transporte para servir Routes: o
+// limite de corpo e o 413 no mesmo formato de problema do POST /payments.
+func (s *Server) TransportConfig() transport.Config {
+	problem := validation.BodyTooLarge()
+	return transport.Config{
+		BodyLimit: s.config.BodyLimit,
+		Prefork:   s.config.Prefork,
+		TooLarge:  transport.JSONType(problem.Status, problem, validation.ProblemContentType),
+	}
+}
+
+// Start sobe workers, admissão e reconciliação. Com Config.Socket ou
+// Config.Addr também escuta no transporte configurado (o socket tem
+// prioridade) e bloqueia até o Shutdown; sem nenhum dos dois retorna logo,
+// para quem embute o gateway e serve Routes por conta própria.
+func (s *Server) Start() error {
+	if s.writer != nil {
+		s.writer.Start()
+	}
+	if s.outbox != nil {
+		if err := s.outbox.Start(); err != nil {
+			return err
+		}
+	}
+	if err := s.events.Start(); err != nil {
+		return err
+	}
+	if s.aggregator != nil {
+		// Antes dos workers, para os totais carregados não somarem pagamentos novos duas vezes
+		if err := s.aggregator.Seed(); err != nil {
+			log.Println("⚠ Totais locais não carregados, resumo inconsistente até um purge:", err)
+		}
+	}
+	s.admission.Start()
+	s.worker.ProcessPayment(s.config.Workers)
+	s.reconciler.Start(s.config.ReconcileInterval)
+	if s.webhooks != nil {
+		s.webhooks.Start()
+	}
+	if s.config.Addr == "" && s.config.Socket == "" {
+		return nil
+	}
+	srv, err := transport.New(s.config.Transport, s.Routes(), s.TransportConfig())
+	if err != nil {
+		return err
+	}
+	s.http = srv
+	if s.config.Socket == "" {
+		return srv.ListenAndServe(s.config.Addr)
+	}
+	ln, err := transport.ListenUnix(s.config.Socket, s.config.SocketMode)
+	if err != nil {
+		return err
+	}
+	if s.config.Prefork {
+		log.Println("Prefork ignorado: não se aplica ao Unix socket")
+	}
+	return srv.Serve(ln)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.events.Close()
+	var err error
+	if s.http != nil {
+		err = s.http.Shutdown(ctx)
+	}
+	if s.config.Socket != "" {
+		if rmErr := os.Remove(s.config.Socket); rmErr != nil && !errors.Is(rmErr, fs.ErrNotExist) && err == nil {
+			err = rmErr
+		}
+	}
+	s.reconciler.Stop()
+	s.admission.Stop()
+	s.worker.Stop()
+	if s.outbox != nil {
+		s.outbox.Stop()
+	}
+	if s.writer != nil {
+		s.writer.Stop()
+	}
+	if s.webhooks != nil {
+		s.webhooks.Stop()
+	}
+	if registry, ok := s.discovery.(*cluster.RedisRegistry); ok {
+		registry.Stop()
+	}
+	return err
+}
@@ -0,0 +1,503 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alexsandroveiga/rdb25/src/server"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/util"
+	"github.com/alexsandroveiga/rdb25/src/validation"
+)
+
+const adminToken = "test-token"
+
+// stubProcessor imita a API de um payment processor: aceita pagamentos,
+// responde o health check e a consulta por id. Com failing, recusa tudo.
+type stubProcessor struct {
+	*httptest.Server
+	failing  atomic.Bool
+	mu       sync.Mutex
+	payments map[string]domain.PaymentRequest
+}
+
+func newStubProcessor(t *testing.T) *stubProcessor {
+	p := &stubProcessor{payments: make(map[string]domain.PaymentRequest)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payments", func(w http.ResponseWriter, r *http.Request) {
+		if p.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var req domain.PaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		p.mu.Lock()
+		p.payments[req.CorrelationID] = req
+		p.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("GET /payments/service-health", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(domain.HealthResponse{Failing: p.failing.Load()})
+	})
+	mux.HandleFunc("GET /payments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		req, ok := p.payments[r.PathValue("id")]
+		p.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(req)
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *stubProcessor) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.payments)
+}
+
+// app é uma instância do gateway servida por httptest, com Redis em
+// processo e os dois processors de mentira.
+type app struct {
+	t        *testing.T
+	url      string
+	redis    *miniredis.Miniredis
+	def, fb  *stubProcessor
+	payments repository.RedisPaymentRepository
+}
+
+// newApp sobe o gateway; configure ajusta a Config antes do New.
+func newApp(t *testing.T, configure ...func(*server.Config)) *app {
+	t.Helper()
+	a := &app{t: t, redis: miniredis.RunT(t), def: newStubProcessor(t), fb: newStubProcessor(t)}
+	t.Setenv("URL_PROCESSOR_DEFAULT", a.def.URL+"/payments")
+	t.Setenv("URL_PROCESSOR_FALLBACK", a.fb.URL+"/payments")
+	t.Setenv("URL_HEALTH_DEFAULT", a.def.URL+"/payments/service-health")
+	t.Setenv("URL_HEALTH_FALLBACK", a.fb.URL+"/payments/service-health")
+
+	client := redis.NewClient(&redis.Options{Addr: a.redis.Addr()})
+	t.Cleanup(func() { client.Close() })
+	util.SetRedisClient(client)
+	a.payments = repository.NewRedisPaymentRepository(client)
+	config := server.Config{
+		QueueSize:         100,
+		Workers:           2,
+		ReconcileInterval: time.Hour,
+		PeerTimeout:       time.Second,
+		AdminToken:        adminToken,
+		Fees:              map[string]float64{processor.Default: 0.05, processor.Fallback: 0.15},
+	}
+	for _, fn := range configure {
+		fn(&config)
+	}
+	srv := server.New(config, server.Dependencies{
+		Payments:  a.payments,
+		Unknowns:  repository.NewRedisReconciliationRepository(client),
+		Statuses:  repository.NewRedisStatusRepository(client),
+		Processor: processor.NewClient(),
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(transport.HTTPHandler(srv.Routes(), srv.TransportConfig()))
+	t.Cleanup(func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	a.url = ts.URL
+	return a
+}
+
+func (a *app) do(method, path string, body any, header http.Header) (int, []byte) {
+	a.t.Helper()
+	var r *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	} else {
+		r = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, a.url+path, r)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	return resp.StatusCode, buf.Bytes()
+}
+
+func (a *app) pay(id string, amount float64) {
+	a.t.Helper()
+	status, body := a.do(http.MethodPost, "/payments", domain.PaymentRequest{CorrelationID: id, Amount: amount}, nil)
+	if status != http.StatusNoContent {
+		a.t.Fatalf("POST /payments %s: status %d, body %s", id, status, body)
+	}
+}
+
+func (a *app) summary(query url.Values) domain.PaymentSummary {
+	a.t.Helper()
+	status, body := a.do(http.MethodGet, "/payments-summary?"+query.Encode(), nil, nil)
+	if status != http.StatusOK {
+		a.t.Fatalf("GET /payments-summary: status %d, body %s", status, body)
+	}
+	var s domain.PaymentSummary
+	if err := json.Unmarshal(body, &s); err != nil {
+		a.t.Fatal(err)
+	}
+	return s
+}
+
+// waitSummary espera o resumo completo chegar a want requisições.
+func (a *app) waitSummary(want int) domain.PaymentSummary {
+	a.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s := a.summary(nil)
+		if s.Default.TotalRequests+s.Fallback.TotalRequests >= want || time.Now().After(deadline) {
+			return s
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (a *app) admin(method, path string) (int, []byte) {
+	return a.do(method, path, nil, http.Header{server.AdminTokenHeader: {adminToken}})
+}
+
+func uuid(n int) string {
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", n)
+}
+
+func assertItem(t *testing.T, name string, got domain.SummaryItem, requests int, amount float64) {
+	t.Helper()
+	if got.TotalRequests != requests || math.Abs(got.TotalAmount-amount) > 1e-9 {
+		t.Errorf("%s = %+v, want %d requests totaling %.2f", name, got, requests, amount)
+	}
+}
+
+func TestPaymentFlow(t *testing.T) {
+	a := newApp(t)
+	a.pay(uuid(1), 10)
+	a.pay(uuid(2), 20.5)
+	a.pay(uuid(3), 0.01)
+
+	s := a.waitSummary(3)
+	assertItem(t, "default", s.Default, 3, 30.51)
+	assertItem(t, "fallback", s.Fallback, 0, 0)
+	if n := a.def.count(); n != 3 {
+		t.Errorf("default processor received %d payments, want 3", n)
+	}
+
+	status, body := a.do(http.MethodGet, "/payments/"+uuid(1), nil, nil)
+	var ps domain.PaymentStatus
+	if status != http.StatusOK || json.Unmarshal(body, &ps) != nil {
+		t.Fatalf("GET /payments/{id}: status %d, body %s", status, body)
+	}
+	if ps.State != domain.StateCompleted || ps.Processor != processor.Default {
+		t.Errorf("status = %+v, want completed on default", ps)
+	}
+	if status, _ := a.do(http.MethodGet, "/payments/"+uuid(99), nil, nil); status != http.StatusNotFound {
+		t.Errorf("unknown payment: status %d, want 404", status)
+	}
+
+	if status, _ := a.do(http.MethodPost, "/payments", map[string]any{"correlationId": "x", "amount": 1}, nil); status != http.StatusBadRequest {
+		t.Errorf("invalid payment: status %d, want 400", status)
+	}
+}
+
+// TestRejectedHasNoStatus: um pagamento recusado na admissão não fica
+// marcado como failed e pode ser reenviado com o mesmo correlationId.
+func TestRejectedHasNoStatus(t *testing.T) {
+	a := newApp(t, func(c *server.Config) { c.QueueSize = 1 })
+	a.admin(http.MethodPost, "/admin/workers/pause")
+	a.pay(uuid(1), 10)
+	status, _ := a.do(http.MethodPost, "/payments", domain.PaymentRequest{CorrelationID: uuid(2), Amount: 10}, nil)
+	if status != http.StatusServiceUnavailable && status != http.StatusTooManyRequests {
+		t.Fatalf("full queue: status %d", status)
+	}
+	if status, _ := a.do(http.MethodGet, "/payments/"+uuid(2), nil, nil); status != http.StatusNotFound {
+		t.Errorf("rejected payment: status %d, want 404", status)
+	}
+
+	a.admin(http.MethodPost, "/admin/workers/resume")
+	a.waitSummary(1)
+	a.pay(uuid(2), 10)
+	a.waitSummary(2)
+	// O completed é gravado logo depois do pagamento
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, body := a.do(http.MethodGet, "/payments/"+uuid(2), nil, nil)
+		var ps domain.PaymentStatus
+		if status == http.StatusOK && json.Unmarshal(body, &ps) == nil && ps.State == domain.StateCompleted {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resent payment: status %d, body %s", status, body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestPaymentLimits: MaxAmount e BodyLimit vêm da Config e os dois erros saem
+// como problem+json.
+func TestPaymentLimits(t *testing.T) {
+	a := newApp(t, func(c *server.Config) {
+		c.MaxAmount = 100
+		c.BodyLimit = 256
+	})
+	tests := []struct {
+		name   string
+		body   any
+		status int
+	}{
+		{"above max", domain.PaymentRequest{CorrelationID: uuid(1), Amount: 100.01}, http.StatusBadRequest},
+		{"too large", map[string]string{"pad": strings.Repeat("x", 256)}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range tests {
+		data, _ := json.Marshal(tc.body)
+		resp, err := http.Post(a.url+"/payments", "application/json", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || resp.Header.Get("Content-Type") != validation.ProblemContentType {
+			t.Errorf("%s: %d %q, want %d problem+json", tc.name, resp.StatusCode, resp.Header.Get("Content-Type"), tc.status)
+		}
+	}
+	if status, _ := a.do(http.MethodPost, "/payments", domain.PaymentRequest{CorrelationID: uuid(2), Amount: 100}, nil); status != http.StatusNoContent {
+		t.Errorf("amount at max: status %d", status)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	a := newApp(t)
+	a.def.failing.Store(true)
+	a.pay(uuid(1), 10)
+	s := a.waitSummary(1)
+	assertItem(t, "default", s.Default, 0, 0)
+	assertItem(t, "fallback", s.Fallback, 1, 10)
+
+	// Com o default de volta, os próximos pagamentos voltam para ele
+	a.def.failing.Store(false)
+	a.pay(uuid(2), 5)
+	s = a.waitSummary(2)
+	assertItem(t, "default", s.Default, 1, 5)
+	assertItem(t, "fallback", s.Fallback, 1, 10)
+}
+
+func TestSummaryTimeFilter(t *testing.T) {
+	a := newApp(t)
+	before := time.Now().UTC().Add(-time.Second)
+	a.pay(uuid(1), 10)
+	a.pay(uuid(2), 20)
+	a.waitSummary(2)
+	after := time.Now().UTC().Add(time.Second)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		requests int
+		amount   float64
+	}{
+		{"covering", before, after, 2, 30},
+		{"only from", before, time.Time{}, 2, 30},
+		{"in the past", before.Add(-time.Hour), before, 0, 0},
+		{"in the future", after, after.Add(time.Hour), 0, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q := url.Values{"from": {tc.from.Format(time.RFC3339Nano)}}
+			if !tc.to.IsZero() {
+				q.Set("to", tc.to.Format(time.RFC3339Nano))
+			}
+			s := a.summary(q)
+			assertItem(t, "default", s.Default, tc.requests, tc.amount)
+		})
+	}
+
+	status, _ := a.do(http.MethodGet, "/payments-summary?from=yesterday", nil, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("invalid from: status %d, want 400", status)
+	}
+}
+
+// TestRequestedAtPolicy confere em que janela do resumo o pagamento cai em
+// cada política: com os workers pausados a admissão e a primeira tentativa
+// ficam em janelas separadas, e as retentativas com os dois processors fora
+// não podem carimbar de novo.
+func TestRequestedAtPolicy(t *testing.T) {
+	for _, admission := range []bool{true, false} {
+		name := "first attempt"
+		if admission {
+			name = "admission"
+		}
+		t.Run(name, func(t *testing.T) {
+			a := newApp(t, func(c *server.Config) { c.StampAtAdmission = admission })
+			a.admin(http.MethodPost, "/admin/workers/pause")
+			a.def.failing.Store(true)
+			a.fb.failing.Store(true)
+
+			admittedFrom := time.Now().UTC().Truncate(time.Millisecond)
+			a.pay(uuid(1), 10)
+			admittedTo := time.Now().UTC()
+			time.Sleep(100 * time.Millisecond)
+			attemptedFrom := time.Now().UTC().Truncate(time.Millisecond)
+			a.admin(http.MethodPost, "/admin/workers/resume")
+			// Algumas retentativas antes de os processors voltarem
+			time.Sleep(500 * time.Millisecond)
+			recovered := time.Now().UTC()
+			a.def.failing.Store(false)
+			a.fb.failing.Store(false)
+			a.waitSummary(1)
+
+			stored, err := a.payments.Payments(time.Time{}, time.Time{})
+			if err != nil || len(stored) != 1 {
+				t.Fatalf("stored = %+v, %v", stored, err)
+			}
+			at := stored[0].RequestedAt
+			if admission && (at.Before(admittedFrom) || at.After(admittedTo)) {
+				t.Errorf("requestedAt %v outside admission [%v, %v]", at, admittedFrom, admittedTo)
+			}
+			if !admission && (at.Before(attemptedFrom) || !at.Before(recovered)) {
+				t.Errorf("requestedAt %v outside first attempt [%v, %v)", at, attemptedFrom, recovered)
+			}
+			a.def.mu.Lock()
+			sent := a.def.payments[uuid(1)].RequestedAt
+			a.def.mu.Unlock()
+			if sent != at.Format(domain.RequestedAtLayout) {
+				t.Errorf("processor got %q, stored %v", sent, at)
+			}
+
+			window := func(from, to time.Time) int {
+				q := url.Values{"from": {from.Format(time.RFC3339Nano)}, "to": {to.Format(time.RFC3339Nano)}}
+				return a.summary(q).Default.TotalRequests
+			}
+			inAdmission := window(admittedFrom, admittedTo)
+			inAttempts := window(attemptedFrom, recovered)
+			if admission && (inAdmission != 1 || inAttempts != 0) {
+				t.Errorf("admission window %d, attempts window %d; want 1 and 0", inAdmission, inAttempts)
+			}
+			if !admission && (inAdmission != 0 || inAttempts != 1) {
+				t.Errorf("admission window %d, attempts window %d; want 0 and 1", inAdmission, inAttempts)
+			}
+			if n := window(at, at); n != 1 {
+				t.Errorf("window at exactly requestedAt = %d, want 1", n)
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	a := newApp(t)
+	a.pay(uuid(1), 10)
+	a.pay(uuid(2), 20)
+	a.waitSummary(2)
+
+	if status, _ := a.do(http.MethodPost, "/admin/purge-payments", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("purge without token: status %d, want 401", status)
+	}
+	status, body := a.admin(http.MethodPost, "/admin/purge-payments?dryRun=true")
+	var result domain.PurgeResult
+	if status != http.StatusOK || json.Unmarshal(body, &result) != nil {
+		t.Fatalf("dry run: status %d, body %s", status, body)
+	}
+	assertItem(t, "dry run", result.Default, 2, 30)
+	assertItem(t, "after dry run", a.summary(nil).Default, 2, 30)
+
+	status, body = a.admin(http.MethodPost, "/admin/purge-payments")
+	if status != http.StatusOK {
+		t.Fatalf("purge: status %d, body %s", status, body)
+	}
+	assertItem(t, "after purge", a.summary(nil).Default, 0, 0)
+
+	// O gateway segue aceitando pagamentos depois do purge
+	a.pay(uuid(3), 7)
+	assertItem(t, "after new payment", a.waitSummary(1).Default, 1, 7)
+}
+
+func TestAdmin(t *testing.T) {
+	t.Run("disabled without token", func(t *testing.T) {
+		a := newApp(t, func(c *server.Config) { c.AdminToken = "" })
+		if status, _ := a.do(http.MethodPost, "/admin/purge-payments", nil, http.Header{server.AdminTokenHeader: {""}}); status != http.StatusNotFound {
+			t.Errorf("POST /admin/purge-payments: status %d, want 404", status)
+		}
+		// O /purge-payments de antes continua de pé, sem token
+		a.pay(uuid(1), 10)
+		a.waitSummary(1)
+		if status, _ := a.do(http.MethodPost, "/purge-payments", nil, nil); status != http.StatusNoContent {
+			t.Errorf("POST /purge-payments: status %d, want 204", status)
+		}
+		assertItem(t, "after purge", a.summary(nil).Default, 0, 0)
+	})
+
+	a := newApp(t)
+	t.Run("legacy purge", func(t *testing.T) {
+		a.pay(uuid(1), 10)
+		a.waitSummary(1)
+		if status, _ := a.do(http.MethodPost, "/purge-payments", nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("without token: status %d, want 401", status)
+		}
+		status, body := a.admin(http.MethodPost, "/purge-payments")
+		if status != http.StatusNoContent || len(body) != 0 {
+			t.Fatalf("status %d, body %q, want 204 without body", status, body)
+		}
+		assertItem(t, "after purge", a.summary(nil).Default, 0, 0)
+	})
+
+	t.Run("worker control is per process", func(t *testing.T) {
+		for _, path := range []string{"/admin/workers/pause", "/admin/workers/resume"} {
+			status, body := a.admin(http.MethodPost, path)
+			var control struct {
+				Paused   bool   `json:"paused"`
+				Scope    string `json:"scope"`
+				Instance string `json:"instance"`
+			}
+			if status != http.StatusOK || json.Unmarshal(body, &control) != nil {
+				t.Fatalf("POST %s: status %d, body %s", path, status, body)
+			}
+			if control.Paused != (path == "/admin/workers/pause") || control.Scope != server.ProcessScope || control.Instance == "" {
+				t.Errorf("POST %s = %s", path, body)
+			}
+		}
+	})
+}
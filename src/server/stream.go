@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/events"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/util"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+type healthEvent struct {
+	Processor string `json:"processor"`
+	util.HealthStatus
+}
+
+// handleSummaryStream é o resumo em Server-Sent Events: um snapshot
+// "summary" com os totais e depois um "payment" por pagamento gravado (em
+// qualquer instância, com o relay no Redis), "health" a cada mudança de
+// estado de um processor nesta instância e "purge"/"restore" quando os
+// totais são alterados pela API administrativa. Com Last-Event-ID (header ou
+// query lastEventId) ainda no histórico, o snapshot é trocado pelos eventos
+// perdidos.
+//
+// O snapshot leva a versão do último evento publicado antes dele e os
+// eventos até ela são descartados: o pagamento é gravado antes de ser
+// publicado, então já está nos totais. Um pagamento gravado durante a
+// leitura do snapshot ainda pode ser contado duas vezes.
+func (s *Server) handleSummaryStream(r transport.Request) transport.Response {
+	lastID := r.Header("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.Query("lastEventId")
+	}
+	sub := s.events.Subscribe(lastID)
+	return transport.Stream(http.StatusOK, "text/event-stream", func(w *bufio.Writer) error {
+		defer s.events.Unsubscribe(sub.Events)
+		var version uint64
+		if sub.Resumed {
+			for _, e := range sub.Replay {
+				writeEvent(w, e)
+			}
+		} else {
+			var err error
+			if version, err = s.writeSnapshot(w); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return nil // cliente desconectou
+		}
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case e, ok := <-sub.Events:
+				if !ok {
+					return nil
+				}
+				if e.Version != 0 && e.Version <= version {
+					continue // já no snapshot
+				}
+				writeEvent(w, e)
+			case <-heartbeat.C:
+				w.WriteString(": ping\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return nil
+			}
+		}
+	}).WithHeader("Cache-Control", "no-cache").WithHeader("X-Accel-Buffering", "no")
+}
+
+// writeSnapshot escreve os totais e devolve a versão em que foram lidos.
+func (s *Server) writeSnapshot(w *bufio.Writer) (uint64, error) {
+	s.events.Wait()
+	version, id, err := s.events.Version()
+	if err != nil {
+		return 0, err
+	}
+	var snapshot any
+	if s.aggregator != nil {
+		snapshot = s.aggregator.Summary(time.Time{}, time.Now().UTC())
+	} else {
+		summary, err := s.payments.GetSummary(time.Time{}, time.Now().UTC())
+		if err != nil {
+			return 0, err
+		}
+		snapshot = summary
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	writeEvent(w, events.Event{ID: id, Type: events.Summary, Data: data})
+	return version, nil
+}
+
+// writeEvent omite o id dos eventos fora do histórico, para o navegador
+// manter o Last-Event-ID do último que dá para retomar.
+func writeEvent(w *bufio.Writer, e events.Event) {
+	if e.ID != "" {
+		w.WriteString("id: ")
+		w.WriteString(e.ID)
+		w.WriteString("\n")
+	}
+	w.WriteString("event: ")
+	w.WriteString(e.Type)
+	w.WriteString("\ndata: ")
+	w.Write(e.Data)
+	w.WriteString("\n\n")
+}
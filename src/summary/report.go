@@ -0,0 +1,144 @@
+package summary
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+// Options escolhe os extras do relatório. Bucket zero não agrupa por tempo.
+type Options struct {
+	Bucket  time.Duration
+	Details bool
+	// Fees é a taxa por processor (0.05 = 5%).
+	Fees map[string]float64
+}
+
+func (o Options) Extended() bool {
+	return o.Bucket > 0 || o.Details
+}
+
+// Builder monta o relatório um pagamento por vez, para quem lê o intervalo em
+// lotes não precisar juntar todos os pagamentos antes. Com Details guarda só
+// os valores, para os percentis.
+type Builder struct {
+	opts    Options
+	report  domain.SummaryReport
+	buckets map[time.Time]*domain.SummaryBucket
+	amounts [2][]float64
+}
+
+func NewBuilder(opts Options) *Builder {
+	b := &Builder{opts: opts, buckets: make(map[time.Time]*domain.SummaryBucket)}
+	if opts.Details {
+		b.report.Default.SummaryDetail = &domain.SummaryDetail{}
+		b.report.Fallback.SummaryDetail = &domain.SummaryDetail{}
+	}
+	return b
+}
+
+// Add soma p. attempts é quantas vezes ele foi enviado, zero se o estado já
+// expirou; só é usado com Details.
+func (b *Builder) Add(p domain.Payment, attempts int) {
+	item, side := &b.report.Default, 0
+	if p.Processor == "fallback" {
+		item, side = &b.report.Fallback, 1
+	}
+	if d := item.SummaryDetail; d != nil {
+		if item.TotalRequests == 0 || p.Amount < d.MinAmount {
+			d.MinAmount = p.Amount
+		}
+		d.MaxAmount = max(d.MaxAmount, p.Amount)
+		switch {
+		case attempts == 0:
+			d.RetriesUnknown++
+		case attempts > 1:
+			d.Retries += attempts - 1
+		}
+		b.amounts[side] = append(b.amounts[side], p.Amount)
+	}
+	item.TotalAmount += p.Amount
+	item.TotalRequests++
+
+	if b.opts.Bucket > 0 {
+		start := p.RequestedAt.UTC().Truncate(b.opts.Bucket)
+		bucket, ok := b.buckets[start]
+		if !ok {
+			bucket = &domain.SummaryBucket{Start: start}
+			b.buckets[start] = bucket
+		}
+		bi := &bucket.Default
+		if p.Processor == "fallback" {
+			bi = &bucket.Fallback
+		}
+		bi.TotalAmount += p.Amount
+		bi.TotalRequests++
+	}
+}
+
+// Report fecha o relatório com o que foi somado até aqui.
+func (b *Builder) Report() domain.SummaryReport {
+	report := b.report
+	if b.opts.Details {
+		for side, name := range []string{"default", "fallback"} {
+			item := &report.Default
+			if side == 1 {
+				item = &report.Fallback
+			}
+			d := *item.SummaryDetail
+			d.FeeAmount = cents(item.TotalAmount * b.opts.Fees[name])
+			d.NetAmount = cents(item.TotalAmount - d.FeeAmount)
+			if item.TotalRequests > 0 {
+				d.AverageAmount = cents(item.TotalAmount / float64(item.TotalRequests))
+			}
+			amounts := slices.Clone(b.amounts[side])
+			slices.Sort(amounts)
+			d.P50Amount = percentile(amounts, 50)
+			d.P90Amount = percentile(amounts, 90)
+			d.P99Amount = percentile(amounts, 99)
+			item.SummaryDetail = &d
+		}
+		var ratio float64
+		if total := report.Default.TotalRequests + report.Fallback.TotalRequests; total > 0 {
+			ratio = float64(report.Fallback.TotalRequests) / float64(total)
+		}
+		report.FallbackRatio = &ratio
+	}
+
+	if b.opts.Bucket > 0 {
+		report.Buckets = make([]domain.SummaryBucket, 0, len(b.buckets))
+		for _, bucket := range b.buckets {
+			report.Buckets = append(report.Buckets, *bucket)
+		}
+		sort.Slice(report.Buckets, func(i, j int) bool {
+			return report.Buckets[i].Start.Before(report.Buckets[j].Start)
+		})
+	}
+	return report
+}
+
+// Build monta o relatório a partir dos pagamentos do intervalo. attempts traz
+// quantas vezes cada pagamento foi enviado; só é usado com Details.
+func Build(payments []domain.Payment, attempts map[string]int, opts Options) domain.SummaryReport {
+	b := NewBuilder(opts)
+	for _, p := range payments {
+		b.Add(p, attempts[p.CorrelationID])
+	}
+	return b.Report()
+}
+
+// percentile usa o nearest-rank sobre sorted, já ordenado.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func cents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
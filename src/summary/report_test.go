@@ -0,0 +1,90 @@
+package summary
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+func at(minute, second int) time.Time {
+	return time.Date(2025, 7, 15, 12, minute, second, 0, time.UTC)
+}
+
+func TestBuildBucket(t *testing.T) {
+	payments := []domain.Payment{
+		{CorrelationID: "a", Amount: 10, RequestedAt: at(1, 30), Processor: "default"},
+		{CorrelationID: "b", Amount: 20, RequestedAt: at(0, 10), Processor: "fallback"},
+		{CorrelationID: "c", Amount: 30, RequestedAt: at(1, 0), Processor: "default"},
+		{CorrelationID: "d", Amount: 40, RequestedAt: at(0, 59), Processor: "default"},
+	}
+
+	report := Build(payments, nil, Options{Bucket: time.Minute})
+	if len(report.Buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2: %+v", len(report.Buckets), report.Buckets)
+	}
+	first, second := report.Buckets[0], report.Buckets[1]
+	if !first.Start.Equal(at(0, 0)) || first.Default.TotalAmount != 40 || first.Fallback.TotalAmount != 20 {
+		t.Errorf("first bucket = %+v", first)
+	}
+	if !second.Start.Equal(at(1, 0)) || second.Default.TotalRequests != 2 || second.Default.TotalAmount != 40 || second.Fallback.TotalRequests != 0 {
+		t.Errorf("second bucket = %+v", second)
+	}
+	if report.Default.TotalRequests != 3 || report.Fallback.TotalRequests != 1 {
+		t.Errorf("totals = %+v / %+v", report.Default.SummaryItem, report.Fallback.SummaryItem)
+	}
+	if report.Default.SummaryDetail != nil || report.FallbackRatio != nil {
+		t.Error("details without details=true")
+	}
+
+	hour := Build(payments, nil, Options{Bucket: time.Hour})
+	if len(hour.Buckets) != 1 || hour.Buckets[0].Default.TotalRequests != 3 {
+		t.Errorf("hour buckets = %+v", hour.Buckets)
+	}
+}
+
+func TestBuildDetails(t *testing.T) {
+	var payments []domain.Payment
+	attempts := map[string]int{}
+	for i := 1; i <= 10; i++ {
+		id := string(rune('a' + i - 1))
+		payments = append(payments, domain.Payment{CorrelationID: id, Amount: float64(i * 10), RequestedAt: at(0, i), Processor: "default"})
+		attempts[id] = 1
+	}
+	attempts["b"] = 3
+	delete(attempts, "c") // estado já expirou
+	payments = append(payments, domain.Payment{CorrelationID: "z", Amount: 19.9, RequestedAt: at(0, 0), Processor: "fallback"})
+	attempts["z"] = 2
+
+	report := Build(payments, attempts, Options{Details: true, Fees: map[string]float64{"default": 0.05, "fallback": 0.15}})
+	d := report.Default.SummaryDetail
+	if d == nil {
+		t.Fatal("no default details")
+	}
+	want := domain.SummaryDetail{
+		FeeAmount: 27.5, NetAmount: 522.5, AverageAmount: 55, MinAmount: 10, MaxAmount: 100,
+		P50Amount: 50, P90Amount: 90, P99Amount: 100, Retries: 2, RetriesUnknown: 1,
+	}
+	if *d != want {
+		t.Errorf("default details = %+v, want %+v", *d, want)
+	}
+	f := report.Fallback.SummaryDetail
+	if f.FeeAmount != 2.99 || f.NetAmount != 16.91 || f.P50Amount != 19.9 || f.Retries != 1 || f.RetriesUnknown != 0 {
+		t.Errorf("fallback details = %+v", *f)
+	}
+	if report.FallbackRatio == nil || *report.FallbackRatio != 1.0/11 {
+		t.Errorf("fallback ratio = %v, want 1/11", report.FallbackRatio)
+	}
+	if report.Buckets != nil {
+		t.Error("buckets without bucket=")
+	}
+}
+
+// TestBuildDetailsEmpty: sem pagamentos os detalhes saem zerados, sem dividir
+// por zero.
+func TestBuildDetailsEmpty(t *testing.T) {
+	report := Build(nil, nil, Options{Details: true})
+	if *report.Default.SummaryDetail != (domain.SummaryDetail{}) || *report.FallbackRatio != 0 {
+		t.Errorf("report = %+v", report)
+	}
+}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+)
+
+type fastHTTPServer struct {
+	server *fasthttp.Server
+}
+
+func newFastHTTPServer(routes []Route, config Config) *fastHTTPServer {
+	return &fastHTTPServer{&fasthttp.Server{
+		Handler:            RequestHandler(routes),
+		MaxRequestBodySize: config.BodyLimit,
+		ErrorHandler: func(ctx *fasthttp.RequestCtx, err error) {
+			if errors.Is(err, fasthttp.ErrBodyTooLarge) {
+				sendFastHTTP(ctx, config.tooLarge())
+				return
+			}
+			sendFastHTTP(ctx, Error(http.StatusBadRequest, http.StatusText(http.StatusBadRequest)))
+		},
+	}}
+}
+
+// RequestHandler expõe routes como handler fasthttp puro.
+func RequestHandler(routes []Route) fasthttp.RequestHandler {
+	rt := &router{routes}
+	return func(ctx *fasthttp.RequestCtx) {
+		h, params, resp := rt.match(string(ctx.Method()), string(ctx.Path()))
+		if h != nil {
+			resp = h(fastHTTPRequest{ctx, params})
+		}
+		sendFastHTTP(ctx, resp)
+	}
+}
+
+func sendFastHTTP(ctx *fasthttp.RequestCtx, resp Response) {
+	for k, v := range resp.Headers {
+		ctx.Response.Header.Set(k, v)
+	}
+	if resp.ContentType != "" {
+		ctx.SetContentType(resp.ContentType)
+	}
+	ctx.SetStatusCode(resp.Status)
+	if resp.Stream != nil {
+		path := string(ctx.Path())
+		ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+			if err := resp.Stream(w); err != nil {
+				log.Printf("Erro no stream de %s: %v", path, err)
+			}
+		})
+		return
+	}
+	ctx.SetBody(resp.Body)
+}
+
+func (s *fastHTTPServer) ListenAndServe(addr string) error {
+	return s.server.ListenAndServe(addr)
+}
+
+func (s *fastHTTPServer) Serve(ln net.Listener) error {
+	return s.server.Serve(ln)
+}
+
+func (s *fastHTTPServer) Shutdown(ctx context.Context) error {
+	return s.server.ShutdownWithContext(ctx)
+}
+
+type fastHTTPRequest struct {
+	ctx    *fasthttp.RequestCtx
+	params map[string]string
+}
+
+func (r fastHTTPRequest) Method() string          { return string(r.ctx.Method()) }
+func (r fastHTTPRequest) Path() string            { return string(r.ctx.Path()) }
+func (r fastHTTPRequest) Param(key string) string { return r.params[key] }
+func (r fastHTTPRequest) Query(key string) string {
+	return string(r.ctx.QueryArgs().Peek(key))
+}
+func (r fastHTTPRequest) RawQuery() string {
+	return string(r.ctx.URI().QueryString())
+}
+func (r fastHTTPRequest) Header(key string) string {
+	return string(r.ctx.Request.Header.Peek(key))
+}
+func (r fastHTTPRequest) Body() []byte { return r.ctx.PostBody() }
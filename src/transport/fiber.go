@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type fiberServer struct {
+	app    *fiber.App
+	config Config
+}
+
+func newFiberServer(routes []Route, config Config) *fiberServer {
+	app := fiber.New(fiber.Config{
+		CaseSensitive: true,
+		StrictRouting: true,
+		BodyLimit:     config.BodyLimit,
+		ErrorHandler: func(c fiber.Ctx, err error) error {
+			var e *fiber.Error
+			if errors.As(err, &e) {
+				if e.Code == http.StatusRequestEntityTooLarge {
+					return sendFiber(c, config.tooLarge())
+				}
+				return sendFiber(c, Error(e.Code, http.StatusText(e.Code)))
+			}
+			return sendFiber(c, Error(http.StatusInternalServerError, err.Error()))
+		},
+	})
+	Mount(app, routes)
+	rt := &router{routes}
+	app.Use(func(c fiber.Ctx) error {
+		_, _, resp := rt.match(c.Method(), c.Path())
+		return sendFiber(c, resp)
+	})
+	return &fiberServer{app, config}
+}
+
+// Mount registra routes em um router Fiber existente, para embutir o gateway
+// em outra aplicação Fiber.
+func Mount(r fiber.Router, routes []Route) {
+	for _, route := range routes {
+		h := route.Handler
+		r.Add([]string{route.Method}, route.Path, func(c fiber.Ctx) error {
+			return sendFiber(c, h(fiberRequest{c}))
+		})
+	}
+}
+
+func (s *fiberServer) ListenAndServe(addr string) error {
+	return s.app.Listen(addr, fiber.ListenConfig{EnablePrefork: s.config.Prefork})
+}
+
+// Serve não faz prefork: os processos filhos não herdam um listener próprio.
+func (s *fiberServer) Serve(ln net.Listener) error {
+	return s.app.Listener(ln)
+}
+
+func (s *fiberServer) Shutdown(ctx context.Context) error {
+	return s.app.ShutdownWithContext(ctx)
+}
+
+func sendFiber(c fiber.Ctx, resp Response) error {
+	for k, v := range resp.Headers {
+		c.Set(k, v)
+	}
+	if resp.ContentType != "" {
+		c.Set(fiber.HeaderContentType, resp.ContentType)
+	}
+	c.Status(resp.Status)
+	if resp.Stream != nil {
+		return c.SendStreamWriter(func(w *bufio.Writer) {
+			if err := resp.Stream(w); err != nil {
+				log.Printf("Erro no stream de %s: %v", c.Path(), err)
+			}
+		})
+	}
+	return c.Send(resp.Body)
+}
+
+type fiberRequest struct {
+	c fiber.Ctx
+}
+
+func (r fiberRequest) Method() string           { return r.c.Method() }
+func (r fiberRequest) Path() string             { return r.c.Path() }
+func (r fiberRequest) Param(key string) string  { return r.c.Params(key) }
+func (r fiberRequest) Query(key string) string  { return r.c.Query(key) }
+func (r fiberRequest) RawQuery() string         { return string(r.c.Request().URI().QueryString()) }
+func (r fiberRequest) Header(key string) string { return r.c.Get(key) }
+func (r fiberRequest) Body() []byte             { return r.c.Body() }
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+type netHTTPServer struct {
+	server *http.Server
+}
+
+func newNetHTTPServer(routes []Route, config Config) *netHTTPServer {
+	return &netHTTPServer{&http.Server{Handler: HTTPHandler(routes, config)}}
+}
+
+// HTTPHandler expõe routes como http.Handler, para embutir o gateway em um
+// servidor net/http existente.
+func HTTPHandler(routes []Route, config Config) http.Handler {
+	rt := &router{routes}
+	bodyLimit := int64(config.BodyLimit)
+	if bodyLimit <= 0 {
+		bodyLimit = 4 * 1024 * 1024 // mesmo padrão do Fiber
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, params, resp := rt.match(r.Method, r.URL.Path)
+		if h != nil {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, bodyLimit))
+			var maxErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxErr):
+				resp = config.tooLarge()
+			case err != nil:
+				resp = Error(http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+			default:
+				resp = h(netHTTPRequest{r, params, body})
+			}
+		}
+		for k, v := range resp.Headers {
+			w.Header().Set(k, v)
+		}
+		if resp.ContentType != "" {
+			w.Header().Set("Content-Type", resp.ContentType)
+		}
+		w.WriteHeader(resp.Status)
+		if resp.Stream == nil {
+			w.Write(resp.Body)
+			return
+		}
+		bw := bufio.NewWriter(flushWriter{w})
+		if err := resp.Stream(bw); err != nil {
+			log.Printf("Erro no stream de %s: %v", r.URL.Path, err)
+			return
+		}
+		bw.Flush()
+	})
+}
+
+// flushWriter repassa cada Flush do bufio.Writer ao cliente, como acontece
+// no stream do fasthttp.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok && err == nil {
+		fl.Flush()
+	}
+	return n, err
+}
+
+func (s *netHTTPServer) ListenAndServe(addr string) error {
+	s.server.Addr = addr
+	err := s.server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *netHTTPServer) Serve(ln net.Listener) error {
+	err := s.server.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *netHTTPServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+type netHTTPRequest struct {
+	r      *http.Request
+	params map[string]string
+	body   []byte
+}
+
+func (r netHTTPRequest) Method() string           { return r.r.Method }
+func (r netHTTPRequest) Path() string             { return r.r.URL.Path }
+func (r netHTTPRequest) Param(key string) string  { return r.params[key] }
+func (r netHTTPRequest) Query(key string) string  { return r.r.URL.Query().Get(key) }
+func (r netHTTPRequest) RawQuery() string         { return r.r.URL.RawQuery }
+func (r netHTTPRequest) Header(key string) string { return r.r.Header.Get(key) }
+func (r netHTTPRequest) Body() []byte             { return r.body }
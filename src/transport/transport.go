@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	Fiber    = "fiber"
+	NetHTTP  = "http"
+	FastHTTP = "fasthttp"
+)
+
+// Request é o que os handlers enxergam da requisição, independente do servidor HTTP.
+type Request interface {
+	Method() string
+	Path() string
+	Param(key string) string
+	Query(key string) string
+	RawQuery() string
+	Header(key string) string
+	Body() []byte
+}
+
+type Response struct {
+	Status      int
+	ContentType string
+	Headers     map[string]string
+	Body        []byte
+	// Stream, quando definido, substitui Body: o corpo é escrito aos poucos
+	// depois dos headers. Flush em w empurra o que já foi escrito ao cliente.
+	Stream func(w *bufio.Writer) error
+}
+
+func (r Response) WithHeader(key, value string) Response {
+	headers := make(map[string]string, len(r.Headers)+1)
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+	headers[key] = value
+	r.Headers = headers
+	return r
+}
+
+type Handler func(r Request) Response
+
+type Route struct {
+	Method  string
+	Path    string // segmentos ":nome" casam com qualquer valor
+	Handler Handler
+}
+
+type Config struct {
+	BodyLimit int
+	Prefork   bool
+	// TooLarge é a resposta a um corpo acima de BodyLimit; sem Status, um
+	// Error 413.
+	TooLarge Response
+}
+
+// tooLarge devolve a resposta configurada para o 413.
+func (c Config) tooLarge() Response {
+	if c.TooLarge.Status != 0 {
+		return c.TooLarge
+	}
+	return Error(http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+}
+
+type Server interface {
+	ListenAndServe(addr string) error
+	Serve(ln net.Listener) error
+	Shutdown(ctx context.Context) error
+}
+
+// New cria o servidor do tipo kind (fiber, http ou fasthttp) servindo routes.
+func New(kind string, routes []Route, config Config) (Server, error) {
+	switch kind {
+	case Fiber, "":
+		return newFiberServer(routes, config), nil
+	case NetHTTP:
+		return newNetHTTPServer(routes, config), nil
+	case FastHTTP:
+		return newFastHTTPServer(routes, config), nil
+	}
+	return nil, fmt.Errorf("unknown transport %q", kind)
+}
+
+func Stream(status int, contentType string, fn func(w *bufio.Writer) error) Response {
+	return Response{Status: status, ContentType: contentType, Stream: fn}
+}
+
+func JSON(status int, v any) Response {
+	return JSONType(status, v, "application/json")
+}
+
+func JSONType(status int, v any, contentType string) Response {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return Error(http.StatusInternalServerError, err.Error())
+	}
+	return Response{Status: status, ContentType: contentType, Body: body}
+}
+
+func Error(status int, message string) Response {
+	return JSON(status, map[string]string{"error": message})
+}
+
+func Status(status int) Response {
+	return Response{Status: status}
+}
+
+// router casa método e caminho exatamente como o Fiber configurado no
+// projeto: sensível a maiúsculas e com barra final significativa.
+type router struct {
+	routes []Route
+}
+
+func (rt *router) match(method, path string) (Handler, map[string]string, Response) {
+	methodMismatch := false
+	for _, route := range rt.routes {
+		params, ok := matchPath(route.Path, path)
+		if !ok {
+			continue
+		}
+		if route.Method != method {
+			methodMismatch = true
+			continue
+		}
+		return route.Handler, params, Response{}
+	}
+	if methodMismatch {
+		return nil, nil, Error(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	return nil, nil, Error(http.StatusNotFound, "not found")
+}
+
+func matchPath(pattern, path string) (map[string]string, bool) {
+	var params map[string]string
+	for {
+		pseg, prest, pmore := strings.Cut(pattern, "/")
+		seg, rest, more := strings.Cut(path, "/")
+		if pmore != more {
+			return nil, false
+		}
+		if strings.HasPrefix(pseg, ":") {
+			if seg == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string, 1)
+			}
+			params[pseg[1:]] = seg
+		} else if pseg != seg {
+			return nil, false
+		}
+		if !more {
+			return params, true
+		}
+		pattern, path = prest, rest
+	}
+}
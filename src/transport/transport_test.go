@@ -0,0 +1,161 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBodyLimit = 64
+
+var testRoutes = []Route{
+	{http.MethodGet, "/hello", func(r Request) Response {
+		return JSON(http.StatusOK, map[string]string{"hello": "world"}).WithHeader("X-Test", "1")
+	}},
+	{http.MethodPost, "/echo", func(r Request) Response {
+		return Response{Status: http.StatusCreated, ContentType: r.Header("Content-Type"), Body: append([]byte(nil), r.Body()...)}
+	}},
+	{http.MethodGet, "/items/:id", func(r Request) Response {
+		return JSON(http.StatusOK, map[string]string{
+			"id": r.Param("id"), "q": r.Query("q"), "raw": r.RawQuery(), "path": r.Path(), "method": r.Method(),
+		})
+	}},
+	{http.MethodDelete, "/items/:id", func(r Request) Response {
+		return Status(http.StatusNoContent)
+	}},
+	{http.MethodGet, "/stream", func(r Request) Response {
+		return Stream(http.StatusOK, "text/event-stream", func(w *bufio.Writer) error {
+			for _, s := range []string{"a", "b", "c"} {
+				w.WriteString("data: " + s + "\n\n")
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}},
+}
+
+// serve sobe o transporte kind numa porta livre e devolve a URL base.
+func serve(t *testing.T, kind string, config Config) string {
+	t.Helper()
+	server, err := New(kind, testRoutes, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(ln)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	return "http://" + ln.Addr().String()
+}
+
+// TestConformance roda a mesma tabela contra os três transportes: os
+// handlers não podem perceber diferença entre eles.
+func TestConformance(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		headers     map[string]string
+		want        string // corpo exato, quando não vazio
+	}{
+		{"json with header", "GET", "/hello", "", "", 200,
+			map[string]string{"Content-Type": "application/json", "X-Test": "1"}, `{"hello":"world"}`},
+		{"body echo", "POST", "/echo", "text/plain", "ping", 201,
+			map[string]string{"Content-Type": "text/plain"}, "ping"},
+		{"body at limit", "POST", "/echo", "text/plain", strings.Repeat("x", testBodyLimit), 201,
+			nil, strings.Repeat("x", testBodyLimit)},
+		{"body over limit", "POST", "/echo", "text/plain", strings.Repeat("x", testBodyLimit+1), 413,
+			map[string]string{"Content-Type": "application/json"}, ""},
+		{"params and query", "GET", "/items/42?q=a%20b&x=1", "", "", 200, nil,
+			`{"id":"42","method":"GET","path":"/items/42","q":"a b","raw":"q=a%20b\u0026x=1"}`},
+		{"no content", "DELETE", "/items/42", "", "", 204, nil, ""},
+		{"empty param", "GET", "/items/", "", "", 404, nil, `{"error":"not found"}`},
+		{"extra segment", "GET", "/items/42/x", "", "", 404, nil, `{"error":"not found"}`},
+		{"trailing slash", "GET", "/hello/", "", "", 404, nil, `{"error":"not found"}`},
+		{"case sensitive", "GET", "/HELLO", "", "", 404, nil, `{"error":"not found"}`},
+		{"not found", "GET", "/nope", "", "", 404,
+			map[string]string{"Content-Type": "application/json"}, `{"error":"not found"}`},
+		{"method not allowed", "POST", "/hello", "", "", 405,
+			map[string]string{"Content-Type": "application/json"}, `{"error":"method not allowed"}`},
+		{"stream", "GET", "/stream", "", "", 200,
+			map[string]string{"Content-Type": "text/event-stream"}, "data: a\n\ndata: b\n\ndata: c\n\n"},
+	}
+	for _, kind := range []string{Fiber, FastHTTP, NetHTTP} {
+		t.Run(kind, func(t *testing.T) {
+			base := serve(t, kind, Config{BodyLimit: testBodyLimit})
+			for _, tc := range tests {
+				t.Run(tc.name, func(t *testing.T) {
+					req, err := http.NewRequest(tc.method, base+tc.path, strings.NewReader(tc.body))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if tc.contentType != "" {
+						req.Header.Set("Content-Type", tc.contentType)
+					}
+					resp, err := http.DefaultClient.Do(req)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer resp.Body.Close()
+					body, err := io.ReadAll(resp.Body)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if resp.StatusCode != tc.status {
+						t.Fatalf("status = %d, want %d (body %q)", resp.StatusCode, tc.status, body)
+					}
+					for k, v := range tc.headers {
+						if got := resp.Header.Get(k); got != v {
+							t.Errorf("%s = %q, want %q", k, got, v)
+						}
+					}
+					if tc.want != "" && string(body) != tc.want {
+						t.Errorf("body = %q, want %q", body, tc.want)
+					}
+					if tc.status == http.StatusNoContent && len(body) != 0 {
+						t.Errorf("body = %q, want empty", body)
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestTooLarge: os três transportes respondem ao corpo grande demais com o
+// TooLarge da configuração.
+func TestTooLarge(t *testing.T) {
+	config := Config{
+		BodyLimit: testBodyLimit,
+		TooLarge:  JSONType(http.StatusRequestEntityTooLarge, map[string]int{"status": 413}, "application/problem+json"),
+	}
+	for _, kind := range []string{Fiber, FastHTTP, NetHTTP} {
+		t.Run(kind, func(t *testing.T) {
+			base := serve(t, kind, config)
+			resp, err := http.Post(base+"/echo", "text/plain", strings.NewReader(strings.Repeat("x", testBodyLimit+1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != 413 || resp.Header.Get("Content-Type") != "application/problem+json" || string(body) != `{"status":413}` {
+				t.Errorf("%d %q %s, want the configured 413", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+			}
+		})
+	}
+}
@@ -7,20 +7,70 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	client      = &http.Client{Timeout: 5 * time.Second}
-	cache       = make(map[string]HealthStatus)
-	lastCheck   = make(map[string]time.Time)
-	cacheMutex  sync.RWMutex
-	ctx         = context.Background()
-	redisClient = redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_URL")})
+	client     = &http.Client{Timeout: 5 * time.Second}
+	cache      = make(map[string]HealthStatus)
+	lastCheck  = make(map[string]time.Time)
+	cacheMutex sync.RWMutex
+	ctx        = context.Background()
+	// redisClient guarda o health check compartilhado entre as instâncias.
+	// Começa num cliente próprio de REDIS_URL; SetRedisClient troca.
+	redisClient atomic.Pointer[redis.Client]
 )
 
+func init() {
+	redisClient.Store(redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_URL")}))
+}
+
+// SetRedisClient faz o health check usar client: o main passa a mesma
+// conexão do resto do servidor, e os testes um Redis em processo. Os caches
+// em memória são descartados, para nada de um Redis valer no outro.
+func SetRedisClient(client *redis.Client) {
+	redisClient.Store(client)
+	cacheMutex.Lock()
+	clear(cache)
+	clear(lastCheck)
+	cacheMutex.Unlock()
+	listenersMu.Lock()
+	clear(lastStatus)
+	listenersMu.Unlock()
+}
+
+var (
+	listenersMu sync.Mutex
+	listeners   []func(processor string, status HealthStatus)
+	lastStatus  = make(map[string]HealthStatus)
+)
+
+// OnHealthChange registra fn para ser chamada quando esta instância percebe
+// um processor mudar de failing para saudável ou o contrário (e na primeira
+// leitura de cada um).
+func OnHealthChange(fn func(processor string, status HealthStatus)) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+func observe(processor string, status HealthStatus) {
+	listenersMu.Lock()
+	prev, seen := lastStatus[processor]
+	lastStatus[processor] = status
+	fns := listeners
+	listenersMu.Unlock()
+	if seen && prev.Failing == status.Failing {
+		return
+	}
+	for _, fn := range fns {
+		fn(processor, status)
+	}
+}
+
 type HealthStatus struct {
 	Failing         bool  `json:"failing"`
 	MinResponseTime int64 `json:"minResponseTime"`
@@ -42,7 +92,8 @@ func IsHealthyInMemory(processor string) bool {
 func IsHealthy(processor string) bool {
 	cacheKey := "health_status:" + processor
 	lastCheckKey := "health_last_check:" + processor
-	lastCheckStr, err := redisClient.Get(ctx, lastCheckKey).Result()
+	store := redisClient.Load()
+	lastCheckStr, err := store.Get(ctx, lastCheckKey).Result()
 	var lastCheck time.Time
 	if err == nil {
 		lastCheck, _ = time.Parse(time.RFC3339Nano, lastCheckStr)
@@ -55,15 +106,15 @@ func IsHealthy(processor string) bool {
 
 		statusJSON, err := json.Marshal(status)
 		if err == nil {
-			redisClient.Set(ctx, cacheKey, statusJSON, 0)
+			store.Set(ctx, cacheKey, statusJSON, 0)
 		}
-		redisClient.Set(ctx, lastCheckKey, now.Format(time.RFC3339Nano), 0)
+		store.Set(ctx, lastCheckKey, now.Format(time.RFC3339Nano), 0)
 
 		return !status.Failing
 	}
 
 	// Busca do cache JSON no Redis
-	statusJSON, err := redisClient.Get(ctx, cacheKey).Result()
+	statusJSON, err := store.Get(ctx, cacheKey).Result()
 	if err != nil {
 		// Se cache não existir, força fetchHealth
 		status := fetchHealth(processor)
@@ -77,6 +128,7 @@ func IsHealthy(processor string) bool {
 		return !status.Failing
 	}
 
+	observe(processor, cachedStatus)
 	return !cachedStatus.Failing
 }
 
@@ -88,13 +140,37 @@ func fetchHealth(processor string) HealthStatus {
 	resp, err := client.Get(url)
 	if err != nil {
 		log.Printf("Health check error for %s: %v", processor, err)
-		return HealthStatus{Failing: true}
+		return failing(processor)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		// O processor limita as consultas; o limite não diz nada sobre a saúde
+		// dele, então vale o último estado visto (saudável, se nenhum ainda).
+		listenersMu.Lock()
+		defer listenersMu.Unlock()
+		return lastStatus[processor]
+	}
 	var status HealthStatus
 	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
 		log.Printf("Health check JSON error for %s", processor)
-		return HealthStatus{Failing: true}
+		return failing(processor)
 	}
+	observe(processor, status)
+	return status
+}
+
+func failing(processor string) HealthStatus {
+	status := HealthStatus{Failing: true}
+	observe(processor, status)
 	return status
 }
+
+// InvalidateHealth descarta o health check em cache (memória e Redis) para
+// que a próxima consulta vá ao processor.
+func InvalidateHealth(processor string) error {
+	cacheMutex.Lock()
+	delete(cache, processor)
+	delete(lastCheck, processor)
+	cacheMutex.Unlock()
+	return redisClient.Load().Del(ctx, "health_status:"+processor, "health_last_check:"+processor).Err()
+}
@@ -0,0 +1,139 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"strings"
+
+	"github.com/alexsandroveiga/rdb25/src/codec"
+	"github.com/alexsandroveiga/rdb25/src/domain"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem segue o formato da RFC 7807.
+type Problem struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail,omitempty"`
+	InvalidParams []FieldError `json:"invalid-params,omitempty"`
+}
+
+type FieldError struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// DefaultMaxAmount é o teto do amount quando a configuração não define outro.
+const DefaultMaxAmount = 1_000_000
+
+// DecodePaymentRequest decodifica o corpo de POST /payments rejeitando campos
+// desconhecidos e valida cada campo. Retorna nil quando a requisição é válida.
+func DecodePaymentRequest(body []byte, req *domain.PaymentRequest, maxAmount float64) *Problem {
+	if err := codec.DecodePaymentRequest(body, req, true); err != nil {
+		return decodeProblem(err)
+	}
+	if errs := ValidatePaymentRequest(*req, maxAmount); len(errs) > 0 {
+		p := newProblem("one or more fields are invalid")
+		p.InvalidParams = errs
+		return p
+	}
+	return nil
+}
+
+// CheckContentType recusa com 415 corpos que se declaram outra coisa que não
+// JSON. Sem Content-Type o corpo é tratado como JSON.
+func CheckContentType(contentType string) *Problem {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	p := newProblem("content type must be application/json")
+	p.Status = 415
+	return p
+}
+
+// BodyTooLarge é o 413 de um corpo acima do limite do transporte.
+func BodyTooLarge() *Problem {
+	p := newProblem("request body is too large")
+	p.Status = 413
+	return p
+}
+
+// ValidatePaymentRequest valida os campos de req; maxAmount zero ou negativo
+// usa DefaultMaxAmount.
+func ValidatePaymentRequest(req domain.PaymentRequest, maxAmount float64) []FieldError {
+	if maxAmount <= 0 {
+		maxAmount = DefaultMaxAmount
+	}
+	var errs []FieldError
+	switch {
+	case req.CorrelationID == "":
+		errs = append(errs, FieldError{"correlationId", "is required"})
+	case !IsUUID(req.CorrelationID):
+		errs = append(errs, FieldError{"correlationId", "must be a UUID"})
+	}
+	switch a := req.Amount; {
+	case math.IsNaN(a) || math.IsInf(a, 0):
+		errs = append(errs, FieldError{"amount", "must be a finite number"})
+	case a <= 0:
+		errs = append(errs, FieldError{"amount", "must be greater than zero"})
+	case a > maxAmount:
+		errs = append(errs, FieldError{"amount", fmt.Sprintf("must not exceed %g", maxAmount)})
+	case math.Abs(a*100-math.Round(a*100)) > 1e-6:
+		errs = append(errs, FieldError{"amount", "must have at most 2 decimal places"})
+	}
+	return errs
+}
+
+// IsUUID aceita apenas a forma canônica 8-4-4-4-12 em hexadecimal.
+func IsUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func decodeProblem(err error) *Problem {
+	var typeErr *codec.FieldTypeError
+	var unknownErr *codec.UnknownFieldError
+	switch {
+	case errors.As(err, &typeErr):
+		p := newProblem("one or more fields are invalid")
+		p.InvalidParams = []FieldError{{typeErr.Field, "must be a " + typeErr.Type}}
+		return p
+	case errors.As(err, &unknownErr):
+		p := newProblem("one or more fields are invalid")
+		p.InvalidParams = []FieldError{{unknownErr.Field, "unknown field"}}
+		return p
+	}
+	return newProblem("request body is not valid JSON")
+}
+
+func newProblem(detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  "Invalid payment request",
+		Status: 400,
+		Detail: detail,
+	}
+}
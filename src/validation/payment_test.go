@@ -0,0 +1,125 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alexsandroveiga/rdb25/src/server"
+	"github.com/alexsandroveiga/rdb25/src/transport"
+	"github.com/alexsandroveiga/rdb25/src/validation"
+)
+
+const validID = "4a7901b8-7d26-4d9d-aa19-4dc1c7cf60b3"
+
+const bodyLimit = 1024
+
+// handler serve as rotas do gateway com um limite de corpo pequeno, sem
+// subir workers: os pagamentos válidos só entram na fila.
+func handler(t *testing.T) http.Handler {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+	srv := server.New(server.Config{QueueSize: 100, BodyLimit: bodyLimit}, server.Dependencies{
+		Payments:  repository.NewRedisPaymentRepository(client),
+		Unknowns:  repository.NewRedisReconciliationRepository(client),
+		Statuses:  repository.NewRedisStatusRepository(client),
+		Processor: processor.NewClient(),
+	})
+	return transport.HTTPHandler(srv.Routes(), srv.TransportConfig())
+}
+
+func TestPaymentRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		param       string // campo esperado em invalid-params
+	}{
+		{"valid", "application/json", `{"correlationId":"` + validID + `","amount":19.9}`, 204, ""},
+		{"valid with charset", "application/json; charset=utf-8", `{"correlationId":"` + validID + `","amount":1}`, 204, ""},
+		{"no content type", "", `{"correlationId":"` + validID + `","amount":1}`, 204, ""},
+		{"uppercase uuid", "application/json", `{"correlationId":"` + strings.ToUpper(validID) + `","amount":1}`, 204, ""},
+		{"missing id", "application/json", `{"amount":1}`, 400, "correlationId"},
+		{"bad uuid", "application/json", `{"correlationId":"not-a-uuid","amount":1}`, 400, "correlationId"},
+		{"uuid without dashes", "application/json", `{"correlationId":"4a7901b87d264d9daa194dc1c7cf60b3","amount":1}`, 400, "correlationId"},
+		{"uuid with braces", "application/json", `{"correlationId":"{` + validID[1:35] + `}","amount":1}`, 400, "correlationId"},
+		{"zero amount", "application/json", `{"correlationId":"` + validID + `","amount":0}`, 400, "amount"},
+		{"negative amount", "application/json", `{"correlationId":"` + validID + `","amount":-5}`, 400, "amount"},
+		{"missing amount", "application/json", `{"correlationId":"` + validID + `"}`, 400, "amount"},
+		{"amount above max", "application/json", `{"correlationId":"` + validID + `","amount":1000000.01}`, 400, "amount"},
+		{"too many decimals", "application/json", `{"correlationId":"` + validID + `","amount":19.999}`, 400, "amount"},
+		{"amount as string", "application/json", `{"correlationId":"` + validID + `","amount":"19.90"}`, 400, "amount"},
+		{"unknown field", "application/json", `{"correlationId":"` + validID + `","amount":1,"foo":true}`, 400, "foo"},
+		{"requestedAt is ours", "application/json", `{"correlationId":"` + validID + `","amount":1,"requestedAt":"2025-07-15T12:00:00Z"}`, 204, ""},
+		{"not json", "application/json", `correlationId=` + validID, 400, ""},
+		{"trailing data", "application/json", `{"correlationId":"` + validID + `","amount":1}{}`, 400, ""},
+		{"oversized body", "application/json", `{"correlationId":"` + validID + `","amount":1,"pad":"` + strings.Repeat("x", bodyLimit) + `"}`, 413, ""},
+		{"wrong content type", "text/plain", `{"correlationId":"` + validID + `","amount":1}`, 415, ""},
+		{"form content type", "application/x-www-form-urlencoded", `{"correlationId":"` + validID + `","amount":1}`, 415, ""},
+		{"malformed content type", "application/", `{"correlationId":"` + validID + `","amount":1}`, 415, ""},
+		{"+json suffix accepted", "application/merge-patch+json", `{"correlationId":"` + validID + `","amount":1}`, 204, ""},
+	}
+	h := handler(t)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tc.status, w.Body)
+			}
+			if tc.status == 204 {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != validation.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, validation.ProblemContentType)
+			}
+			var problem validation.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("problem: %v", err)
+			}
+			if problem.Status != tc.status || problem.Type == "" || problem.Title == "" {
+				t.Errorf("problem = %+v", problem)
+			}
+			if tc.param == "" {
+				return
+			}
+			if len(problem.InvalidParams) == 0 || problem.InvalidParams[0].Name != tc.param {
+				t.Errorf("invalid-params = %+v, want %s", problem.InvalidParams, tc.param)
+			}
+		})
+	}
+}
+
+func TestValidatePaymentRequestNonFinite(t *testing.T) {
+	for _, amount := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		errs := validation.ValidatePaymentRequest(domain.PaymentRequest{CorrelationID: validID, Amount: amount}, 0)
+		if len(errs) != 1 || errs[0].Name != "amount" {
+			t.Errorf("amount %v: errs = %+v", amount, errs)
+		}
+	}
+}
+
+func TestValidatePaymentRequestMaxAmount(t *testing.T) {
+	req := domain.PaymentRequest{CorrelationID: validID, Amount: 500}
+	if errs := validation.ValidatePaymentRequest(req, 100); len(errs) != 1 || errs[0].Reason != "must not exceed 100" {
+		t.Errorf("max 100: errs = %+v", errs)
+	}
+	if errs := validation.ValidatePaymentRequest(req, 0); len(errs) != 0 {
+		t.Errorf("default max: errs = %+v", errs)
+	}
+}
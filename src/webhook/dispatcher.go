@@ -0,0 +1,440 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	PaymentCompleted    = "payment.completed"
+	PaymentFallback     = "payment.fallback"
+	PaymentDeadLettered = "payment.dead_lettered"
+)
+
+const (
+	Pending   = "pending"
+	Delivered = "delivered"
+	// Failed é a entrega desistida (dead letter): não é mais tentada e fica
+	// para consulta na API administrativa.
+	Failed = "failed"
+)
+
+const (
+	dueKey        = "webhook:due"        // sorted set: id -> próxima tentativa (unix ms)
+	deliveriesKey = "webhook:deliveries" // sorted set: id -> criação (unix ms)
+	claimsKey     = "webhook:claims"     // hash: id -> quantas vezes foi reservada
+	deliveryTTL   = 7 * 24 * time.Hour
+	maxAttempts   = 10
+	pollInterval  = 500 * time.Millisecond
+	claimBatch    = 50
+	// claimLease é quanto tempo uma entrega fica reservada para quem a pegou;
+	// se a instância cair no meio, ela volta a vencer depois disso.
+	claimLease = 30 * time.Second
+	// enqueueBatch é quantas notificações vão em cada ida ao Redis.
+	enqueueBatch = 128
+)
+
+// claimScript reserva a entrega empurrando o vencimento para frente, só se
+// ela ainda estiver vencida: das instâncias que a viram, só uma consegue.
+// Devolve quantas vezes ela já foi reservada (0 se não conseguiu), para o
+// limite de tentativas valer mesmo quando a tentativa não chega a ser gravada.
+var claimScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+	return redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+end
+return 0`)
+
+// Attempt é uma linha do log de entrega.
+type Attempt struct {
+	At     time.Time `json:"at"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type Delivery struct {
+	ID          string          `json:"id"`
+	Event       string          `json:"event"`
+	Endpoint    string          `json:"endpoint"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    []Attempt       `json:"attempts"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	NextAttempt time.Time       `json:"nextAttempt,omitzero"`
+}
+
+type Config struct {
+	Endpoints []string
+	// Secret assina as entregas; obrigatório.
+	Secret string
+	// Events limita os eventos enviados; vazio envia todos.
+	Events []string
+	// MaxAttempts é quantas tentativas uma entrega tem antes de ir para
+	// Failed.
+	MaxAttempts int
+}
+
+// ErrNoSecret recusa webhooks sem WEBHOOK_SECRET: sem assinatura, quem
+// recebe não tem como saber que a notificação veio do gateway.
+var ErrNoSecret = errors.New("webhooks need WEBHOOK_SECRET")
+
+// ConfigFromEnv lê WEBHOOK_URLS, WEBHOOK_SECRET, WEBHOOK_EVENTS (listas
+// separadas por vírgula) e WEBHOOK_MAX_ATTEMPTS.
+func ConfigFromEnv() Config {
+	config := Config{
+		Endpoints:   splitList(os.Getenv("WEBHOOK_URLS")),
+		Secret:      os.Getenv("WEBHOOK_SECRET"),
+		Events:      splitList(os.Getenv("WEBHOOK_EVENTS")),
+		MaxAttempts: maxAttempts,
+	}
+	if v, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && v > 0 {
+		config.MaxAttempts = v
+	}
+	return config
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func NewDispatcher(client *redis.Client, config Config) (*Dispatcher, error) {
+	if config.Secret == "" {
+		return nil, ErrNoSecret
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = maxAttempts
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		client:   client,
+		config:   config,
+		http:     &http.Client{Timeout: 5 * time.Second},
+		pending:  make(chan Delivery, 4096),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		enqueued: make(chan struct{}),
+	}, nil
+}
+
+// Dispatcher grava cada notificação como uma entrega no Redis e um worker
+// as envia com retentativas e backoff exponencial. Como a fila é o Redis,
+// qualquer instância pode entregar e nada se perde num restart. A gravação
+// é feita em lotes por uma goroutine, fora do caminho do pagamento.
+type Dispatcher struct {
+	client   *redis.Client
+	config   Config
+	http     *http.Client
+	pending  chan Delivery
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	enqueued chan struct{}
+}
+
+// Notify enfileira event para cada endpoint configurado, sem ir ao Redis:
+// a entrega é gravada depois, em lote. Com a fila local cheia grava na hora.
+func (d *Dispatcher) Notify(event string, payload any) {
+	if len(d.config.Events) > 0 && !slices.Contains(d.config.Events, event) {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("❌ Webhook %s não serializado: %v", event, err)
+		return
+	}
+	now := time.Now().UTC()
+	for _, endpoint := range d.config.Endpoints {
+		delivery := Delivery{
+			ID:          newID(),
+			Event:       event,
+			Endpoint:    endpoint,
+			Payload:     body,
+			Status:      Pending,
+			Attempts:    []Attempt{},
+			CreatedAt:   now,
+			NextAttempt: now,
+		}
+		select {
+		case d.pending <- delivery:
+		default:
+			d.enqueue([]Delivery{delivery})
+		}
+	}
+}
+
+// enqueue grava as entregas num só MULTI.
+func (d *Dispatcher) enqueue(deliveries []Delivery) {
+	ctx := context.Background()
+	_, err := d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, delivery := range deliveries {
+			data, err := json.Marshal(delivery)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, deliveryKey(delivery.ID), data, deliveryTTL)
+			pipe.ZAdd(ctx, deliveriesKey, redis.Z{Score: float64(delivery.CreatedAt.UnixMilli()), Member: delivery.ID})
+			pipe.ZAdd(ctx, dueKey, redis.Z{Score: float64(delivery.NextAttempt.UnixMilli()), Member: delivery.ID})
+		}
+		oldest := time.Now().Add(-deliveryTTL).UnixMilli()
+		pipe.ZRemRangeByScore(ctx, deliveriesKey, "-inf", strconv.FormatInt(oldest, 10))
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ %d webhooks não enfileirados: %v", len(deliveries), err)
+	}
+}
+
+// enqueueLoop grava as notificações do Notify; no Stop grava as que faltam.
+func (d *Dispatcher) enqueueLoop() {
+	defer close(d.enqueued)
+	batch := make([]Delivery, 0, enqueueBatch)
+	for {
+		select {
+		case delivery := <-d.pending:
+			batch = append(batch[:0], delivery)
+		case <-d.ctx.Done():
+			for {
+				batch = batch[:0]
+				for len(batch) < enqueueBatch && len(d.pending) > 0 {
+					batch = append(batch, <-d.pending)
+				}
+				if len(batch) == 0 {
+					return
+				}
+				d.enqueue(batch)
+			}
+		}
+		for len(batch) < enqueueBatch && len(d.pending) > 0 {
+			batch = append(batch, <-d.pending)
+		}
+		d.enqueue(batch)
+	}
+}
+
+func (d *Dispatcher) Start() {
+	go d.enqueueLoop()
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			d.deliverDue()
+		}
+	}()
+}
+
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	<-d.done
+	<-d.enqueued
+}
+
+// deliverDue tenta as entregas vencidas que esta instância conseguir reservar.
+func (d *Dispatcher) deliverDue() {
+	ctx := context.Background()
+	now := time.Now()
+	ids, err := d.client.ZRangeByScore(ctx, dueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: claimBatch,
+	}).Result()
+	if err != nil {
+		log.Println("Erro ao buscar webhooks pendentes:", err)
+		return
+	}
+	for _, id := range ids {
+		claims, err := claimScript.Run(ctx, d.client, []string{dueKey, claimsKey}, id, now.UnixMilli(), now.Add(claimLease).UnixMilli()).Int()
+		if err != nil || claims == 0 {
+			continue
+		}
+		d.attempt(id, claims)
+	}
+}
+
+func (d *Dispatcher) attempt(id string, claims int) {
+	ctx := context.Background()
+	delivery, found, err := d.Delivery(id)
+	if err != nil {
+		if claims > d.config.MaxAttempts {
+			// Ilegível ou sem Redis a cada reserva: não adianta insistir
+			log.Printf("❌ Webhook %s descartado após %d reservas: %v", id, claims, err)
+			d.client.ZRem(ctx, dueKey, id)
+			d.client.HDel(ctx, claimsKey, id)
+		}
+		return
+	}
+	if !found || delivery.Status != Pending {
+		// Expirou ou já foi resolvida
+		d.client.ZRem(ctx, dueKey, id)
+		d.client.HDel(ctx, claimsKey, id)
+		return
+	}
+	now := time.Now().UTC()
+	if claims > d.config.MaxAttempts {
+		// As tentativas anteriores não chegaram a ser gravadas (a instância
+		// caiu no meio): conta as reservas para não tentar para sempre
+		delivery.Attempts = append(delivery.Attempts, Attempt{At: now, Error: fmt.Sprintf("abandoned after %d claims", claims)})
+	} else {
+		attempt := Attempt{At: now}
+		status, err := d.send(delivery, now)
+		attempt.Status = status
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		delivery.Attempts = append(delivery.Attempts, attempt)
+	}
+
+	switch last := delivery.Attempts[len(delivery.Attempts)-1]; {
+	case last.Error == "":
+		delivery.Status = Delivered
+		delivery.NextAttempt = time.Time{}
+	case len(delivery.Attempts) >= d.config.MaxAttempts || claims > d.config.MaxAttempts:
+		delivery.Status = Failed
+		delivery.NextAttempt = time.Time{}
+		log.Printf("❌ Webhook %s para %s desistido após %d tentativas", delivery.Event, delivery.Endpoint, len(delivery.Attempts))
+	default:
+		delivery.NextAttempt = now.Add(backoff(len(delivery.Attempts)))
+	}
+
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return
+	}
+	_, err = d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, deliveryKey(id), data, deliveryTTL)
+		if delivery.Status == Pending {
+			pipe.ZAdd(ctx, dueKey, redis.Z{Score: float64(delivery.NextAttempt.UnixMilli()), Member: id})
+		} else {
+			pipe.ZRem(ctx, dueKey, id)
+			pipe.HDel(ctx, claimsKey, id)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠ Webhook %s: resultado não gravado: %v", id, err)
+	}
+}
+
+// send faz o POST e devolve o status HTTP (0 se não houve resposta).
+func (d *Dispatcher) send(delivery Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, delivery.Endpoint, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(d.config.Secret, timestamp, delivery.Payload))
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign é o HMAC-SHA256 em hex de "timestamp.payload". Quem recebe refaz a
+// conta com o mesmo segredo e compara com X-Webhook-Signature.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff dobra a partir de 1s até 5min.
+func backoff(attempts int) time.Duration {
+	return min(time.Second<<(attempts-1), 5*time.Minute)
+}
+
+func (d *Dispatcher) Delivery(id string) (Delivery, bool, error) {
+	var delivery Delivery
+	data, err := d.client.Get(context.Background(), deliveryKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return delivery, false, nil
+	}
+	if err != nil {
+		return delivery, false, err
+	}
+	if err := json.Unmarshal(data, &delivery); err != nil {
+		return delivery, false, err
+	}
+	return delivery, true, nil
+}
+
+// Deliveries devolve as entregas mais recentes primeiro, opcionalmente só as
+// com status.
+func (d *Dispatcher) Deliveries(status string, limit int) ([]Delivery, error) {
+	ctx := context.Background()
+	deliveries := []Delivery{}
+	var offset int64
+	for len(deliveries) < limit {
+		ids, err := d.client.ZRevRange(ctx, deliveriesKey, offset, offset+int64(limit)-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		offset += int64(len(ids))
+		for _, id := range ids {
+			delivery, found, err := d.Delivery(id)
+			if err != nil {
+				return nil, err
+			}
+			if !found || (status != "" && delivery.Status != status) {
+				continue
+			}
+			deliveries = append(deliveries, delivery)
+			if len(deliveries) == limit {
+				break
+			}
+		}
+	}
+	return deliveries, nil
+}
+
+func deliveryKey(id string) string {
+	return "webhook_delivery:" + id
+}
+
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,126 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const secret = "s3cret"
+
+func newDispatcher(t *testing.T, endpoint string, maxAttempts int) *Dispatcher {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	d, err := NewDispatcher(client, Config{Endpoints: []string{endpoint}, Secret: secret, MaxAttempts: maxAttempts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// waitStatus espera a única entrega chegar a status.
+func waitStatus(t *testing.T, d *Dispatcher, status string, timeout time.Duration) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		deliveries, err := d.Deliveries(status, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			all, _ := d.Deliveries("", 10)
+			t.Fatalf("no %s delivery: %+v", status, all)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestDispatcherRequiresSecret(t *testing.T) {
+	if _, err := NewDispatcher(nil, Config{Endpoints: []string{"http://x"}}); err != ErrNoSecret {
+		t.Errorf("err = %v, want ErrNoSecret", err)
+	}
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	got := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + Sign(secret, r.Header.Get("X-Webhook-Timestamp"), body)
+		if r.Header.Get("X-Webhook-Signature") != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		got <- r
+	}))
+	defer srv.Close()
+	d := newDispatcher(t, srv.URL, 3)
+	// Antes do Start: fica na fila local
+	d.Notify(PaymentCompleted, Notification{Event: PaymentCompleted, CorrelationID: "a"})
+	d.Start()
+	defer d.Stop()
+	select {
+	case r := <-got:
+		if r.Header.Get("X-Webhook-Event") != PaymentCompleted {
+			t.Errorf("event = %q", r.Header.Get("X-Webhook-Event"))
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	waitStatus(t, d, Delivered, 2*time.Second)
+}
+
+// TestDispatcherDeadLetters confere que uma entrega que sempre falha para
+// depois de MaxAttempts.
+func TestDispatcherDeadLetters(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	d := newDispatcher(t, srv.URL, 2)
+	d.Start()
+	defer d.Stop()
+	d.Notify(PaymentCompleted, Notification{Event: PaymentCompleted, CorrelationID: "a"})
+	delivery := waitStatus(t, d, Failed, 5*time.Second)
+	if len(delivery.Attempts) != 2 || delivery.Attempts[1].Status != http.StatusInternalServerError {
+		t.Errorf("attempts = %+v", delivery.Attempts)
+	}
+	time.Sleep(3 * pollInterval)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("endpoint called %d times, want 2", n)
+	}
+}
+
+// TestDispatcherAbandonsLostAttempts: reservas cujas tentativas nunca foram
+// gravadas também contam para o limite.
+func TestDispatcherAbandonsLostAttempts(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+	d := newDispatcher(t, srv.URL, 2)
+	d.Notify(PaymentCompleted, Notification{Event: PaymentCompleted, CorrelationID: "a"})
+	d.enqueue([]Delivery{<-d.pending})
+	pending, err := d.Deliveries(Pending, 1)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+	d.attempt(pending[0].ID, 3)
+	delivery, _, _ := d.Delivery(pending[0].ID)
+	if delivery.Status != Failed || calls.Load() != 0 {
+		t.Errorf("delivery = %+v, calls %d", delivery, calls.Load())
+	}
+}
@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"log"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+// Notification é o corpo enviado aos endpoints.
+type Notification struct {
+	Event         string    `json:"event"`
+	CorrelationID string    `json:"correlationId"`
+	Amount        float64   `json:"amount,omitempty"`
+	Processor     string    `json:"processor,omitempty"`
+	RequestedAt   time.Time `json:"requestedAt,omitzero"`
+	Attempts      int       `json:"attempts,omitempty"`
+	OccurredAt    time.Time `json:"occurredAt"`
+}
+
+// WrapPayments notifica payment.completed (e payment.fallback) a cada
+// pagamento gravado em payments.
+func WrapPayments(d *Dispatcher, payments repository.RedisPaymentRepository) repository.RedisPaymentRepository {
+	return &notifyingPayments{payments, d}
+}
+
+type notifyingPayments struct {
+	repository.RedisPaymentRepository
+	dispatcher *Dispatcher
+}
+
+func (r *notifyingPayments) Process(p domain.Payment) error {
+	if err := r.RedisPaymentRepository.Process(p); err != nil {
+		return err
+	}
+	n := Notification{
+		Event:         PaymentCompleted,
+		CorrelationID: p.CorrelationID,
+		Amount:        p.Amount,
+		Processor:     p.Processor,
+		RequestedAt:   p.RequestedAt,
+		OccurredAt:    time.Now().UTC(),
+	}
+	r.dispatcher.Notify(n.Event, n)
+	if p.Processor == "fallback" {
+		n.Event = PaymentFallback
+		r.dispatcher.Notify(n.Event, n)
+	}
+	return nil
+}
+
+// WrapStatuses notifica payment.dead_lettered quando um pagamento que já foi
+// enviado ao menos uma vez termina em failed. Recusas na admissão (429/503)
+// nem ganham estado: o cliente já recebeu o erro na hora.
+func WrapStatuses(d *Dispatcher, statuses repository.StatusRepository) repository.StatusRepository {
+	return &notifyingStatuses{statuses, d}
+}
+
+type notifyingStatuses struct {
+	repository.StatusRepository
+	dispatcher *Dispatcher
+}
+
+func (r *notifyingStatuses) Transition(correlationID string, to domain.PaymentState, processor string) error {
+	if err := r.StatusRepository.Transition(correlationID, to, processor); err != nil {
+		return err
+	}
+	if to != domain.StateFailed {
+		return nil
+	}
+	status, found, err := r.StatusRepository.Get(correlationID)
+	if err != nil || !found {
+		log.Printf("⚠ Webhook de %s não enviado: estado indisponível", correlationID)
+		return nil
+	}
+	if status.Attempts == 0 {
+		return nil
+	}
+	r.dispatcher.Notify(PaymentDeadLettered, Notification{
+		Event:         PaymentDeadLettered,
+		CorrelationID: correlationID,
+		Processor:     status.Processor,
+		Attempts:      status.Attempts,
+		OccurredAt:    status.UpdatedAt,
+	})
+	return nil
+}
@@ -0,0 +1,142 @@
+package worker
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/repository"
+)
+
+// sharedPoll é o intervalo entre as consultas aos pendentes das outras
+// instâncias, que não avisam quando terminam.
+const sharedPoll = 5 * time.Millisecond
+
+type pendingPayment struct {
+	correlationID string
+	requestedAt   time.Time
+}
+
+// InFlight guarda o requestedAt dos pagamentos já carimbados que ainda não
+// foram gravados (ou descartados), para o resumo poder esperar por eles. Com
+// shared eles também ficam no Redis e a espera cobre todas as instâncias.
+type InFlight struct {
+	mu      sync.Mutex
+	next    uint64
+	pending map[uint64]pendingPayment
+	// held são as entradas mantidas por Hold enquanto o pagamento espera na
+	// fila, por correlationId.
+	held    map[string]uint64
+	changed chan struct{}
+	shared  repository.PendingRepository
+}
+
+func NewInFlight(shared repository.PendingRepository) *InFlight {
+	return &InFlight{pending: make(map[uint64]pendingPayment), held: make(map[string]uint64), changed: make(chan struct{}), shared: shared}
+}
+
+// Begin registra o pagamento; tem de vir antes do envio ao processor. Um
+// pagamento segurado por Hold retoma a mesma entrada, e o registro no Redis
+// renova o lease.
+func (f *InFlight) Begin(correlationID string, requestedAt time.Time) uint64 {
+	f.mu.Lock()
+	id, ok := f.held[correlationID]
+	if ok {
+		delete(f.held, correlationID)
+	} else {
+		f.next++
+		id = f.next
+		f.pending[id] = pendingPayment{correlationID, requestedAt}
+	}
+	f.mu.Unlock()
+	if f.shared != nil {
+		if err := f.shared.Add(correlationID, requestedAt); err != nil {
+			log.Printf("⚠ Pendente %s não registrado: %v", correlationID, err)
+		}
+	}
+	return id
+}
+
+// Hold mantém a entrada enquanto o pagamento volta para a fila local: ele
+// continua segurando a barreira até o próximo Begin retomá-la ou um Done.
+func (f *InFlight) Hold(id uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.pending[id]; ok {
+		f.held[p.correlationID] = id
+	}
+}
+
+// Handoff tira a entrada desta instância mas a deixa no Redis, para um
+// pagamento devolvido a uma fila compartilhada: quem o consumir renova o
+// registro, e se ninguém consumir o lease vence.
+func (f *InFlight) Handoff(id uint64) {
+	f.release(id)
+}
+
+func (f *InFlight) Done(id uint64) {
+	p := f.release(id)
+	if f.shared != nil {
+		if err := f.shared.Remove(p.correlationID); err != nil {
+			log.Printf("⚠ Pendente %s não removido: %v", p.correlationID, err)
+		}
+	}
+}
+
+func (f *InFlight) release(id uint64) pendingPayment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.pending[id]
+	delete(f.pending, id)
+	if f.held[p.correlationID] == id {
+		delete(f.held, p.correlationID)
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+	return p
+}
+
+// Wait bloqueia até não restar pagamento em voo com requestedAt <= to ou até
+// o timeout. Retorna false se desistiu com pagamentos ainda em voo.
+func (f *InFlight) Wait(to time.Time, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		f.mu.Lock()
+		settled := true
+		for _, p := range f.pending {
+			if !p.requestedAt.After(to) {
+				settled = false
+				break
+			}
+		}
+		changed := f.changed
+		f.mu.Unlock()
+		if settled {
+			break
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		}
+	}
+	if f.shared == nil {
+		return true
+	}
+	for {
+		n, err := f.shared.Pending(to)
+		if err != nil {
+			log.Println("Erro ao consultar pendentes:", err)
+			return false
+		}
+		if n == 0 {
+			return true
+		}
+		select {
+		case <-time.After(sharedPoll):
+		case <-timer.C:
+			return false
+		}
+	}
+}
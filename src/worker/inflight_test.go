@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// TestInFlightShared simula duas instâncias: a barreira de uma espera o
+// pagamento em voo na outra.
+func TestInFlightShared(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	pending := repository.NewRedisPendingRepository(client)
+	sender, summary := NewInFlight(pending), NewInFlight(pending)
+
+	at := time.Now()
+	id := sender.Begin("a", at)
+	if !summary.Wait(at.Add(-time.Second), 50*time.Millisecond) {
+		t.Error("waited for a payment after to")
+	}
+	if summary.Wait(at, 50*time.Millisecond) {
+		t.Fatal("settled with a payment in flight on the other instance")
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		sender.Done(id)
+	}()
+	if !summary.Wait(at, time.Second) {
+		t.Error("not settled after Done")
+	}
+
+	// O lease conta do registro: um pagamento antigo ainda em retentativa
+	// segura a barreira
+	old := sender.Begin("b", at.Add(-2*time.Minute))
+	if summary.Wait(at.Add(-time.Second), 50*time.Millisecond) {
+		t.Error("an old requestedAt dropped out of the barrier")
+	}
+	sender.Done(old)
+}
+
+// TestInFlightHold: um pagamento devolvido à fila segura a barreira até ser
+// retomado e concluído.
+func TestInFlightHold(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	f, other := NewInFlight(repository.NewRedisPendingRepository(client)), NewInFlight(repository.NewRedisPendingRepository(client))
+	at := time.Now()
+	f.Hold(f.Begin("a", at))
+	if f.Wait(at, 20*time.Millisecond) || other.Wait(at, 20*time.Millisecond) {
+		t.Fatal("settled with a held payment")
+	}
+	// Retomado pelo Begin da nova tentativa: uma entrada só
+	id := f.Begin("a", at)
+	f.Done(id)
+	if !f.Wait(at, 20*time.Millisecond) || !other.Wait(at, 20*time.Millisecond) {
+		t.Error("not settled after the retry finished")
+	}
+
+	// Handoff: só a entrada no Redis fica, para quem consumir a fila
+	f.Handoff(f.Begin("b", at))
+	if !f.Wait(at.Add(-time.Second), 20*time.Millisecond) {
+		t.Error("handoff kept waiting on an earlier payment")
+	}
+	if other.Wait(at, 20*time.Millisecond) {
+		t.Error("handoff dropped the shared entry")
+	}
+	other.Done(other.Begin("b", at))
+	if !f.Wait(at, 20*time.Millisecond) {
+		t.Error("not settled after the other instance finished")
+	}
+}
+
+func TestInFlightLocal(t *testing.T) {
+	f := NewInFlight(nil)
+	at := time.Now()
+	id := f.Begin("a", at)
+	if f.Wait(at, 10*time.Millisecond) {
+		t.Fatal("settled with a payment in flight")
+	}
+	f.Done(id)
+	if !f.Wait(at, 10*time.Millisecond) {
+		t.Error("not settled after Done")
+	}
+}
@@ -1,49 +1,166 @@
 package worker
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
-	"net/http"
-	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/alexsandroveiga/rdb25/src/configuration/queue"
 	"github.com/alexsandroveiga/rdb25/src/domain"
 	"github.com/alexsandroveiga/rdb25/src/messaging"
+	"github.com/alexsandroveiga/rdb25/src/processor"
 	"github.com/alexsandroveiga/rdb25/src/repository"
 	"github.com/alexsandroveiga/rdb25/src/util"
 )
 
-var (
-	WorkerCount = 4
-)
+var WorkerCount = 4
+
+// defaultHasFailed marca que o default já falhou uma vez; lido e escrito
+// por todos os workers.
+var defaultHasFailed atomic.Bool
+
+func NewWorker(queue chan domain.PaymentRequest, client *processor.Client, repository repository.RedisPaymentRepository, unknowns repository.ReconciliationRepository, statuses repository.StatusRepository, pending repository.PendingRepository) *Worker {
+	return &Worker{
+		queue:      queue,
+		client:     client,
+		repository: repository,
+		unknowns:   unknowns,
+		statuses:   statuses,
+		inFlight:   NewInFlight(pending),
+		running:    closedGate(),
+		paused:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func closedGate() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+type Worker struct {
+	queue      chan domain.PaymentRequest
+	client     *processor.Client
+	repository repository.RedisPaymentRepository
+	unknowns   repository.ReconciliationRepository
+	statuses   repository.StatusRepository
+	inFlight   *InFlight
+	override   atomic.Value // string: "", processor.Default ou processor.Fallback
+	gateMu     sync.Mutex
+	running    chan struct{} // fechado enquanto os workers não estão pausados
+	paused     chan struct{} // fechado enquanto estão pausados
+	done       chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+}
+
+// Settle espera (até timeout) os pagamentos enviados com requestedAt <= to
+// serem gravados no repositório.
+func (w *Worker) Settle(to time.Time, timeout time.Duration) bool {
+	return w.inFlight.Wait(to, timeout)
+}
+
+// Pause faz os workers pararem de tirar pagamentos da fila; os que já estão
+// em andamento terminam normalmente.
+func (w *Worker) Pause() {
+	w.gateMu.Lock()
+	defer w.gateMu.Unlock()
+	select {
+	case <-w.running:
+		w.running = make(chan struct{})
+		close(w.paused)
+	default:
+	}
+}
+
+func (w *Worker) Resume() {
+	w.gateMu.Lock()
+	defer w.gateMu.Unlock()
+	select {
+	case <-w.running:
+	default:
+		close(w.running)
+		w.paused = make(chan struct{})
+	}
+}
+
+func (w *Worker) Paused() bool {
+	select {
+	case <-w.gate():
+		return false
+	default:
+		return true
+	}
+}
+
+func (w *Worker) gate() chan struct{} {
+	w.gateMu.Lock()
+	defer w.gateMu.Unlock()
+	return w.running
+}
+
+// wait bloqueia enquanto os workers estiverem pausados e devolve o channel
+// que será fechado no próximo Pause. Retorna false no Stop.
+func (w *Worker) wait() (chan struct{}, bool) {
+	w.gateMu.Lock()
+	running, paused := w.running, w.paused
+	w.gateMu.Unlock()
+	select {
+	case <-w.done:
+		return nil, false
+	case <-running:
+		return paused, true
+	}
+}
+
+// SetOverride força todos os envios para um processor ("" volta ao roteamento
+// por health check).
+func (w *Worker) SetOverride(name string) error {
+	switch name {
+	case "", processor.Default, processor.Fallback:
+		w.override.Store(name)
+		return nil
+	}
+	return fmt.Errorf("unknown processor %q", name)
+}
+
+func (w *Worker) Override() string {
+	name, _ := w.override.Load().(string)
+	return name
+}
 
-func ProcessPayment(repository repository.RedisPaymentRepository) {
-	client := &http.Client{}
-	var firstDefaultFail bool = true
-	for i := range WorkerCount {
+// Stop sinaliza as goroutines e espera o pagamento em andamento de cada uma terminar.
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() { close(w.done) })
+	w.wg.Wait()
+}
+
+func (w *Worker) ProcessPayment(count int) {
+	for i := range count {
+		w.wg.Add(1)
 		go func(id int) {
-			for req := range queue.Queue {
-				var processor string
-				now := time.Now().UTC()
-				req.RequestedAt = now.Format("2006-01-02T15:04:05.999Z")
-
-				if util.IsHealthy("default") && sendToProcessor(client, os.Getenv("URL_PROCESSOR_DEFAULT"), req) {
-					processor = "default"
-				} else {
-					if firstDefaultFail {
-						log.Println("⏳ Aguardando 3s antes de tentar fallback (primeira falha do default)")
-						time.Sleep(3 * time.Second)
-						firstDefaultFail = false
-					}
-					if sendToProcessor(client, os.Getenv("URL_PROCESSOR_DEFAULT"), req) {
-						processor = "default"
-					} else if util.IsHealthy("fallback") && sendToProcessor(client, os.Getenv("URL_PROCESSOR_FALLBACK"), req) {
-						processor = "fallback"
-					}
+			defer w.wg.Done()
+			for {
+				paused, ok := w.wait()
+				if !ok {
+					return
 				}
+				var req domain.PaymentRequest
+				select {
+				case <-w.done:
+					return
+				case <-paused:
+					continue
+				case req = <-w.queue:
+				}
+				requestedAt := req.Stamp(time.Now())
+				inFlight := w.inFlight.Begin(req.CorrelationID, requestedAt)
+				w.track(req.CorrelationID, domain.StateInFlight, "")
+
+				name, outcome := route(w.client, req, 3*time.Second, w.Override())
 
 				// if util.IsHealthy("default") {
 				// 	if sendToProcessor(client, "http://localhost:8001/payments", req) {
@@ -64,16 +181,26 @@ func ProcessPayment(repository repository.RedisPaymentRepository) {
 				// 		processor = "fallback"
 				// 	}
 				// }
-				if processor == "" {
+				if outcome == processor.Unknown {
+					// Não reenfileira: o processor pode ter aceitado, quem decide é a reconciliação
+					w.track(req.CorrelationID, domain.StateUnknown, name)
+					if err := w.unknowns.MarkUnknown(req); err != nil {
+						log.Printf("❌ Não foi possível marcar %s como desconhecido: %v", req.CorrelationID, err)
+					}
+					w.inFlight.Done(inFlight)
+					continue
+				}
+				if outcome == processor.Failed {
+					// O pagamento segue na barreira enquanto espera a nova tentativa
+					w.inFlight.Hold(inFlight)
 					// log.Printf("⚠ Nenhum processor disponível para %s", req.CorrelationID)
 
+					w.track(req.CorrelationID, domain.StateRetrying, "")
 					go func(r domain.PaymentRequest) {
 						time.Sleep(200 * time.Millisecond)
-						select {
-						case queue.Queue <- r:
-							// log.Printf("♻ Reenfileirado: %s", r.CorrelationID)
-						default:
-							// log.Printf("❌ Fila cheia, não foi possível reenfileirar: %s", r.CorrelationID)
+						if !w.Requeue(r) {
+							w.inFlight.Done(inFlight)
+							w.track(r.CorrelationID, domain.StateFailed, "")
 						}
 					}(req)
 
@@ -85,83 +212,139 @@ func ProcessPayment(repository repository.RedisPaymentRepository) {
 				p := domain.Payment{
 					CorrelationID: req.CorrelationID,
 					Amount:        req.Amount,
-					RequestedAt:   now,
-					Processor:     processor,
+					RequestedAt:   requestedAt,
+					Processor:     name,
 				}
-				repository.Process(p)
+				if err := w.repository.Process(p); err != nil {
+					log.Printf("❌ Pagamento %s cobrado mas não gravado: %v", p.CorrelationID, err)
+				}
+				w.inFlight.Done(inFlight)
+				w.track(p.CorrelationID, domain.StateCompleted, name)
 			}
 		}(i)
 	}
 }
 
-func StartWorker(queue messaging.PaymentMessaging, repository repository.RedisPaymentRepository) {
-	ctx := context.Background()
-	client := &http.Client{}
-	var firstDefaultFail bool = true
+func (w *Worker) Requeue(r domain.PaymentRequest) bool {
+	select {
+	case w.queue <- r:
+		// log.Printf("♻ Reenfileirado: %s", r.CorrelationID)
+		return true
+	default:
+		// log.Printf("❌ Fila cheia, não foi possível reenfileirar: %s", r.CorrelationID)
+		return false
+	}
+}
+
+// StartWorker sobe uma goroutine que consome queue até o Stop. O Add vem
+// antes do go, como no ProcessPayment, para o Stop nunca esperar antes dele.
+func (w *Worker) StartWorker(queue messaging.PaymentMessaging) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.consume(queue)
+	}()
+}
+
+func (w *Worker) consume(queue messaging.PaymentMessaging) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-w.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
 	for {
+		if _, ok := w.wait(); !ok {
+			return
+		}
 		req, err := queue.Consume(ctx) // Bloqueia até ter mensagem
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			log.Println("Erro ao consumir:", err)
 			continue
 		}
-		var processor string
-		now := time.Now().UTC()
-		req.RequestedAt = now.Format("2006-01-02T15:04:05.999Z")
-		if util.IsHealthy("default") && sendToProcessor(client, os.Getenv("URL_PROCESSOR_DEFAULT"), req) {
-			processor = "default"
-		} else {
-			if firstDefaultFail {
-				log.Println("⏳ Aguardando 5s antes de tentar fallback (primeira falha do default)")
-				time.Sleep(5 * time.Second)
-				firstDefaultFail = false
-			}
-			if sendToProcessor(client, os.Getenv("URL_PROCESSOR_DEFAULT"), req) {
-				processor = "default"
-			} else if util.IsHealthy("fallback") && sendToProcessor(client, os.Getenv("URL_PROCESSOR_FALLBACK"), req) {
-				processor = "fallback"
+		requestedAt := req.Stamp(time.Now())
+		inFlight := w.inFlight.Begin(req.CorrelationID, requestedAt)
+		w.track(req.CorrelationID, domain.StateInFlight, "")
+		name, outcome := route(w.client, req, 5*time.Second, w.Override())
+		if outcome == processor.Unknown {
+			w.track(req.CorrelationID, domain.StateUnknown, name)
+			if err := w.unknowns.MarkUnknown(req); err != nil {
+				log.Printf("❌ Não foi possível marcar %s como desconhecido: %v", req.CorrelationID, err)
 			}
+			w.inFlight.Done(inFlight)
+			continue
 		}
-		if processor == "" {
+		if outcome == processor.Failed {
 			// log.Printf("⚠ Nenhum processor disponível para %s", req.CorrelationID)
 
+			w.track(req.CorrelationID, domain.StateRetrying, "")
 			go func(r domain.PaymentRequest) {
 				time.Sleep(200 * time.Millisecond)
 				log.Printf("♻ Reenfileirado: %s", r.CorrelationID)
-				if err := queue.Produce(ctx, req); err != nil {
+				if err := queue.Produce(context.Background(), req); err != nil {
 					log.Printf("❌ Fila cheia, não foi possível reenfileirar: %s", r.CorrelationID)
+					w.inFlight.Done(inFlight)
+					w.track(r.CorrelationID, domain.StateFailed, "")
+					return
 				}
+				// A fila do Redis é de todas as instâncias: o registro
+				// compartilhado fica para quem consumir o pagamento de novo
+				w.inFlight.Handoff(inFlight)
 			}(req)
 
 			continue
 		}
-		if processor == "fallback" {
+		if name == processor.Fallback {
 			log.Printf("🔴 Salvo no fallback %s", req.CorrelationID)
 		}
 		p := domain.Payment{
 			CorrelationID: req.CorrelationID,
 			Amount:        req.Amount,
-			RequestedAt:   now,
-			Processor:     processor,
+			RequestedAt:   requestedAt,
+			Processor:     name,
 		}
-		repository.Process(p)
+		if err := w.repository.Process(p); err != nil {
+			log.Printf("❌ Pagamento %s cobrado mas não gravado: %v", p.CorrelationID, err)
+		}
+		w.inFlight.Done(inFlight)
+		w.track(p.CorrelationID, domain.StateCompleted, name)
 	}
 }
 
-func sendToProcessor(client *http.Client, url string, req domain.PaymentRequest) bool {
-	body, _ := json.Marshal(req)
-	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
-	if err != nil {
-		return false
+func (w *Worker) track(correlationID string, to domain.PaymentState, processor string) {
+	if err := w.statuses.Transition(correlationID, to, processor); err != nil {
+		log.Printf("⚠ Estado de %s não registrado: %v", correlationID, err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return false
+}
+
+// route tenta o default e, se ele falhar, o fallback. Um resultado Unknown
+// interrompe a tentativa: mandar de novo poderia cobrar o pagamento duas vezes.
+func route(client *processor.Client, req domain.PaymentRequest, firstFailWait time.Duration, override string) (string, processor.Outcome) {
+	if override != "" {
+		return override, client.Send(override, req)
+	}
+	if util.IsHealthy(processor.Default) {
+		if outcome := client.Send(processor.Default, req); outcome != processor.Failed {
+			return processor.Default, outcome
+		}
+	}
+	if !defaultHasFailed.Load() {
+		log.Printf("⏳ Aguardando %s antes de tentar fallback (primeira falha do default)", firstFailWait)
+		time.Sleep(firstFailWait)
+		defaultHasFailed.Store(true)
+	}
+	if outcome := client.Send(processor.Default, req); outcome != processor.Failed {
+		return processor.Default, outcome
 	}
-	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
-		log.Printf("🔴🔴🔴 ERRO 4XX => %d 🔴🔴🔴", resp.StatusCode)
+	if util.IsHealthy(processor.Fallback) {
+		return processor.Fallback, client.Send(processor.Fallback, req)
 	}
-	defer resp.Body.Close()
-	return resp.StatusCode >= 200 && resp.StatusCode < 300
+	return "", processor.Failed
 }
@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexsandroveiga/rdb25/src/domain"
+	"github.com/alexsandroveiga/rdb25/src/messaging"
+	"github.com/alexsandroveiga/rdb25/src/processor"
+	"github.com/alexsandroveiga/rdb25/src/repository"
+	"github.com/alexsandroveiga/rdb25/src/util"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// stub é um processor em httptest que responde 500 enquanto failing.
+type stub struct {
+	failing  atomic.Bool
+	received atomic.Int32
+}
+
+func newStub(t *testing.T, name string) *stub {
+	t.Helper()
+	s := &stub{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /payments", func(w http.ResponseWriter, r *http.Request) {
+		if s.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.received.Add(1)
+	})
+	mux.HandleFunc("GET /payments/service-health", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(domain.HealthResponse{Failing: s.failing.Load()})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Setenv("URL_PROCESSOR_"+name, srv.URL+"/payments")
+	t.Setenv("URL_HEALTH_"+name, srv.URL+"/payments/service-health")
+	return s
+}
+
+// consumer roda StartWorker sobre uma fila no Redis em processo.
+type consumer struct {
+	worker   *Worker
+	queue    messaging.PaymentMessaging
+	payments repository.RedisPaymentRepository
+	statuses repository.StatusRepository
+	def, fb  *stub
+}
+
+func newConsumer(t *testing.T) *consumer {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	util.SetRedisClient(client)
+	// Sem a espera da primeira falha do default
+	defaultHasFailed.Store(true)
+	t.Cleanup(func() { defaultHasFailed.Store(false) })
+
+	c := &consumer{
+		queue:    messaging.NewPaymentMessaging(client),
+		payments: repository.NewRedisPaymentRepository(client),
+		statuses: repository.NewRedisStatusRepository(client),
+		def:      newStub(t, "DEFAULT"),
+		fb:       newStub(t, "FALLBACK"),
+	}
+	c.worker = NewWorker(nil, processor.NewClient(), c.payments, repository.NewRedisReconciliationRepository(client), c.statuses, repository.NewRedisPendingRepository(client))
+	c.worker.StartWorker(c.queue)
+	t.Cleanup(c.worker.Stop)
+	return c
+}
+
+func (c *consumer) produce(t *testing.T, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := c.queue.Produce(context.Background(), domain.PaymentRequest{CorrelationID: id, Amount: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// wait espera o repositório ter want pagamentos.
+func (c *consumer) wait(t *testing.T, want int) domain.PaymentSummary {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s, err := c.payments.GetSummary(time.Time{}, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Default.TotalRequests+s.Fallback.TotalRequests == want {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("summary = %+v, want %d payments", s, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// retrying espera o pagamento id falhar nos dois processors.
+func (c *consumer) retrying(t *testing.T, id string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		status, _, _ := c.statuses.Get(id)
+		if status.State == domain.StateRetrying {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %+v, want retrying", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartWorker(t *testing.T) {
+	c := newConsumer(t)
+	c.produce(t, "a", "b", "c")
+	if s := c.wait(t, 3); s.Default.TotalRequests != 3 || c.def.received.Load() != 3 {
+		t.Errorf("summary %+v, default received %d", s, c.def.received.Load())
+	}
+	status, _, err := c.statuses.Get("a")
+	if err != nil || status.State != domain.StateCompleted || status.Processor != processor.Default {
+		t.Errorf("status = %+v, %v", status, err)
+	}
+}
+
+// TestStartWorkerFallback: com o default fora, o pagamento vai pelo fallback.
+func TestStartWorkerFallback(t *testing.T) {
+	c := newConsumer(t)
+	c.def.failing.Store(true)
+	c.produce(t, "a")
+	if s := c.wait(t, 1); s.Fallback.TotalRequests != 1 {
+		t.Errorf("summary = %+v, want the payment on fallback", s)
+	}
+}
+
+// TestStartWorkerRequeue: com os dois fora, o pagamento volta para a fila do
+// Redis e sai quando o default volta.
+func TestStartWorkerRequeue(t *testing.T) {
+	c := newConsumer(t)
+	c.def.failing.Store(true)
+	c.fb.failing.Store(true)
+	c.produce(t, "a")
+	c.retrying(t, "a")
+	c.def.failing.Store(false)
+	util.InvalidateHealth(processor.Default)
+	if s := c.wait(t, 1); s.Default.TotalRequests != 1 {
+		t.Errorf("summary = %+v, want the requeued payment on default", s)
+	}
+}
+
+// TestStartWorkerStop: Stop interrompe o BLPOP de uma fila vazia em até uma
+// fatia de consumo.
+func TestStartWorkerStop(t *testing.T) {
+	c := newConsumer(t)
+	time.Sleep(20 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		c.worker.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("StartWorker still blocked on the queue after Stop")
+	}
+}
+
+// TestRetryHoldsBarrier: um pagamento que volta para a fila local segura a
+// barreira do resumo durante todas as tentativas, não só enquanto está no
+// processor.
+func TestRetryHoldsBarrier(t *testing.T) {
+	c := newConsumer(t)
+	c.def.failing.Store(true)
+	c.fb.failing.Store(true)
+	queue := make(chan domain.PaymentRequest, 10)
+	w := NewWorker(queue, processor.NewClient(), c.payments, repository.NewRedisReconciliationRepository(nil), c.statuses, nil)
+	w.ProcessPayment(1)
+	t.Cleanup(w.Stop)
+
+	at := time.Now().UTC().Truncate(time.Millisecond)
+	queue <- domain.PaymentRequest{CorrelationID: "a", Amount: 10, RequestedAt: at.Format(domain.RequestedAtLayout)}
+	c.retrying(t, "a")
+	// Várias rodadas de 200ms entre as tentativas
+	if w.Settle(at, 700*time.Millisecond) {
+		t.Fatal("settled while the payment was waiting for a retry")
+	}
+	c.def.failing.Store(false)
+	util.InvalidateHealth(processor.Default)
+	if !w.Settle(at, 3*time.Second) {
+		t.Fatal("not settled after the payment went through")
+	}
+	if s := c.wait(t, 1); s.Default.TotalRequests != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+}